@@ -48,6 +48,43 @@ func TestEncodeCffDictData(t *testing.T) {
 	}
 }
 
+func TestEncodePrivateDict(t *testing.T) {
+	f := &Font{
+		bluevalues:        []float64{-12, 12, 480, 12.5, 700, 12},
+		otherblues:        []float64{-250, 10},
+		familyblues:       []float64{-12, 12},
+		familyotherblues:  []float64{-250, 10},
+		bluescale:         0.0375,
+		blueshift:         5,
+		bluefuzz:          0,
+		stdhw:             50,
+		stdvw:             84.5,
+		stemsnapv:         []float64{84, 90, 96},
+		forceBold:         true,
+		languageGroup:     1,
+		expansionFactor:   0.05,
+		initialRandomSeed: 17,
+		defaultWidthX:     500,
+		nominalWidthX:     -300,
+		subrsIndex:        [][]byte{{11}},
+	}
+	// make the dict long enough that the subrs offset needs two bytes
+	for i := 0; i < 50; i++ {
+		f.stemsnaph = append(f.stemsnaph, float64(i*3+20))
+	}
+	b := f.cffEncodePrivateDict()
+	g := &Font{}
+	g.parseDict(b)
+	if got, want := g.subrsOffset, len(b); got != want {
+		t.Errorf("subrsOffset = %d, want %d", got, want)
+	}
+	g.subrsIndex = f.subrsIndex
+	g.subrsOffset = 0
+	if got, want := fmt.Sprintf("%+v", g), fmt.Sprintf("%+v", f); got != want {
+		t.Errorf("parseDict(cffEncodePrivateDict()) = %s, want %s", got, want)
+	}
+}
+
 func TestSubsetMD(t *testing.T) {
 	r, err := os.Open("testdata/maziusdisplay.cff")
 	if err != nil {
@@ -57,8 +94,339 @@ func TestSubsetMD(t *testing.T) {
 	if err != nil {
 		t.Error(err)
 	}
-	cffFontFile.Subset([]int{0, 100, 93, 108, 115})
+	if err = cffFontFile.Subset([]int{0, 100, 93, 108, 115}); err != nil {
+		t.Error(err)
+	}
+}
+
+// inlineSubrs returns the charstring with the subr calls replaced by the
+// subrs without their return operator.
+func inlineSubrs(t *testing.T, f *Font, globalSubr [][]byte, cs []byte) []byte {
+	usage := newSubrUsage()
+	if err := usage.getSubrsIndex(f.nominalWidthX, f.defaultWidthX, globalSubr, f.subrsIndex, cs, subrOwner{}, nil); err != nil {
+		t.Fatal(err)
+	}
+	calls := usage.calls
+
+	var expand func(cs []byte, owner subrOwner) []byte
+	expand = func(cs []byte, owner subrOwner) []byte {
+		var b []byte
+		pos := 0
+		for _, call := range calls[owner] {
+			b = append(b, cs[pos:call.start]...)
+			var subr []byte
+			if call.global {
+				subr = expand(globalSubr[call.index], subrOwner{'g', 0, call.index})
+			} else {
+				subr = expand(f.subrsIndex[call.index], subrOwner{'l', 0, call.index})
+			}
+			if l := len(subr); l > 0 && subr[l-1] == 11 {
+				subr = subr[:l-1]
+			}
+			b = append(b, subr...)
+			pos = call.end + 1
+		}
+		return append(b, cs[pos:]...)
+	}
+	return expand(cs, subrOwner{})
+}
+
+func TestSubsetSubrs(t *testing.T) {
+	for _, fn := range []string{"maziusdisplay", "firasansthin"} {
+		data, err := os.ReadFile("testdata/" + fn + ".cff")
+		if err != nil {
+			t.Fatal(err)
+		}
+		orig, err := ParseCFFData(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		cffFontFile, err := ParseCFFData(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		glyphs := []int{3, 36, 68, 93, 108, 115}
+		if err = cffFontFile.Subset(glyphs); err != nil {
+			t.Fatal(err)
+		}
+		var w bytes.Buffer
+		if err = cffFontFile.WriteCFFData(&w); err != nil {
+			t.Fatal(err)
+		}
+		if cffFontFile, err = ParseCFFData(bytes.NewReader(w.Bytes())); err != nil {
+			t.Fatal(err)
+		}
+		fnt, origFnt := cffFontFile.Font[0], orig.Font[0]
+		if got, orig := len(cffFontFile.globalSubrIndex), len(orig.globalSubrIndex); got >= orig {
+			t.Errorf("%s: len(globalSubrIndex) = %d, want less than %d", fn, got, orig)
+		}
+		if got, orig := len(fnt.subrsIndex), len(origFnt.subrsIndex); got >= orig {
+			t.Errorf("%s: len(subrsIndex) = %d, want less than %d", fn, got, orig)
+		}
+		for _, gid := range append(glyphs, 0) {
+			got := inlineSubrs(t, fnt, cffFontFile.globalSubrIndex, fnt.CharStrings[gid])
+			want := inlineSubrs(t, origFnt, orig.globalSubrIndex, origFnt.CharStrings[gid])
+			if !bytes.Equal(got, want) {
+				t.Errorf("%s: glyph %d differs after subsetting", fn, gid)
+			}
+		}
+	}
+}
 
+func TestSubsetCorruptSubrs(t *testing.T) {
+	data, err := os.ReadFile("testdata/maziusdisplay.cff")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cffFontFile, err := ParseCFFData(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	localBias := calculateBias(cffFontFile.Font[0].subrsIndex)
+	globalBias := calculateBias(cffFontFile.globalSubrIndex)
+	numLocal := len(cffFontFile.Font[0].subrsIndex)
+	for _, td := range []struct {
+		name string
+		cs   []byte
+	}{
+		{"local subr after the last subr", append(encodeType2Number(numLocal-localBias), 10, 14)},
+		{"negative local subr", append(encodeType2Number(-1-localBias), 10, 14)},
+		{"negative global subr", append(encodeType2Number(-1-globalBias), 29, 14)},
+		{"no subr number", []byte{10, 14}},
+		{"truncated number", []byte{28, 0}},
+		{"recursive subr", append(encodeType2Number(-localBias), 10, 14)},
+	} {
+		cffFontFile, err := ParseCFFData(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		fnt := cffFontFile.Font[0]
+		// local subr 0 calls itself
+		fnt.subrsIndex[0] = append(encodeType2Number(-localBias), 10, 11)
+		fnt.CharStrings[3] = td.cs
+		if err = cffFontFile.Subset([]int{3}); err == nil {
+			t.Errorf("%s: Subset got no error", td.name)
+		}
+	}
+}
+
+func TestDesubroutinize(t *testing.T) {
+	for _, fn := range []string{"maziusdisplay", "firasansthin"} {
+		data, err := os.ReadFile("testdata/" + fn + ".cff")
+		if err != nil {
+			t.Fatal(err)
+		}
+		orig, err := ParseCFFData(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		cffFontFile, err := ParseCFFData(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = cffFontFile.Font[0].Desubroutinize(); err != nil {
+			t.Fatal(err)
+		}
+		var w bytes.Buffer
+		if err = cffFontFile.WriteCFFData(&w); err != nil {
+			t.Fatal(err)
+		}
+		if cffFontFile, err = ParseCFFData(bytes.NewReader(w.Bytes())); err != nil {
+			t.Fatal(err)
+		}
+		fnt, origFnt := cffFontFile.Font[0], orig.Font[0]
+		if got := len(cffFontFile.globalSubrIndex) + len(fnt.subrsIndex); got != 0 {
+			t.Errorf("%s: number of subrs = %d, want 0", fn, got)
+		}
+		for gid, cs := range fnt.CharStrings {
+			if want := inlineSubrs(t, origFnt, orig.globalSubrIndex, origFnt.CharStrings[gid]); !bytes.Equal(cs, want) {
+				t.Errorf("%s: glyph %d differs after desubroutinization", fn, gid)
+				break
+			}
+		}
+	}
+}
+
+func TestSubroutinize(t *testing.T) {
+	for _, fn := range []string{"maziusdisplay", "firasansthin", "cid"} {
+		filename := fn
+		if fn == "cid" {
+			filename = "maziusdisplay"
+		}
+		data, err := os.ReadFile("testdata/" + filename + ".cff")
+		if err != nil {
+			t.Fatal(err)
+		}
+		cffFontFile, err := ParseCFFData(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		fnt := cffFontFile.Font[0]
+		if fn == "cid" {
+			fnt = cidFont(cffFontFile)
+		}
+		localSubrs := func(fnt *Font, gid int) [][]byte {
+			if fnt.IsCIDFont() {
+				return fnt.fdFonts[fnt.fdIndex[gid]].subrsIndex
+			}
+			return fnt.subrsIndex
+		}
+		want := make([][]byte, len(fnt.CharStrings))
+		for gid, cs := range fnt.CharStrings {
+			if want[gid], err = desubroutinize(cs, cffFontFile.globalSubrIndex, localSubrs(fnt, gid)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err = fnt.Desubroutinize(); err != nil {
+			t.Fatal(err)
+		}
+		var desubroutinized bytes.Buffer
+		if err = cffFontFile.WriteCFFData(&desubroutinized); err != nil {
+			t.Fatal(err)
+		}
+
+		if err = cffFontFile.Subroutinize(); err != nil {
+			t.Fatal(err)
+		}
+		var w bytes.Buffer
+		if err = cffFontFile.WriteCFFData(&w); err != nil {
+			t.Fatal(err)
+		}
+		if got, desubroutinized := w.Len(), desubroutinized.Len(); got >= desubroutinized*4/5 {
+			t.Errorf("%s: size = %d, desubroutinized %d", fn, got, desubroutinized)
+		}
+		if cffFontFile, err = ParseCFFData(bytes.NewReader(w.Bytes())); err != nil {
+			t.Fatal(err)
+		}
+		fnt = cffFontFile.Font[0]
+		for gid, cs := range fnt.CharStrings {
+			got, err := desubroutinize(cs, cffFontFile.globalSubrIndex, localSubrs(fnt, gid))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(got, want[gid]) {
+				t.Errorf("%s: glyph %d differs after subroutinization", fn, gid)
+				break
+			}
+		}
+	}
+}
+
+func TestGlyphOutline(t *testing.T) {
+	data, err := os.ReadFile("testdata/firasansthin.cff")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cffFontFile, err := ParseCFFData(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fnt := cffFontFile.Font[0]
+	// glyph 36 is B
+	path, width, err := fnt.GlyphOutline(36)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := width, 587.0; got != want {
+		t.Errorf("width = %v, want %v", got, want)
+	}
+	if got, want := len(path), 19; got != want {
+		t.Fatalf("len(path) = %d, want %d", got, want)
+	}
+	if got, want := path[1], (Segment{Op: CurveTo, Args: [3]Point{{438, 374}, {490, 424}, {490, 513}}}); got != want {
+		t.Errorf("path[1] = %v, want %v", got, want)
+	}
+
+	// The outlines must not change when the subrs change.
+	want := make([]Path, len(fnt.CharStrings))
+	for gid := range fnt.CharStrings {
+		if want[gid], _, err = fnt.GlyphOutline(gid); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = fnt.Desubroutinize(); err != nil {
+		t.Fatal(err)
+	}
+	if err = cffFontFile.Subroutinize(); err != nil {
+		t.Fatal(err)
+	}
+	for gid := range fnt.CharStrings {
+		got, _, err := fnt.GlyphOutline(gid)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fmt.Sprint(got) != fmt.Sprint(want[gid]) {
+			t.Errorf("outline of glyph %d differs after subroutinization", gid)
+			break
+		}
+	}
+}
+
+func TestGlyphOutlineOperators(t *testing.T) {
+	charstring := func(values ...interface{}) []byte {
+		var cs []byte
+		for _, v := range values {
+			switch t := v.(type) {
+			case int:
+				cs = append(cs, encodeType2Number(t)...)
+			case []byte:
+				cs = append(cs, t...)
+			}
+		}
+		return cs
+	}
+	var (
+		rmoveto = []byte{21}
+		rlineto = []byte{5}
+		hlineto = []byte{6}
+		endchar = []byte{14}
+		mul     = []byte{12, 24}
+		add     = []byte{12, 10}
+		hflex   = []byte{12, 34}
+	)
+	fnt := &Font{
+		global:        &CFF{},
+		nominalWidthX: 500,
+		defaultWidthX: 250,
+		// .notdef, A, acute, Aacute (seac), flex
+		charset: []SID{0, 34, 125, 0, 0},
+		CharStrings: [][]byte{
+			charstring(endchar),
+			charstring(10, 0, 0, rmoveto, 100, hlineto, endchar),
+			charstring(50, 50, rmoveto, 10, 20, rlineto, endchar),
+			charstring(20, 100, 65, 194, endchar),
+			charstring(0, 0, rmoveto, 6, 2, 3, mul, add, 10, 20, 10, 10, 10, 12, hflex, endchar),
+		},
+	}
+	testdata := []struct {
+		gid   int
+		width float64
+		path  Path
+	}{
+		{1, 510, Path{{Op: MoveTo}, {Op: LineTo, Args: [3]Point{{100, 0}}}}},
+		{2, 250, Path{{Op: MoveTo, Args: [3]Point{{50, 50}}}, {Op: LineTo, Args: [3]Point{{60, 70}}}}},
+		{3, 250, Path{
+			{Op: MoveTo}, {Op: LineTo, Args: [3]Point{{100, 0}}},
+			{Op: MoveTo, Args: [3]Point{{70, 150}}}, {Op: LineTo, Args: [3]Point{{80, 170}}},
+		}},
+		{4, 250, Path{
+			{Op: MoveTo},
+			{Op: CurveTo, Args: [3]Point{{12, 0}, {22, 20}, {32, 20}}},
+			{Op: CurveTo, Args: [3]Point{{42, 20}, {52, 0}, {64, 0}}},
+		}},
+	}
+	for _, td := range testdata {
+		path, width, err := fnt.GlyphOutline(td.gid)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if width != td.width {
+			t.Errorf("glyph %d: width = %v, want %v", td.gid, width, td.width)
+		}
+		if fmt.Sprint(path) != fmt.Sprint(td.path) {
+			t.Errorf("glyph %d: path = %v, want %v", td.gid, path, td.path)
+		}
+	}
 }
 
 func TestCompareTables(t *testing.T) {
@@ -315,3 +683,203 @@ func TestCompareTablesCustomFont(t *testing.T) {
 		}
 	}
 }
+
+func TestWriteCustomEncoding(t *testing.T) {
+	r, err := os.Open("testdata/customfont.cff")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	cffFontFile, err := ParseCFFData(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	orig := cffFontFile.Font[0]
+	if orig.encodingOffset <= 1 {
+		t.Fatalf("encodingOffset = %d, want a custom encoding", orig.encodingOffset)
+	}
+	charStrings := orig.CharStrings
+	charset := append([]SID{}, orig.charset...)
+
+	var w bytes.Buffer
+	if err = cffFontFile.WriteCFFData(&w); err != nil {
+		t.Fatal(err)
+	}
+	written, err := ParseCFFData(bytes.NewReader(w.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fnt := written.Font[0]
+	if got, want := len(fnt.CharStrings), len(charStrings); got != want {
+		t.Fatalf("len(CharStrings) = %d, want %d", got, want)
+	}
+	for i, cs := range charStrings {
+		if !bytes.Equal(fnt.CharStrings[i], cs) {
+			t.Errorf("CharStrings[%d] = %x, want %x", i, fnt.CharStrings[i], cs)
+		}
+	}
+	for i, sid := range charset {
+		if fnt.charset[i] != sid {
+			t.Errorf("charset[%d] = %d, want %d", i, fnt.charset[i], sid)
+		}
+	}
+
+	// maziusdisplay uses the predefined standard encoding
+	r, err = os.Open("testdata/maziusdisplay.cff")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if _, err = ParseCFFData(r); err != nil {
+		t.Error(err)
+	}
+}
+
+// cidFont converts the name-keyed font into a CID-keyed font with three font
+// DICTs. Glyph 0 uses the first font DICT, the other glyphs alternate between
+// the second and the third.
+func cidFont(c *CFF) *Font {
+	addString := func(str string) SID {
+		c.strings = append(c.strings, str)
+		return SID(len(c.strings) - 1)
+	}
+	fnt := c.Font[0]
+	fnt.registry = addString("Adobe")
+	fnt.ordering = addString("Identity")
+	fnt.fdselect = 1
+	fnt.charsetFormat = 2
+	fnt.fdIndex = make([]uint8, len(fnt.CharStrings))
+	for i := range fnt.CharStrings {
+		fnt.charset[i] = SID(i)
+		if i > 0 {
+			fnt.fdIndex[i] = uint8(i%2 + 1)
+		}
+	}
+	for i := 0; i < 3; i++ {
+		fd := *fnt
+		fd.fdselect = 0
+		fd.fdFonts = nil
+		fd.name = addString(fmt.Sprintf("FD%d", i))
+		fd.fontMatrix = []float64{0.001, 0, 0, 0.001, 0, 0}
+		fd.subrsIndex = make([][]byte, len(fnt.subrsIndex))
+		copy(fd.subrsIndex, fnt.subrsIndex)
+		fnt.fdFonts = append(fnt.fdFonts, &fd)
+	}
+	fnt.privatedictoffset = 0
+	return fnt
+}
+
+func TestCIDFont(t *testing.T) {
+	r, err := os.Open("testdata/maziusdisplay.cff")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	cffFontFile, err := ParseCFFData(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	orig := cidFont(cffFontFile)
+
+	var w bytes.Buffer
+	if err = cffFontFile.WriteCFFData(&w); err != nil {
+		t.Fatal(err)
+	}
+	cffFontFile, err = ParseCFFData(bytes.NewReader(w.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fnt := cffFontFile.Font[0]
+	if !fnt.IsCIDFont() {
+		t.Fatal("IsCIDFont() = false, want true")
+	}
+	if got, want := cffFontFile.strings[fnt.ordering], "Identity"; got != want {
+		t.Errorf("ordering = %q, want %q", got, want)
+	}
+	if registry, ordering, supplement, ok := fnt.ROS(); !ok || registry != "Adobe" || ordering != "Identity" || supplement != 0 {
+		t.Errorf("ROS() = %s, %s, %d, %t, want Adobe, Identity, 0, true", registry, ordering, supplement, ok)
+	}
+	if _, _, _, ok := orig.fdFonts[0].ROS(); ok {
+		t.Errorf("ROS() of a font DICT: ok = true, want false")
+	}
+	if got, want := len(fnt.fdFonts), 3; got != want {
+		t.Fatalf("len(fdFonts) = %d, want %d", got, want)
+	}
+	if got, want := fnt.fdFonts[1].fontMatrix, orig.fdFonts[1].fontMatrix; fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("fontMatrix = %v, want %v", got, want)
+	}
+	if got, want := fnt.fdFonts[2].nominalWidthX, orig.nominalWidthX; got != want {
+		t.Errorf("nominalWidthX = %d, want %d", got, want)
+	}
+	if got, want := len(fnt.fdFonts[2].subrsIndex), len(orig.subrsIndex); got != want {
+		t.Errorf("len(subrsIndex) = %d, want %d", got, want)
+	}
+	if !bytes.Equal(fnt.fdIndex, orig.fdIndex) {
+		t.Errorf("fdIndex differs after writing")
+	}
+	if got, want := fmt.Sprint(fnt.charset), fmt.Sprint(orig.charset); got != want {
+		t.Errorf("charset differs after writing")
+	}
+
+	// glyphs 93 and 115 use the third font DICT, glyph 0 uses the first
+	if err = cffFontFile.Subset([]int{93, 115}); err != nil {
+		t.Fatal(err)
+	}
+	w.Reset()
+	if err = cffFontFile.WriteCFFData(&w); err != nil {
+		t.Fatal(err)
+	}
+	cffFontFile, err = ParseCFFData(bytes.NewReader(w.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fnt = cffFontFile.Font[0]
+	if got, want := len(fnt.fdFonts), 2; got != want {
+		t.Fatalf("len(fdFonts) = %d, want %d", got, want)
+	}
+	if got, want := cffFontFile.strings[fnt.fdFonts[1].name], "FD2"; got != want {
+		t.Errorf("fdFonts[1].name = %q, want %q", got, want)
+	}
+	if got, want := len(fnt.CharStrings), 116; got != want {
+		t.Errorf("len(CharStrings) = %d, want %d", got, want)
+	}
+	for _, gid := range []int{93, 115} {
+		if got, want := fnt.fdIndex[gid], uint8(1); got != want {
+			t.Errorf("fdIndex[%d] = %d, want %d", gid, got, want)
+		}
+		if got, want := fnt.charset[gid], SID(gid); got != want {
+			t.Errorf("charset[%d] = %d, want %d", gid, got, want)
+		}
+		if got, want := fnt.CID(gid), gid; got != want {
+			t.Errorf("CID(%d) = %d, want %d", gid, got, want)
+		}
+	}
+	// only the local subrs of the subset remain
+	fd := fnt.fdFonts[1]
+	usage := newSubrUsage()
+	for _, gid := range []int{93, 115} {
+		if err = usage.getSubrsIndex(fd.nominalWidthX, fd.defaultWidthX, cffFontFile.globalSubrIndex, fd.subrsIndex, fnt.CharStrings[gid], subrOwner{}, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got, want := len(fd.subrsIndex), len(usage.usedLocalSubrs); got != want || got == 0 {
+		t.Errorf("len(subrsIndex) = %d, want %d", got, want)
+	}
+}
+
+func TestPathBounds(t *testing.T) {
+	path := Path{
+		{Op: MoveTo},
+		{Op: CurveTo, Args: [3]Point{{0, 100}, {100, 100}, {100, 0}}},
+		{Op: QuadTo, Args: [3]Point{{50, -100}, {0, 0}}},
+	}
+	if got, want := path.Bounds(), (Rect{Min: Point{0, -50}, Max: Point{100, 75}}); got != want {
+		t.Errorf("Bounds() = %v, want %v", got, want)
+	}
+	if got, want := path.Scale(0.5).Bounds(), (Rect{Min: Point{0, -25}, Max: Point{50, 37.5}}); got != want {
+		t.Errorf("Bounds() of the scaled path = %v, want %v", got, want)
+	}
+	if got, want := (Path{}).Bounds(), (Rect{}); got != want {
+		t.Errorf("Bounds() of an empty path = %v, want %v", got, want)
+	}
+}
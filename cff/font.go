@@ -3,8 +3,9 @@ package cff
 import (
 	"fmt"
 	"io"
-	"math"
 	"sort"
+	"strconv"
+	"strings"
 )
 
 // Top DICT Data - see CFF spec 9 p. 14
@@ -12,6 +13,7 @@ func (f *Font) parseDict(dict []byte) {
 	f.bluefuzz = 1
 	f.blueshift = 7
 	f.bluescale = 0.039625
+	f.expansionFactor = 0.06
 
 	operands := make([]int, 0, 48)
 	operandsf := make([]float64, 0, 48)
@@ -48,26 +50,26 @@ func (f *Font) parseDict(dict []byte) {
 			operands = operands[:0]
 		} else if b0 == 6 {
 			// Blue Values
-			f.bluevalues = make([]int, len(operands))
-			copy(f.bluevalues, operands)
+			f.bluevalues = make([]float64, len(operandsf))
+			copy(f.bluevalues, operandsf)
 			operands = operands[:0]
 		} else if b0 == 7 {
-			f.otherblues = make([]int, len(operands))
-			copy(f.otherblues, operands)
+			f.otherblues = make([]float64, len(operandsf))
+			copy(f.otherblues, operandsf)
 			operands = operands[:0]
 		} else if b0 == 8 {
-			f.familyblues = make([]int, len(operands))
-			copy(f.familyblues, operands)
+			f.familyblues = make([]float64, len(operandsf))
+			copy(f.familyblues, operandsf)
 			operands = operands[:0]
 		} else if b0 == 9 {
-			f.familyotherblues = make([]int, len(operands))
-			copy(f.familyotherblues, operands)
+			f.familyotherblues = make([]float64, len(operandsf))
+			copy(f.familyotherblues, operandsf)
 			operands = operands[:0]
 		} else if b0 == 10 {
-			f.stdhw = operands[0]
+			f.stdhw = operandsf[0]
 			operands = operands[:0]
 		} else if b0 == 11 {
-			f.stdvw = operands[0]
+			f.stdvw = operandsf[0]
 			operands = operands[:0]
 		} else if b0 == 12 {
 			// two bytes
@@ -88,25 +90,34 @@ func (f *Font) parseDict(dict []byte) {
 				} else if len(operandsf) > 0 {
 					f.underlineThickness = operandsf[0]
 				}
+			case 7:
+				f.fontMatrix = make([]float64, len(operandsf))
+				copy(f.fontMatrix, operandsf)
 			case 8:
 				// StrokeWidth
 			case 9:
 				f.bluescale = operandsf[0]
 				operands = operands[:0]
 			case 10:
-				f.blueshift = operands[0]
+				f.blueshift = operandsf[0]
 				operands = operands[:0]
 			case 11:
-				f.bluefuzz = operands[0]
+				f.bluefuzz = operandsf[0]
 				operands = operands[:0]
 			case 12:
-				f.stemsnaph = make([]int, len(operands))
-				copy(f.stemsnaph, operands)
+				f.stemsnaph = make([]float64, len(operandsf))
+				copy(f.stemsnaph, operandsf)
 				operands = operands[:0]
 			case 13:
-				f.stemsnapv = make([]int, len(operands))
-				copy(f.stemsnapv, operands)
+				f.stemsnapv = make([]float64, len(operandsf))
+				copy(f.stemsnapv, operandsf)
 				operands = operands[:0]
+			case 14:
+				f.forceBold = operands[0] != 0
+			case 17:
+				f.languageGroup = operands[0]
+			case 18:
+				f.expansionFactor = operandsf[0]
 			case 19:
 				f.initialRandomSeed = operands[0]
 				operands = operands[:0]
@@ -133,10 +144,8 @@ func (f *Font) parseDict(dict []byte) {
 				f.name = SID(operands[0])
 				operands = operands[:0]
 			default:
-				panic(fmt.Sprintf("not implemented ESC %d", b1))
+				// not needed for subsetting
 			}
-			operands = operands[:0]
-			operandsf = operandsf[:0]
 		} else if b0 == 13 {
 			// unique id
 			f.uniqueid = operands[0]
@@ -169,86 +178,71 @@ func (f *Font) parseDict(dict []byte) {
 			b1 := dict[pos+1]
 			b2 := dict[pos+2]
 			pos += 2
-			val := int(b1)<<8 | int(b2)
+			val := int(int16(b1)<<8 | int16(b2))
 			operands = append(operands, val)
+			operandsf = append(operandsf, float64(val))
 		} else if b0 == 29 {
 			b1 := dict[pos+1]
 			b2 := dict[pos+2]
 			b3 := dict[pos+3]
 			b4 := dict[pos+4]
 			pos += 4
-			val := int(b1)<<24 | int(b2)<<16 | int(b3)<<8 | int(b4)
+			val := int(int32(b1)<<24 | int32(b2)<<16 | int32(b3)<<8 | int32(b4))
 			operands = append(operands, val)
+			operandsf = append(operandsf, float64(val))
 		} else if b0 == 30 {
-			// float
-			valbefore := 0
-			valafter := 0
-			digitsafter := 0
-			mode := "before"
-			shift := 1
+			// real number, two nibbles per byte
+			var num strings.Builder
 		parsefloat:
 			for {
-				b1 := dict[pos+1]
 				pos++
-				n1, n2 := b1>>4, b1&0xf
-				nibble := n1
-				firstnibble := true
-				for {
-					if nibble == 0xf {
+				b1 := dict[pos]
+				for _, nibble := range []byte{b1 >> 4, b1 & 0xf} {
+					switch {
+					case nibble <= 9:
+						num.WriteByte('0' + nibble)
+					case nibble == 0xa:
+						num.WriteByte('.')
+					case nibble == 0xb:
+						num.WriteString("E")
+					case nibble == 0xc:
+						num.WriteString("E-")
+					case nibble == 0xe:
+						num.WriteByte('-')
+					case nibble == 0xf:
 						break parsefloat
-					} else if nibble >= 0 && nibble <= 9 {
-						if mode == "before" {
-							valbefore = 10*valbefore + int(nibble)
-						} else if mode == "after" {
-							valafter = 10*valafter + int(nibble)
-							digitsafter++
-						} else if mode == "E-" {
-							shift = int(nibble) * -1
-						} else if mode == "E" {
-							shift = int(nibble)
-						}
-					} else if nibble == 0xa {
-						mode = "after"
-					} else if nibble == 0xb {
-						mode = "E"
-					} else if nibble == 0xc {
-						mode = "E-"
-					} else if nibble == 0xe {
-						valbefore = valbefore * -1
-					}
-					if firstnibble {
-						nibble = n2
-						firstnibble = false
-					} else {
-						break
 					}
 				}
 			}
-			div := 1
-			for i := 0; i < digitsafter; i++ {
-				div *= 10
-			}
-			var flt = float64(valbefore)
-			flt += (float64(valafter) / float64(div))
-			flt = math.Pow(flt, float64(shift))
+			flt, _ := strconv.ParseFloat(num.String(), 64)
 			operandsf = append(operandsf, flt)
 		} else if b0 >= 32 && b0 <= 246 {
 			val := int(b0) - 139
 			operands = append(operands, val)
+			operandsf = append(operandsf, float64(val))
 		} else if b0 >= 247 && b0 <= 250 {
 			b1 := dict[pos+1]
 			pos++
 			val := (int(b0)-247)*256 + int(b1) + 108
 			operands = append(operands, val)
+			operandsf = append(operandsf, float64(val))
 		} else if b0 >= 251 && b0 <= 254 {
 			b1 := dict[pos+1]
 			pos++
 			val := -(int(b0)-251)*256 - int(b1) - 108
 			operands = append(operands, val)
+			operandsf = append(operandsf, float64(val))
+		} else if b0 <= 21 {
+			// operators that are not needed for subsetting (for example XUID)
 		} else {
 			fmt.Println("b0", b0)
 			panic("not implemented yet")
 		}
+		if b0 <= 21 {
+			// an operator consumes all operands
+			operands = operands[:0]
+			operandsf = operandsf[:0]
+		}
 	}
 }
 
@@ -325,28 +319,33 @@ func (f *Font) readCharset(r io.ReadSeeker) error {
 	read(r, &f.charsetFormat)
 	switch f.charsetFormat {
 	case 0:
-		if f.IsCIDFont() && false {
-			panic("niy")
-		} else {
-			var sid uint16
-			for i := 1; i < numGlyphs; i++ {
-				read(r, &sid)
-				f.charset[i] = SID(sid)
-			}
+		// for CID fonts the charset contains CIDs instead of SIDs
+		var sid uint16
+		for i := 1; i < numGlyphs; i++ {
+			read(r, &sid)
+			f.charset[i] = SID(sid)
 		}
-	case 1:
+	case 1, 2:
 		// .notdef is always 0 and not in the charset
 		glyphsleft := numGlyphs - 1
 
 		var sid uint16
-		var nleft byte
+		var nleft int
 		c := 1
 		for {
 			glyphsleft--
 			read(r, &sid)
-			read(r, &nleft)
-			glyphsleft = glyphsleft - int(nleft)
-			for i := 0; i <= int(nleft); i++ {
+			if f.charsetFormat == 1 {
+				var nleft8 uint8
+				read(r, &nleft8)
+				nleft = int(nleft8)
+			} else {
+				var nleft16 uint16
+				read(r, &nleft16)
+				nleft = int(nleft16)
+			}
+			glyphsleft = glyphsleft - nleft
+			for i := 0; i <= nleft && c < numGlyphs; i++ {
 				f.charset[c] = SID(int(sid) + i)
 				c++
 			}
@@ -360,6 +359,70 @@ func (f *Font) readCharset(r io.ReadSeeker) error {
 	return nil
 }
 
+// readFDSelect reads the font DICT index of each glyph of a CID-keyed font.
+func (f *Font) readFDSelect(r io.ReadSeeker) error {
+	if _, err := r.Seek(f.fdselect, io.SeekStart); err != nil {
+		return err
+	}
+	numGlyphs := len(f.CharStrings)
+	if numGlyphs == 0 {
+		return fmt.Errorf("char strings table needs to be parsed before FDSelect")
+	}
+	f.fdIndex = make([]uint8, numGlyphs)
+	var format uint8
+	read(r, &format)
+	switch format {
+	case 0:
+		if err := read(r, f.fdIndex); err != nil {
+			return err
+		}
+	case 3:
+		var nRanges, first, sentinel uint16
+		var fd uint8
+		read(r, &nRanges)
+		read(r, &first)
+		for i := 0; i < int(nRanges); i++ {
+			read(r, &fd)
+			if err := read(r, &sentinel); err != nil {
+				return err
+			}
+			for gid := int(first); gid < int(sentinel) && gid < numGlyphs; gid++ {
+				f.fdIndex[gid] = fd
+			}
+			first = sentinel
+		}
+	default:
+		return fmt.Errorf("FDSelect format %d not supported", format)
+	}
+	return nil
+}
+
+// readFDArray reads the font DICTs of a CID-keyed font together with their
+// private DICTs and local subrs.
+func (f *Font) readFDArray(r io.ReadSeeker) error {
+	if _, err := r.Seek(f.fdarray, io.SeekStart); err != nil {
+		return err
+	}
+	f.fdFonts = []*Font{}
+	for _, dict := range cffReadIndexData(r, "FDArray") {
+		fd := &Font{}
+		fd.parseDict(dict)
+		if err := fd.readPrivateDict(r); err != nil {
+			return err
+		}
+		if err := fd.readSubrIndex(r); err != nil {
+			return err
+		}
+		f.fdFonts = append(f.fdFonts, fd)
+	}
+	for _, fd := range f.fdIndex {
+		if int(fd) >= len(f.fdFonts) {
+			return fmt.Errorf("FDSelect refers to font DICT %d, FDArray has %d entries", fd, len(f.fdFonts))
+		}
+	}
+	return nil
+}
+
 func (f *Font) readPrivateDict(r io.ReadSeeker) error {
 	if _, err := r.Seek(f.privatedictoffset, io.SeekStart); err != nil {
 		return err
@@ -460,21 +523,115 @@ func (f *Font) parseIndex(r io.ReadSeeker, index mainIndex) error {
 	return nil
 }
 
+// Desubroutinize replaces all subr calls in the charstrings by the called
+// subrs and removes the local subrs. The global subrs are removed once all
+// fonts of the CFF data are desubroutinized.
+func (f *Font) Desubroutinize() error {
+	if f.global == nil {
+		return fmt.Errorf("font is not part of CFF data")
+	}
+	globalSubrs := f.global.globalSubrIndex
+	charStrings := make([][]byte, len(f.CharStrings))
+	for gid, cs := range f.CharStrings {
+		localSubrs := f.subrsIndex
+		if f.IsCIDFont() {
+			localSubrs = f.fdFonts[f.fdIndex[gid]].subrsIndex
+		}
+		var err error
+		if charStrings[gid], err = desubroutinize(cs, globalSubrs, localSubrs); err != nil {
+			return fmt.Errorf("glyph %d: %s", gid, err)
+		}
+	}
+	f.CharStrings = charStrings
+	f.subrsIndex = nil
+	for _, fd := range f.fdFonts {
+		fd.subrsIndex = nil
+	}
+	f.desubroutinized = true
+	for _, fnt := range f.global.Font {
+		if !fnt.desubroutinized {
+			return nil
+		}
+	}
+	f.global.globalSubrIndex = nil
+	return nil
+}
+
 // IsCIDFont returns true if the character encoding is based on CID instead of SID
 func (f *Font) IsCIDFont() bool {
 	return f.fdselect != 0
 }
 
+// CID returns the CID of the glyph for CID-keyed fonts and the glyph id for
+// other fonts.
+func (f *Font) CID(gid int) int {
+	if f.IsCIDFont() && gid >= 0 && gid < len(f.charset) {
+		return int(f.charset[gid])
+	}
+	return gid
+}
+
+// ROS returns the registry, ordering and supplement of a CID-keyed font. ok
+// is false for name-keyed fonts.
+func (f *Font) ROS() (registry, ordering string, supplement int, ok bool) {
+	if !f.IsCIDFont() || f.global == nil {
+		return "", "", 0, false
+	}
+	str := func(sid SID) string {
+		if int(sid) < len(f.global.strings) {
+			return f.global.strings[sid]
+		}
+		return ""
+	}
+	return str(f.registry), str(f.ordering), f.supplement, true
+}
+
+// FontBBox returns the FontBBox entry of the top dict (xMin, yMin, xMax, yMax)
+// in font units.
+func (f *Font) FontBBox() [4]int {
+	var bbox [4]int
+	copy(bbox[:], f.bbox)
+	return bbox
+}
+
+// privateDict returns the font with the private dict. For CID fonts this is
+// the first font dict.
+func (f *Font) privateDict() *Font {
+	if f.IsCIDFont() && len(f.fdFonts) > 0 {
+		return f.fdFonts[0]
+	}
+	return f
+}
+
+// StdVW returns the dominant vertical stem width from the private dict or 0
+// if the font has no StdVW entry.
+func (f *Font) StdVW() float64 {
+	return f.privateDict().stdvw
+}
+
+// ForceBold returns the ForceBold entry of the private dict.
+func (f *Font) ForceBold() bool {
+	return f.privateDict().forceBold
+}
+
 // Subset changes the font so that only the given code points remain in the font. Subset must only be called once.
-func (f *Font) Subset(globalSubr [][]byte, codepoints []int) {
+// The unused subrs are removed and Subset returns the new global subrs.
+func (f *Font) Subset(globalSubr [][]byte, codepoints []int) ([][]byte, error) {
 	sort.Ints(codepoints)
+	// glyph 0 is never removed, so its subrs must be kept as well
+	if codepoints[0] != 0 {
+		codepoints = append([]int{0}, codepoints...)
+	}
 	cpIdx := 0
 	charstringsIdx := 0
 	for {
 		cp := codepoints[cpIdx]
 		for j := 1; j+charstringsIdx < cp; j++ {
 			f.CharStrings[j+charstringsIdx] = []byte{0xe}
-			f.charset[j+charstringsIdx] = 0
+			// CIDs must stay unique, so they are kept for removed glyphs
+			if !f.IsCIDFont() {
+				f.charset[j+charstringsIdx] = 0
+			}
 		}
 		cpIdx++
 		charstringsIdx = cp
@@ -487,16 +644,150 @@ func (f *Font) Subset(globalSubr [][]byte, codepoints []int) {
 	f.CharStrings = f.CharStrings[:lastcp+1]
 	f.charset = f.charset[:lastcp+1]
 
-	usedGlobalSubrsMap = make(map[int]bool)
-	usedLocalSubrsMap = make(map[int]bool)
+	// fonts with local subrs: the font itself or the font DICTs of a CID-keyed font
+	localSubrFonts := []*Font{f}
+	if f.IsCIDFont() {
+		f.fdIndex = f.fdIndex[:len(f.CharStrings)]
+		localSubrFonts = f.fdFonts
+	}
+	usedLocalSubrs := make([]map[int]bool, len(localSubrFonts))
+	for i := range usedLocalSubrs {
+		usedLocalSubrs[i] = make(map[int]bool)
+	}
+	usage := newSubrUsage()
+	for _, cp := range codepoints {
+		fd := 0
+		if f.IsCIDFont() {
+			fd = int(f.fdIndex[cp])
+		}
+		lf := localSubrFonts[fd]
+		usage.usedLocalSubrs = usedLocalSubrs[fd]
+		if err := usage.getSubrsIndex(lf.nominalWidthX, lf.defaultWidthX, globalSubr, lf.subrsIndex, f.CharStrings[cp], subrOwner{'c', fd, cp}, nil); err != nil {
+			return nil, fmt.Errorf("glyph %d: %w", cp, err)
+		}
+	}
+	globalSubr = f.renumberSubrs(globalSubr, localSubrFonts, usage.usedGlobalSubrs, usedLocalSubrs, usage.calls)
+
+	if f.IsCIDFont() {
+		f.subsetFDs(codepoints)
+	}
+	return globalSubr, nil
+}
+
+// renumberSubrs removes the unused global and local subrs and rewrites the
+// subr calls in the charstrings and subrs recorded in subrCalls. It returns
+// the new global subrs. If the subr calls cannot be rewritten, the unused subrs
+// are cleared instead and the subrs keep their numbers.
+func (f *Font) renumberSubrs(globalSubr [][]byte, localSubrFonts []*Font, usedGlobalSubrs map[int]bool, usedLocalSubrs []map[int]bool, subrCalls map[subrOwner][]subrCall) [][]byte {
+	// A global subr that calls local subrs uses the local subrs of the font
+	// DICT of the calling charstring. If it is called from several font DICTs,
+	// the local subr numbers cannot be rewritten consistently.
+	localSubrsFD := make(map[int]int)
+	for owner, calls := range subrCalls {
+		for _, call := range calls {
+			conflict := false
+			if owner.kind == 'g' && !call.global {
+				if fd, ok := localSubrsFD[owner.index]; ok && fd != owner.fd {
+					conflict = true
+				}
+				localSubrsFD[owner.index] = owner.fd
+			}
+			if call.start < 0 || conflict {
+				clearSubr(globalSubr, usedGlobalSubrs)
+				for i, lf := range localSubrFonts {
+					clearSubr(lf.subrsIndex, usedLocalSubrs[i])
+				}
+				return globalSubr
+			}
+		}
+	}
+
+	newGlobalSubr, globalMapping := keepSubrs(globalSubr, usedGlobalSubrs)
+	globalBias := calculateBias(newGlobalSubr)
+	newLocalSubrs := make([][][]byte, len(localSubrFonts))
+	localMappings := make([]map[int]int, len(localSubrFonts))
+	for i, lf := range localSubrFonts {
+		newLocalSubrs[i], localMappings[i] = keepSubrs(lf.subrsIndex, usedLocalSubrs[i])
+	}
+
+	rewrite := func(cs []byte, calls []subrCall, fd int) []byte {
+		var b []byte
+		pos := 0
+		for _, call := range calls {
+			b = append(b, cs[pos:call.start]...)
+			if call.global {
+				b = append(b, encodeType2Number(globalMapping[call.index]-globalBias)...)
+			} else {
+				b = append(b, encodeType2Number(localMappings[fd][call.index]-calculateBias(newLocalSubrs[fd]))...)
+			}
+			pos = call.end
+		}
+		return append(b, cs[pos:]...)
+	}
 
+	for owner, calls := range subrCalls {
+		if len(calls) == 0 {
+			continue
+		}
+		switch owner.kind {
+		case 'c':
+			f.CharStrings[owner.index] = rewrite(f.CharStrings[owner.index], calls, owner.fd)
+		case 'l':
+			newLocalSubrs[owner.fd][localMappings[owner.fd][owner.index]] = rewrite(localSubrFonts[owner.fd].subrsIndex[owner.index], calls, owner.fd)
+		case 'g':
+			newGlobalSubr[globalMapping[owner.index]] = rewrite(globalSubr[owner.index], calls, owner.fd)
+		}
+	}
+	for i, lf := range localSubrFonts {
+		lf.subrsIndex = newLocalSubrs[i]
+	}
+	return newGlobalSubr
+}
+
+// keepSubrs returns the used subrs and the mapping from the old to the new
+// subr numbers.
+func keepSubrs(subrs [][]byte, usedSubrs map[int]bool) ([][]byte, map[int]int) {
+	var newSubrs [][]byte
+	mapping := make(map[int]int, len(usedSubrs))
+	for i, subr := range subrs {
+		if usedSubrs[i] {
+			mapping[i] = len(newSubrs)
+			newSubrs = append(newSubrs, subr)
+		}
+	}
+	return newSubrs, mapping
+}
+
+// subsetFDs removes the font DICTs of a CID-keyed font that are not used by
+// the glyphs of the subset. The code points must be sorted.
+func (f *Font) subsetFDs(codepoints []int) {
+	usedFDs := make([]bool, len(f.fdFonts))
 	for _, cp := range codepoints {
-		cs := f.CharStrings[cp]
-		getSubrsIndex(f.nominalWidthX, f.defaultWidthX, globalSubr, f.subrsIndex, cs, nil)
+		usedFDs[f.fdIndex[cp]] = true
 	}
 
-	clearSubr(globalSubr, usedGlobalSubrsMap)
-	clearSubr(f.subrsIndex, usedLocalSubrsMap)
+	newFDIndex := make([]int, len(f.fdFonts))
+	fdFonts := []*Font{}
+	for i, fd := range f.fdFonts {
+		if !usedFDs[i] {
+			continue
+		}
+		newFDIndex[i] = len(fdFonts)
+		fdFonts = append(fdFonts, fd)
+	}
+	f.fdFonts = fdFonts
+
+	// Removed glyphs get the font DICT of the previous glyph, which keeps the
+	// FDSelect ranges small. Glyph 0 is always in the subset.
+	cpIdx := 0
+	var fd uint8
+	for gid := range f.fdIndex {
+		for cpIdx < len(codepoints) && codepoints[cpIdx] == gid {
+			fd = uint8(newFDIndex[f.fdIndex[gid]])
+			cpIdx++
+		}
+		f.fdIndex[gid] = fd
+	}
 }
 
 func clearSubr(subr [][]byte, usedSubrs map[int]bool) {
@@ -525,7 +816,4 @@ func clearSubr(subr [][]byte, usedSubrs map[int]bool) {
 			break
 		}
 	}
-	lastidx := usedSubrSlice[len(usedSubrSlice)-1]
-	subr = subr[:lastidx+1]
-
 }
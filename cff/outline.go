@@ -0,0 +1,781 @@
+package cff
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+)
+
+// SegmentOp is the kind of a path segment.
+type SegmentOp int
+
+// Path segment kinds. CFF outlines only use MoveTo, LineTo and CurveTo,
+// QuadTo is used for TrueType outlines.
+const (
+	MoveTo SegmentOp = iota
+	LineTo
+	QuadTo
+	CurveTo
+)
+
+func (op SegmentOp) String() string {
+	switch op {
+	case MoveTo:
+		return "MoveTo"
+	case LineTo:
+		return "LineTo"
+	case QuadTo:
+		return "QuadTo"
+	case CurveTo:
+		return "CurveTo"
+	}
+	return fmt.Sprintf("SegmentOp(%d)", int(op))
+}
+
+// Point is a point in font units.
+type Point struct {
+	X float64
+	Y float64
+}
+
+// Segment is a part of a glyph outline. MoveTo and LineTo use Args[0] as
+// the end point. QuadTo uses Args[0] as the control point and Args[1] as the
+// end point. CurveTo uses Args[0] and Args[1] as the control points and
+// Args[2] as the end point.
+type Segment struct {
+	Op   SegmentOp
+	Args [3]Point
+}
+
+// numPoints returns the number of points used by the segment.
+func (s Segment) numPoints() int {
+	switch s.Op {
+	case QuadTo:
+		return 2
+	case CurveTo:
+		return 3
+	}
+	return 1
+}
+
+// Path is a glyph outline. Each MoveTo starts a new contour, all contours
+// are closed.
+type Path []Segment
+
+// Rect is a rectangle in font units.
+type Rect struct {
+	Min Point
+	Max Point
+}
+
+func (r *Rect) add(p Point) {
+	r.Min.X = math.Min(r.Min.X, p.X)
+	r.Min.Y = math.Min(r.Min.Y, p.Y)
+	r.Max.X = math.Max(r.Max.X, p.X)
+	r.Max.Y = math.Max(r.Max.Y, p.Y)
+}
+
+// Bounds returns the exact bounding box of the path. Unlike the bounding box
+// of the points it only includes the extrema of the curves, not the control
+// points. The bounding box of an empty path is the zero rectangle.
+func (p Path) Bounds() Rect {
+	if len(p) == 0 {
+		return Rect{}
+	}
+	r := Rect{Min: p[0].Args[0], Max: p[0].Args[0]}
+	var cur Point
+	for _, seg := range p {
+		switch seg.Op {
+		case MoveTo, LineTo:
+			cur = seg.Args[0]
+		case QuadTo:
+			c, end := seg.Args[0], seg.Args[1]
+			for _, t := range quadExtrema(cur.X, c.X, end.X) {
+				r.add(quadPoint(cur, c, end, t))
+			}
+			for _, t := range quadExtrema(cur.Y, c.Y, end.Y) {
+				r.add(quadPoint(cur, c, end, t))
+			}
+			cur = end
+		case CurveTo:
+			c1, c2, end := seg.Args[0], seg.Args[1], seg.Args[2]
+			for _, t := range cubicExtrema(cur.X, c1.X, c2.X, end.X) {
+				r.add(cubicPoint(cur, c1, c2, end, t))
+			}
+			for _, t := range cubicExtrema(cur.Y, c1.Y, c2.Y, end.Y) {
+				r.add(cubicPoint(cur, c1, c2, end, t))
+			}
+			cur = end
+		}
+		r.add(cur)
+	}
+	return r
+}
+
+// quadExtrema returns the parameter of the extremum of a quadratic Bézier
+// curve in one dimension if it is inside the curve.
+func quadExtrema(p0, p1, p2 float64) []float64 {
+	d := p0 - 2*p1 + p2
+	if d == 0 {
+		return nil
+	}
+	if t := (p0 - p1) / d; t > 0 && t < 1 {
+		return []float64{t}
+	}
+	return nil
+}
+
+// cubicExtrema returns the parameters of the extrema of a cubic Bézier curve
+// in one dimension that are inside the curve.
+func cubicExtrema(p0, p1, p2, p3 float64) []float64 {
+	// the derivative is a*t² + b*t + c
+	a := 3 * (-p0 + 3*p1 - 3*p2 + p3)
+	b := 6 * (p0 - 2*p1 + p2)
+	c := 3 * (p1 - p0)
+	var roots []float64
+	if math.Abs(a) < 1e-12 {
+		if b != 0 {
+			roots = append(roots, -c/b)
+		}
+	} else if disc := b*b - 4*a*c; disc >= 0 {
+		sq := math.Sqrt(disc)
+		roots = append(roots, (-b+sq)/(2*a), (-b-sq)/(2*a))
+	}
+	var ret []float64
+	for _, t := range roots {
+		if t > 0 && t < 1 {
+			ret = append(ret, t)
+		}
+	}
+	return ret
+}
+
+func quadPoint(p0, p1, p2 Point, t float64) Point {
+	mt := 1 - t
+	return Point{
+		X: mt*mt*p0.X + 2*mt*t*p1.X + t*t*p2.X,
+		Y: mt*mt*p0.Y + 2*mt*t*p1.Y + t*t*p2.Y,
+	}
+}
+
+func cubicPoint(p0, p1, p2, p3 Point, t float64) Point {
+	mt := 1 - t
+	return Point{
+		X: mt*mt*mt*p0.X + 3*mt*mt*t*p1.X + 3*mt*t*t*p2.X + t*t*t*p3.X,
+		Y: mt*mt*mt*p0.Y + 3*mt*mt*t*p1.Y + 3*mt*t*t*p2.Y + t*t*t*p3.Y,
+	}
+}
+
+// Scale returns a copy of the path with all coordinates multiplied by
+// factor. To get the outline for a font size use size / units per em as the
+// factor.
+func (p Path) Scale(factor float64) Path {
+	ret := make(Path, len(p))
+	for i, seg := range p {
+		for j := 0; j < seg.numPoints(); j++ {
+			seg.Args[j].X *= factor
+			seg.Args[j].Y *= factor
+		}
+		ret[i] = seg
+	}
+	return ret
+}
+
+// standardEncoding maps the character codes of the standard encoding to
+// SIDs. It is used for the accented characters built with endchar (seac).
+var standardEncoding = func() [256]SID {
+	var enc [256]SID
+	sid := SID(1)
+	for _, r := range [][2]int{
+		{32, 126}, {161, 175}, {177, 180}, {182, 189}, {191, 191}, {193, 200},
+		{202, 203}, {205, 208}, {225, 225}, {227, 227}, {232, 235}, {241, 241},
+		{245, 245}, {248, 251},
+	} {
+		for code := r[0]; code <= r[1]; code++ {
+			enc[code] = sid
+			sid++
+		}
+	}
+	return enc
+}()
+
+// type2interpreter executes Type 2 charstrings.
+type type2interpreter struct {
+	globalSubrs   [][]byte
+	localSubrs    [][]byte
+	nominalWidthX int
+	defaultWidthX int
+	stack         []float64
+	transient     [32]float64
+	nStems        int
+	seenWidth     bool
+	width         float64
+	x, y          float64
+	path          Path
+	endchar       bool
+	// accent is set if endchar builds an accented character (seac)
+	accent *seac
+}
+
+type seac struct {
+	adx, ady     float64
+	bchar, achar int
+}
+
+// GlyphOutline returns the outline and the advance width of the glyph gid
+// by executing its charstring. The coordinates are in font units.
+func (f *Font) GlyphOutline(gid int) (Path, float64, error) {
+	if gid < 0 || gid >= len(f.CharStrings) {
+		return nil, 0, fmt.Errorf("glyph %d does not exist", gid)
+	}
+	ip := f.newInterpreter(gid)
+	if err := ip.run(f.CharStrings[gid], 0); err != nil {
+		return nil, 0, fmt.Errorf("glyph %d: %s", gid, err)
+	}
+	if !ip.seenWidth {
+		ip.width = float64(ip.defaultWidthX)
+	}
+	if ip.accent != nil {
+		path, err := f.seacPath(ip.accent)
+		if err != nil {
+			return nil, 0, fmt.Errorf("glyph %d: %s", gid, err)
+		}
+		ip.path = path
+	}
+	return ip.path, ip.width, nil
+}
+
+func (f *Font) newInterpreter(gid int) *type2interpreter {
+	ip := &type2interpreter{
+		localSubrs:    f.subrsIndex,
+		nominalWidthX: f.nominalWidthX,
+		defaultWidthX: f.defaultWidthX,
+		stack:         make([]float64, 0, maxStack),
+	}
+	if f.global != nil {
+		ip.globalSubrs = f.global.globalSubrIndex
+	}
+	if f.IsCIDFont() && gid < len(f.fdIndex) && int(f.fdIndex[gid]) < len(f.fdFonts) {
+		fd := f.fdFonts[f.fdIndex[gid]]
+		ip.localSubrs = fd.subrsIndex
+		ip.nominalWidthX = fd.nominalWidthX
+		ip.defaultWidthX = fd.defaultWidthX
+	}
+	return ip
+}
+
+// seacPath returns the outline of an accented character built from the base
+// and the accent character of the standard encoding.
+func (f *Font) seacPath(s *seac) (Path, error) {
+	if f.IsCIDFont() {
+		return nil, fmt.Errorf("endchar with accent in a CID-keyed font")
+	}
+	glyph := func(code int) (int, error) {
+		if code < 0 || code > 255 || standardEncoding[code] == 0 {
+			return 0, fmt.Errorf("endchar: invalid character code %d", code)
+		}
+		for gid, sid := range f.charset {
+			if sid == standardEncoding[code] {
+				return gid, nil
+			}
+		}
+		return 0, fmt.Errorf("endchar: no glyph for character code %d", code)
+	}
+	var path Path
+	for i, code := range []int{s.bchar, s.achar} {
+		gid, err := glyph(code)
+		if err != nil {
+			return nil, err
+		}
+		ip := f.newInterpreter(gid)
+		if err = ip.run(f.CharStrings[gid], 0); err != nil {
+			return nil, err
+		}
+		if ip.accent != nil {
+			return nil, fmt.Errorf("endchar: nested accented characters")
+		}
+		for _, seg := range ip.path {
+			if i == 1 {
+				for j := 0; j < seg.numPoints(); j++ {
+					seg.Args[j].X += s.adx
+					seg.Args[j].Y += s.ady
+				}
+			}
+			path = append(path, seg)
+		}
+	}
+	return path, nil
+}
+
+func (ip *type2interpreter) push(v float64) error {
+	if len(ip.stack) >= maxStack {
+		return fmt.Errorf("stack overflow")
+	}
+	ip.stack = append(ip.stack, v)
+	return nil
+}
+
+func (ip *type2interpreter) pop() (float64, error) {
+	if len(ip.stack) == 0 {
+		return 0, fmt.Errorf("stack underflow")
+	}
+	v := ip.stack[len(ip.stack)-1]
+	ip.stack = ip.stack[:len(ip.stack)-1]
+	return v, nil
+}
+
+// parseWidth removes the width from the stack if this is the first stack
+// clearing operator and the number of arguments shows that there is a width.
+func (ip *type2interpreter) parseWidth(hasWidth bool) {
+	if ip.seenWidth {
+		return
+	}
+	ip.seenWidth = true
+	ip.width = float64(ip.defaultWidthX)
+	if hasWidth && len(ip.stack) > 0 {
+		ip.width = float64(ip.nominalWidthX) + ip.stack[0]
+		ip.stack = ip.stack[1:]
+	}
+}
+
+func (ip *type2interpreter) moveTo(dx, dy float64) {
+	ip.x += dx
+	ip.y += dy
+	ip.path = append(ip.path, Segment{Op: MoveTo, Args: [3]Point{{ip.x, ip.y}}})
+}
+
+func (ip *type2interpreter) lineTo(dx, dy float64) {
+	ip.x += dx
+	ip.y += dy
+	ip.path = append(ip.path, Segment{Op: LineTo, Args: [3]Point{{ip.x, ip.y}}})
+}
+
+func (ip *type2interpreter) curveTo(dxa, dya, dxb, dyb, dxc, dyc float64) {
+	xa, ya := ip.x+dxa, ip.y+dya
+	xb, yb := xa+dxb, ya+dyb
+	ip.x, ip.y = xb+dxc, yb+dyc
+	ip.path = append(ip.path, Segment{Op: CurveTo, Args: [3]Point{{xa, ya}, {xb, yb}, {ip.x, ip.y}}})
+}
+
+// alternatingLines draws the lines of hlineto and vlineto.
+func (ip *type2interpreter) alternatingLines(horizontal bool) {
+	for _, d := range ip.stack {
+		if horizontal {
+			ip.lineTo(d, 0)
+		} else {
+			ip.lineTo(0, d)
+		}
+		horizontal = !horizontal
+	}
+}
+
+// alternatingCurves draws the curves of hvcurveto and vhcurveto.
+func (ip *type2interpreter) alternatingCurves(horizontal bool) error {
+	args := ip.stack
+	if len(args) < 4 {
+		return fmt.Errorf("not enough arguments for curve")
+	}
+	for len(args) >= 4 {
+		last := 0.0
+		if len(args) == 5 {
+			last = args[4]
+		}
+		if horizontal {
+			ip.curveTo(args[0], 0, args[1], args[2], last, args[3])
+		} else {
+			ip.curveTo(0, args[0], args[1], args[2], args[3], last)
+		}
+		args = args[4:]
+		if len(args) == 1 {
+			args = args[1:]
+		}
+		horizontal = !horizontal
+	}
+	return nil
+}
+
+// run executes the charstring cs. depth is the subr nesting depth.
+func (ip *type2interpreter) run(cs []byte, depth int) error {
+	if depth > 10 {
+		return fmt.Errorf("subrs nested too deep")
+	}
+	pos := 0
+	for pos < len(cs) {
+		b0 := cs[pos]
+		pos++
+		switch {
+		case b0 == 28:
+			if pos+2 > len(cs) {
+				return fmt.Errorf("charstring ends within a number")
+			}
+			if err := ip.push(float64(int16(cs[pos])<<8 | int16(cs[pos+1]))); err != nil {
+				return err
+			}
+			pos += 2
+			continue
+		case b0 >= 32 && b0 <= 246:
+			if err := ip.push(float64(int(b0) - 139)); err != nil {
+				return err
+			}
+			continue
+		case b0 >= 247 && b0 <= 254:
+			if pos >= len(cs) {
+				return fmt.Errorf("charstring ends within a number")
+			}
+			v := (int(b0)-247)*256 + int(cs[pos]) + 108
+			if b0 >= 251 {
+				v = -(int(b0)-251)*256 - int(cs[pos]) - 108
+			}
+			if err := ip.push(float64(v)); err != nil {
+				return err
+			}
+			pos++
+			continue
+		case b0 == 255:
+			if pos+4 > len(cs) {
+				return fmt.Errorf("charstring ends within a number")
+			}
+			v := int32(cs[pos])<<24 | int32(cs[pos+1])<<16 | int32(cs[pos+2])<<8 | int32(cs[pos+3])
+			if err := ip.push(float64(v) / 65536); err != nil {
+				return err
+			}
+			pos += 4
+			continue
+		}
+
+		args := ip.stack
+		switch b0 {
+		case 1, 3, 18, 23:
+			// hstem, vstem, hstemhm, vstemhm
+			ip.parseWidth(len(ip.stack)%2 == 1)
+			ip.nStems += len(ip.stack) / 2
+		case 19, 20:
+			// hintmask, cntrmask: the arguments are vstem values
+			ip.parseWidth(len(ip.stack)%2 == 1)
+			ip.nStems += len(ip.stack) / 2
+			pos += (ip.nStems + 7) / 8
+			if pos > len(cs) {
+				return fmt.Errorf("charstring ends within a hint mask")
+			}
+		case 21:
+			// rmoveto
+			ip.parseWidth(len(ip.stack) > 2)
+			if len(ip.stack) < 2 {
+				return fmt.Errorf("rmoveto: not enough arguments")
+			}
+			ip.moveTo(ip.stack[0], ip.stack[1])
+		case 22, 4:
+			// hmoveto, vmoveto
+			ip.parseWidth(len(ip.stack) > 1)
+			if len(ip.stack) < 1 {
+				return fmt.Errorf("moveto: not enough arguments")
+			}
+			if b0 == 22 {
+				ip.moveTo(ip.stack[0], 0)
+			} else {
+				ip.moveTo(0, ip.stack[0])
+			}
+		case 5:
+			// rlineto
+			for ; len(args) >= 2; args = args[2:] {
+				ip.lineTo(args[0], args[1])
+			}
+		case 6, 7:
+			// hlineto, vlineto
+			ip.alternatingLines(b0 == 6)
+		case 8:
+			// rrcurveto
+			for ; len(args) >= 6; args = args[6:] {
+				ip.curveTo(args[0], args[1], args[2], args[3], args[4], args[5])
+			}
+		case 24:
+			// rcurveline
+			for ; len(args) >= 8; args = args[6:] {
+				ip.curveTo(args[0], args[1], args[2], args[3], args[4], args[5])
+			}
+			if len(args) < 2 {
+				return fmt.Errorf("rcurveline: not enough arguments")
+			}
+			ip.lineTo(args[0], args[1])
+		case 25:
+			// rlinecurve
+			for ; len(args) >= 8; args = args[2:] {
+				ip.lineTo(args[0], args[1])
+			}
+			if len(args) < 6 {
+				return fmt.Errorf("rlinecurve: not enough arguments")
+			}
+			ip.curveTo(args[0], args[1], args[2], args[3], args[4], args[5])
+		case 26:
+			// vvcurveto
+			dx1 := 0.0
+			if len(args)%2 == 1 {
+				dx1, args = args[0], args[1:]
+			}
+			for ; len(args) >= 4; args = args[4:] {
+				ip.curveTo(dx1, args[0], args[1], args[2], 0, args[3])
+				dx1 = 0
+			}
+		case 27:
+			// hhcurveto
+			dy1 := 0.0
+			if len(args)%2 == 1 {
+				dy1, args = args[0], args[1:]
+			}
+			for ; len(args) >= 4; args = args[4:] {
+				ip.curveTo(args[0], dy1, args[1], args[2], args[3], 0)
+				dy1 = 0
+			}
+		case 30, 31:
+			// vhcurveto, hvcurveto
+			if err := ip.alternatingCurves(b0 == 31); err != nil {
+				return err
+			}
+		case 10, 29:
+			// callsubr, callgsubr
+			n, err := ip.pop()
+			if err != nil {
+				return err
+			}
+			subrs := ip.localSubrs
+			if b0 == 29 {
+				subrs = ip.globalSubrs
+			}
+			idx := int(n) + calculateBias(subrs)
+			if idx < 0 || idx >= len(subrs) {
+				return fmt.Errorf("subr %d does not exist", idx)
+			}
+			if err = ip.run(subrs[idx], depth+1); err != nil {
+				return err
+			}
+			if ip.endchar {
+				return nil
+			}
+			continue
+		case 11:
+			// return
+			return nil
+		case 14:
+			// endchar
+			ip.parseWidth(len(ip.stack) == 1 || len(ip.stack) == 5)
+			if len(ip.stack) == 4 {
+				ip.accent = &seac{
+					adx:   ip.stack[0],
+					ady:   ip.stack[1],
+					bchar: int(ip.stack[2]),
+					achar: int(ip.stack[3]),
+				}
+			}
+			ip.stack = ip.stack[:0]
+			ip.endchar = true
+			return nil
+		case 12:
+			if pos >= len(cs) {
+				return fmt.Errorf("charstring ends within an operator")
+			}
+			b1 := cs[pos]
+			pos++
+			if err := ip.escape(b1); err != nil {
+				return err
+			}
+			continue
+		default:
+			return fmt.Errorf("unknown operator %d", b0)
+		}
+		ip.stack = ip.stack[:0]
+	}
+	return nil
+}
+
+// escape executes the two byte operator 12 b1.
+func (ip *type2interpreter) escape(b1 byte) error {
+	args := ip.stack
+	need := func(n int) error {
+		if len(args) < n {
+			return fmt.Errorf("operator 12 %d: not enough arguments", b1)
+		}
+		return nil
+	}
+	// unary and binary operators replace their arguments with the result
+	result := func(n int, v float64) {
+		ip.stack = append(ip.stack[:len(ip.stack)-n], v)
+	}
+	boolean := func(b bool) float64 {
+		if b {
+			return 1
+		}
+		return 0
+	}
+	switch b1 {
+	case 34, 35, 36, 37:
+		// hflex, flex, hflex1, flex1
+		var counts = map[byte]int{34: 7, 35: 13, 36: 9, 37: 11}
+		if err := need(counts[b1]); err != nil {
+			return err
+		}
+		a := args
+		switch b1 {
+		case 34:
+			y := ip.y
+			ip.curveTo(a[0], 0, a[1], a[2], a[3], 0)
+			ip.curveTo(a[4], 0, a[5], y-ip.y, a[6], 0)
+		case 35:
+			ip.curveTo(a[0], a[1], a[2], a[3], a[4], a[5])
+			ip.curveTo(a[6], a[7], a[8], a[9], a[10], a[11])
+		case 36:
+			y := ip.y
+			ip.curveTo(a[0], a[1], a[2], a[3], a[4], 0)
+			ip.curveTo(a[5], 0, a[6], a[7], a[8], y-ip.y-a[7])
+		case 37:
+			x, y := ip.x, ip.y
+			dx := a[0] + a[2] + a[4] + a[6] + a[8]
+			dy := a[1] + a[3] + a[5] + a[7] + a[9]
+			ip.curveTo(a[0], a[1], a[2], a[3], a[4], a[5])
+			if math.Abs(dx) > math.Abs(dy) {
+				ip.curveTo(a[6], a[7], a[8], a[9], a[10], y-ip.y-a[7]-a[9])
+			} else {
+				ip.curveTo(a[6], a[7], a[8], a[9], x-ip.x-a[6]-a[8], a[10])
+			}
+		}
+		ip.stack = ip.stack[:0]
+	case 0:
+		// dotsection (deprecated)
+		ip.stack = ip.stack[:0]
+	case 3, 4, 10, 11, 12, 15, 24:
+		// and, or, add, sub, div, eq, mul
+		if err := need(2); err != nil {
+			return err
+		}
+		a, b := args[len(args)-2], args[len(args)-1]
+		var v float64
+		switch b1 {
+		case 3:
+			v = boolean(a != 0 && b != 0)
+		case 4:
+			v = boolean(a != 0 || b != 0)
+		case 10:
+			v = a + b
+		case 11:
+			v = a - b
+		case 12:
+			if b == 0 {
+				return fmt.Errorf("div: division by zero")
+			}
+			v = a / b
+		case 15:
+			v = boolean(a == b)
+		case 24:
+			v = a * b
+		}
+		result(2, v)
+	case 5, 9, 14, 26:
+		// not, abs, neg, sqrt
+		if err := need(1); err != nil {
+			return err
+		}
+		a := args[len(args)-1]
+		var v float64
+		switch b1 {
+		case 5:
+			v = boolean(a == 0)
+		case 9:
+			v = math.Abs(a)
+		case 14:
+			v = -a
+		case 26:
+			v = math.Sqrt(a)
+		}
+		result(1, v)
+	case 18:
+		// drop
+		if _, err := ip.pop(); err != nil {
+			return err
+		}
+	case 20:
+		// put
+		if err := need(2); err != nil {
+			return err
+		}
+		i := int(args[len(args)-1])
+		if i < 0 || i >= len(ip.transient) {
+			return fmt.Errorf("put: invalid index %d", i)
+		}
+		ip.transient[i] = args[len(args)-2]
+		ip.stack = ip.stack[:len(ip.stack)-2]
+	case 21:
+		// get
+		if err := need(1); err != nil {
+			return err
+		}
+		i := int(args[len(args)-1])
+		if i < 0 || i >= len(ip.transient) {
+			return fmt.Errorf("get: invalid index %d", i)
+		}
+		result(1, ip.transient[i])
+	case 22:
+		// ifelse
+		if err := need(4); err != nil {
+			return err
+		}
+		s1, s2, v1, v2 := args[len(args)-4], args[len(args)-3], args[len(args)-2], args[len(args)-1]
+		if v1 > v2 {
+			s1 = s2
+		}
+		result(4, s1)
+	case 23:
+		// random, a number in (0, 1]
+		if err := ip.push(1 - rand.Float64()); err != nil {
+			return err
+		}
+	case 27:
+		// dup
+		if err := need(1); err != nil {
+			return err
+		}
+		if err := ip.push(args[len(args)-1]); err != nil {
+			return err
+		}
+	case 28:
+		// exch
+		if err := need(2); err != nil {
+			return err
+		}
+		n := len(args)
+		args[n-2], args[n-1] = args[n-1], args[n-2]
+	case 29:
+		// index
+		if err := need(1); err != nil {
+			return err
+		}
+		n := len(args) - 1
+		i := int(args[n])
+		if i < 0 {
+			i = 0
+		}
+		if i >= n {
+			return fmt.Errorf("index: invalid index %d", i)
+		}
+		args[n] = args[n-1-i]
+	case 30:
+		// roll
+		if err := need(2); err != nil {
+			return err
+		}
+		n, j := int(args[len(args)-2]), int(args[len(args)-1])
+		ip.stack = ip.stack[:len(ip.stack)-2]
+		if n < 0 || n > len(ip.stack) {
+			return fmt.Errorf("roll: invalid count %d", n)
+		}
+		if n > 0 {
+			elements := ip.stack[len(ip.stack)-n:]
+			rolled := make([]float64, n)
+			for i, v := range elements {
+				rolled[((i+j)%n+n)%n] = v
+			}
+			copy(elements, rolled)
+		}
+	default:
+		return fmt.Errorf("unknown operator 12 %d", b1)
+	}
+	return nil
+}
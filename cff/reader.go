@@ -101,6 +101,7 @@ func (c *CFF) readDictIndex(r io.Reader) error {
 	allFonts := cffReadIndexData(r, "dict")
 	for _, cffFont := range allFonts {
 		fnt := &Font{
+			global:             c,
 			underlineThickness: 50,
 			underlinePosition:  -100,
 		}
@@ -230,8 +231,20 @@ func ParseCFFData(r io.ReadSeeker) (*CFF, error) {
 
 	for _, fnt := range cff.Font {
 		fnt.parseIndex(r, CharStringsIndex)
-		fnt.parseIndex(r, Encoding)
+		// 0 and 1 are the predefined encodings
+		if fnt.encodingOffset > 1 {
+			fnt.parseIndex(r, Encoding)
+		}
 		fnt.parseIndex(r, CharSet)
+		if fnt.IsCIDFont() {
+			if err := fnt.readFDSelect(r); err != nil {
+				return nil, err
+			}
+			if err := fnt.readFDArray(r); err != nil {
+				return nil, err
+			}
+			continue
+		}
 		fnt.parseIndex(r, PrivateDict)
 		if fnt.subrsOffset > 0 {
 			fnt.parseIndex(r, LocalSubrsIndex)
@@ -0,0 +1,428 @@
+package cff
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+)
+
+// Subroutinizing is done in these steps:
+//
+//  1. All charstrings are desubroutinized and split into tokens (numbers and
+//     operators including their hint mask bytes).
+//  2. A suffix array of the tokens of all charstrings is used to find
+//     repeated token sequences. These are the candidates for new subrs.
+//  3. For each charstring the cheapest combination of tokens and subr calls
+//     is calculated. Candidates that are not used at least twice are removed
+//     and the calculation is repeated until all subrs are used at least twice.
+//
+// The new subrs do not call other subrs, so the nesting limit is never
+// reached. A subr is only called where the stack has room for the subr
+// number.
+
+// maxStack is the maximum number of operands on the Type 2 charstring stack.
+const maxStack = 48
+
+// maxSubrCandidates limits the number of repeated sequences considered as
+// subrs.
+const maxSubrCandidates = 20000
+
+// subrCandidate is a repeated token sequence.
+type subrCandidate struct {
+	start  int // position of the first occurrence in the token stream
+	tokens int
+	length int
+	// positions in the token stream where the sequence occurs
+	occurrences []int
+	uses        int
+	// font DICT of the charstrings calling the candidate, -1 if several font
+	// DICTs call the candidate.
+	usedFD int
+	// font DICT of a local subr
+	fd       int
+	global   bool
+	index    int
+	callCost int
+}
+
+type subroutinizer struct {
+	// token id of each token, negative for the separator after each charstring
+	stream []int
+	// byte offset of each token, with an additional entry at the end
+	offsets []int
+	depths  []int
+	data    []byte
+	// first token of each charstring, with an additional entry at the end
+	glyphStart []int
+	glyphFD    []int
+	candidates []*subrCandidate
+}
+
+// Subroutinize replaces repeated parts of the charstrings by calls to new
+// subrs. Existing subrs are inlined first. In CID-keyed fonts the subrs that
+// are only used by the glyphs of one font DICT become local subrs of this font
+// DICT and the others become global subrs. Otherwise the subrs are
+// distributed between the global and the local subrs, so that more subr
+// numbers can be encoded in one byte.
+func (c *CFF) Subroutinize() error {
+	if len(c.Font) != 1 {
+		return fmt.Errorf("Subroutinize needs CFF data with exactly one font")
+	}
+	f := c.Font[0]
+	s := &subroutinizer{}
+	if err := s.tokenize(f, c.globalSubrIndex); err != nil {
+		return err
+	}
+	s.findCandidates()
+
+	numFDs := 1
+	if f.IsCIDFont() {
+		numFDs = len(f.fdFonts)
+	}
+	candidates := s.candidates
+	for _, cand := range candidates {
+		cand.callCost = 2
+	}
+	var calls [][]int
+	assigned := false
+	for {
+		calls = s.chooseCalls(candidates, assigned)
+		used := []*subrCandidate{}
+		for _, cand := range candidates {
+			if cand.uses > 1 {
+				used = append(used, cand)
+			}
+		}
+		if assigned && len(used) == len(candidates) {
+			break
+		}
+		candidates = used
+		s.assignSubrNumbers(candidates, f.IsCIDFont(), numFDs)
+		assigned = true
+	}
+
+	globalSubrs := [][]byte{}
+	localSubrs := make([][][]byte, numFDs)
+	for _, cand := range candidates {
+		body := s.data[s.offsets[cand.start]:s.offsets[cand.start+cand.tokens]]
+		subr := make([]byte, len(body), len(body)+1)
+		copy(subr, body)
+		if body[len(body)-1] != 14 {
+			// return unless the subr ends with endchar
+			subr = append(subr, 11)
+		}
+		// the candidates are sorted by their subr numbers
+		if cand.global {
+			globalSubrs = append(globalSubrs, subr)
+		} else {
+			localSubrs[cand.fd] = append(localSubrs[cand.fd], subr)
+		}
+	}
+	globalBias := calculateBias(globalSubrs)
+	for gid := range f.CharStrings {
+		localBias := calculateBias(localSubrs[s.glyphFD[gid]])
+		var b bytes.Buffer
+		for pos := s.glyphStart[gid]; pos < s.glyphStart[gid+1]-1; pos++ {
+			if id := calls[gid][pos-s.glyphStart[gid]]; id >= 0 {
+				cand := candidates[id]
+				if cand.global {
+					b.Write(encodeType2Number(cand.index - globalBias))
+					b.WriteByte(29)
+				} else {
+					b.Write(encodeType2Number(cand.index - localBias))
+					b.WriteByte(10)
+				}
+				pos += cand.tokens - 1
+				continue
+			}
+			b.Write(s.data[s.offsets[pos]:s.offsets[pos+1]])
+		}
+		f.CharStrings[gid] = b.Bytes()
+	}
+
+	c.globalSubrIndex = globalSubrs
+	if f.IsCIDFont() {
+		for i, fd := range f.fdFonts {
+			fd.subrsIndex = localSubrs[i]
+		}
+	} else {
+		f.subrsIndex = localSubrs[0]
+	}
+	f.desubroutinized = false
+	return nil
+}
+
+// tokenize desubroutinizes all charstrings of f and adds their tokens to the
+// token stream.
+func (s *subroutinizer) tokenize(f *Font, globalSubrs [][]byte) error {
+	tokenIDs := make(map[string]int)
+	for gid, cs := range f.CharStrings {
+		fd := 0
+		localSubrs := f.subrsIndex
+		if f.IsCIDFont() {
+			fd = int(f.fdIndex[gid])
+			localSubrs = f.fdFonts[fd].subrsIndex
+		}
+		d, err := newDesubroutinizer(cs, globalSubrs, localSubrs)
+		if err != nil {
+			return fmt.Errorf("glyph %d: %s", gid, err)
+		}
+		s.glyphStart = append(s.glyphStart, len(s.stream))
+		s.glyphFD = append(s.glyphFD, fd)
+		for i, start := range d.tokenStarts {
+			end := len(d.out)
+			if i+1 < len(d.tokenStarts) {
+				end = d.tokenStarts[i+1]
+			}
+			token := string(d.out[start:end])
+			id, ok := tokenIDs[token]
+			if !ok {
+				id = len(tokenIDs)
+				tokenIDs[token] = id
+			}
+			s.stream = append(s.stream, id)
+			s.offsets = append(s.offsets, len(s.data)+start)
+			s.depths = append(s.depths, d.tokenDepths[i])
+		}
+		s.data = append(s.data, d.out...)
+		// the separator is different for each charstring, so repeated
+		// sequences never cross charstrings
+		s.stream = append(s.stream, -1-gid)
+		s.offsets = append(s.offsets, len(s.data))
+		s.depths = append(s.depths, 0)
+	}
+	s.glyphStart = append(s.glyphStart, len(s.stream))
+	s.offsets = append(s.offsets, len(s.data))
+	return nil
+}
+
+// suffixArray returns the suffix array of the stream using prefix doubling.
+func suffixArray(stream []int) []int {
+	n := len(stream)
+	sa := make([]int, n)
+	if n == 0 {
+		return sa
+	}
+	rank := make([]int, n)
+	tmp := make([]int, n)
+	for i := range sa {
+		sa[i] = i
+		rank[i] = stream[i]
+	}
+	for k := 1; ; k *= 2 {
+		second := func(i int) int {
+			if i+k < n {
+				return rank[i+k]
+			}
+			// smaller than all ranks and all separators
+			return -n - 1
+		}
+		less := func(a, b int) bool {
+			if rank[a] != rank[b] {
+				return rank[a] < rank[b]
+			}
+			return second(a) < second(b)
+		}
+		sort.Slice(sa, func(i, j int) bool { return less(sa[i], sa[j]) })
+		tmp[sa[0]] = 0
+		for i := 1; i < n; i++ {
+			tmp[sa[i]] = tmp[sa[i-1]]
+			if less(sa[i-1], sa[i]) {
+				tmp[sa[i]]++
+			}
+		}
+		copy(rank, tmp)
+		if rank[sa[n-1]] == n-1 {
+			return sa
+		}
+	}
+}
+
+// lcpArray returns the length of the longest common prefix of each suffix
+// in the suffix array and the previous one (Kasai et al.).
+func lcpArray(stream []int, sa []int) []int {
+	n := len(stream)
+	rank := make([]int, n)
+	for i, p := range sa {
+		rank[p] = i
+	}
+	lcp := make([]int, n)
+	h := 0
+	for i := 0; i < n; i++ {
+		if rank[i] == 0 {
+			h = 0
+			continue
+		}
+		j := sa[rank[i]-1]
+		for i+h < n && j+h < n && stream[i+h] == stream[j+h] {
+			h++
+		}
+		lcp[rank[i]] = h
+		if h > 0 {
+			h--
+		}
+	}
+	return lcp
+}
+
+// findCandidates collects the repeated token sequences which save space when
+// replaced by subr calls.
+func (s *subroutinizer) findCandidates() {
+	sa := suffixArray(s.stream)
+	lcp := lcpArray(s.stream, sa)
+
+	type interval struct {
+		lcp int
+		lb  int
+	}
+	var candidates []*subrCandidate
+	addCandidate := func(iv interval, rb int) {
+		start := sa[iv.lb]
+		length := s.offsets[start+iv.lcp] - s.offsets[start]
+		count := rb - iv.lb + 1
+		// a call costs at least two bytes, the subr needs a return and an
+		// offset in the INDEX
+		if count*(length-2)-(length+3) <= 0 {
+			return
+		}
+		occurrences := make([]int, count)
+		copy(occurrences, sa[iv.lb:rb+1])
+		candidates = append(candidates, &subrCandidate{
+			start:       start,
+			tokens:      iv.lcp,
+			length:      length,
+			occurrences: occurrences,
+		})
+	}
+	// enumerate the lcp intervals, see Abouelhoda et al., Replacing suffix
+	// trees with enhanced suffix arrays
+	stack := []interval{{0, 0}}
+	for i := 1; i <= len(sa); i++ {
+		l := 0
+		if i < len(sa) {
+			l = lcp[i]
+		}
+		lb := i - 1
+		for l < stack[len(stack)-1].lcp {
+			iv := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			addCandidate(iv, i-1)
+			lb = iv.lb
+		}
+		if l > stack[len(stack)-1].lcp {
+			stack = append(stack, interval{l, lb})
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		savingA := len(a.occurrences)*(a.length-2) - a.length
+		savingB := len(b.occurrences)*(b.length-2) - b.length
+		if savingA != savingB {
+			return savingA > savingB
+		}
+		return a.start < b.start
+	})
+	if len(candidates) > maxSubrCandidates {
+		candidates = candidates[:maxSubrCandidates]
+	}
+	s.candidates = candidates
+}
+
+// chooseCalls calculates for each charstring the cheapest combination of
+// tokens and calls to the candidates. It returns for each token of each
+// charstring the candidate that is called at this position or -1. The uses
+// and the font DICTs of the candidates are updated. If assigned is true, the
+// local subrs are only called by the charstrings of their font DICT.
+func (s *subroutinizer) chooseCalls(candidates []*subrCandidate, assigned bool) [][]int {
+	startsAt := make([][]int, len(s.stream))
+	for id, cand := range candidates {
+		cand.uses = 0
+		cand.usedFD = -2
+		for _, pos := range cand.occurrences {
+			startsAt[pos] = append(startsAt[pos], id)
+		}
+	}
+	calls := make([][]int, len(s.glyphFD))
+	for gid := range calls {
+		first := s.glyphStart[gid]
+		// without the separator
+		numTokens := s.glyphStart[gid+1] - first - 1
+		cost := make([]int, numTokens+1)
+		choice := make([]int, numTokens)
+		for i := numTokens - 1; i >= 0; i-- {
+			pos := first + i
+			cost[i] = s.offsets[pos+1] - s.offsets[pos] + cost[i+1]
+			choice[i] = -1
+			if s.depths[pos] >= maxStack {
+				continue
+			}
+			for _, id := range startsAt[pos] {
+				cand := candidates[id]
+				if assigned && !cand.global && cand.fd != s.glyphFD[gid] {
+					continue
+				}
+				if c := cand.callCost + cost[i+cand.tokens]; c < cost[i] {
+					cost[i] = c
+					choice[i] = id
+				}
+			}
+		}
+		calls[gid] = make([]int, numTokens)
+		for i := range calls[gid] {
+			calls[gid][i] = -1
+		}
+		for i := 0; i < numTokens; i++ {
+			if id := choice[i]; id >= 0 {
+				calls[gid][i] = id
+				cand := candidates[id]
+				cand.uses++
+				switch cand.usedFD {
+				case -2:
+					cand.usedFD = s.glyphFD[gid]
+				case s.glyphFD[gid]:
+				default:
+					cand.usedFD = -1
+				}
+				i += cand.tokens - 1
+			}
+		}
+	}
+	return calls
+}
+
+// assignSubrNumbers sorts the candidates by their uses and assigns the subr
+// numbers and the costs of the subr calls.
+func (s *subroutinizer) assignSubrNumbers(candidates []*subrCandidate, isCIDFont bool, numFDs int) {
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].uses > candidates[j].uses })
+	numGlobal := 0
+	numLocal := make([]int, numFDs)
+	for _, cand := range candidates {
+		if isCIDFont {
+			cand.global = cand.usedFD < 0
+			cand.fd = cand.usedFD
+		} else {
+			cand.global = numGlobal < numLocal[0]
+			cand.fd = 0
+		}
+		if cand.global {
+			cand.index = numGlobal
+			numGlobal++
+		} else {
+			cand.index = numLocal[cand.fd]
+			numLocal[cand.fd]++
+		}
+	}
+	for _, cand := range candidates {
+		n := numGlobal
+		if !cand.global {
+			n = numLocal[cand.fd]
+		}
+		bias := 107
+		if n >= 33900 {
+			bias = 32768
+		} else if n >= 1240 {
+			bias = 1131
+		}
+		cand.callCost = len(encodeType2Number(cand.index-bias)) + 1
+	}
+}
@@ -2,7 +2,6 @@ package cff
 
 import (
 	"fmt"
-	"log"
 )
 
 func calculateBias(subrs [][]byte) int {
@@ -15,12 +14,63 @@ func calculateBias(subrs [][]byte) int {
 	return 32768
 }
 
-var (
-	usedGlobalSubrsMap map[int]bool
-	usedLocalSubrsMap  map[int]bool
-)
+// maxSubrNesting is the subr nesting limit of the Type 2 charstring format.
+const maxSubrNesting = 10
+
+// subrUsage collects the subrs that are used by charstrings and the subr calls
+// of the charstrings and subrs. usedLocalSubrs belongs to the local subrs of
+// the charstrings that are examined.
+type subrUsage struct {
+	usedGlobalSubrs map[int]bool
+	usedLocalSubrs  map[int]bool
+	calls           map[subrOwner][]subrCall
+	depth           int
+}
+
+func newSubrUsage() *subrUsage {
+	return &subrUsage{
+		usedGlobalSubrs: make(map[int]bool),
+		usedLocalSubrs:  make(map[int]bool),
+		calls:           make(map[subrOwner][]subrCall),
+	}
+}
+
+// subrOwner is a charstring ('c'), a local subr ('l') or a global subr ('g').
+// fd is the font DICT in a CID-keyed font. For global subrs this is the font
+// DICT of the calling charstring, whose local subrs are used by the subr.
+type subrOwner struct {
+	kind  byte
+	fd    int
+	index int
+}
+
+// subrCall is a callsubr or callgsubr operator in a charstring. The subr
+// number is encoded in the bytes start to end. start is -1 if the subr number
+// is not a number in the charstring but the result of a calculation.
+type subrCall struct {
+	start  int
+	end    int
+	global bool
+	index  int
+}
+
+// encodeType2Number returns the charstring encoding of the integer num.
+func encodeType2Number(num int) []byte {
+	switch {
+	case num >= -107 && num <= 107:
+		return []byte{byte(num + 139)}
+	case num >= 108 && num <= 1131:
+		num -= 108
+		return []byte{byte(num>>8 + 247), byte(num)}
+	case num >= -1131 && num <= -108:
+		num = -num - 108
+		return []byte{byte(num>>8 + 251), byte(num)}
+	}
+	return []byte{28, byte(num >> 8), byte(num)}
+}
 
 type type2state struct {
+	fd            int
 	stack         []int
 	cHints        int
 	hasWd         bool
@@ -39,10 +89,6 @@ func (state *type2state) pop() int {
 	return i
 }
 
-func (state *type2state) popN(n int) {
-	state.stack = state.stack[:len(state.stack)-n]
-}
-
 func (state *type2state) push(n int) {
 	state.stack = append(state.stack, n)
 }
@@ -72,26 +118,38 @@ func (state *type2state) checkWd() bool {
 }
 
 // getSubrsIndex goes recursively into all subroutines called by the char string cs and
-// sets the entries in the global maps usedGlobalSubrsMap and usedLocalSubrsMap to true
-// if the subroutine is used.
-func getSubrsIndex(nominalWidthX int, defaultWidthX int, globalSubrs [][]byte, localSubrs [][]byte, cs []byte, state *type2state) {
+// sets the entries in the maps usedGlobalSubrs and usedLocalSubrs of usage to true
+// if the subroutine is used. The subr calls of cs and of the called subroutines
+// are recorded in usage.calls.
+func (usage *subrUsage) getSubrsIndex(nominalWidthX int, defaultWidthX int, globalSubrs [][]byte, localSubrs [][]byte, cs []byte, owner subrOwner, state *type2state) error {
 	if state == nil {
 		state = &type2state{}
 		state.stack = make([]int, 0, 48)
 		state.nominalWidthX = nominalWidthX
 		state.defaultWidthX = defaultWidthX
+		state.fd = owner.fd
+	}
+	if usage.depth > maxSubrNesting {
+		return fmt.Errorf("subrs are nested too deeply")
 	}
 
 	localBias := calculateBias(localSubrs)
 	globalBias := calculateBias(globalSubrs)
 
+	var calls []subrCall
+	// start of the last number if the previous token is a number
+	numStart := -1
 	pos := -1
 	for {
 		pos++
 		if len(cs) <= pos {
 			break
 		}
+		start := pos
 		b0 := cs[pos]
+		if operandLen := type2OperandLen(b0); pos+operandLen >= len(cs) {
+			return fmt.Errorf("charstring ends within a number")
+		}
 		if b0 == 1 {
 			// hstem
 			state.cHints += state.clearEven()
@@ -116,24 +174,30 @@ func getSubrsIndex(nominalWidthX int, defaultWidthX int, globalSubrs [][]byte, l
 			// rrcurveto
 			state.clearStack()
 		} else if b0 == 10 {
+			if len(state.stack) == 0 {
+				return fmt.Errorf("callsubr without a subr number")
+			}
 			subrIdx := state.pop() + localBias
+			calls = append(calls, subrCall{start: numStart, end: pos, index: subrIdx})
 
-			if subrIdx < len(localSubrs) {
-				getSubrsIndex(nominalWidthX, defaultWidthX, globalSubrs, localSubrs, localSubrs[subrIdx], state)
-				usedLocalSubrsMap[subrIdx] = true
-			} else {
-				panic("subrIdx must be < len(localSubrs)")
+			if subrIdx < 0 || subrIdx >= len(localSubrs) {
+				return fmt.Errorf("local subr %d out of range (%d subrs)", subrIdx, len(localSubrs))
+			}
+			usage.depth++
+			err := usage.getSubrsIndex(nominalWidthX, defaultWidthX, globalSubrs, localSubrs, localSubrs[subrIdx], subrOwner{'l', state.fd, subrIdx}, state)
+			usage.depth--
+			if err != nil {
+				return err
 			}
+			usage.usedLocalSubrs[subrIdx] = true
 			state.checkWd()
 		} else if b0 == 11 {
 			// return
 		} else if b0 == 12 {
 			// escape
-			b1 := cs[pos+1]
+			// flex operators consume all arguments
 			pos++
-			if b1 == 1 {
-
-			}
+			state.clearStack()
 		} else if b0 == 14 {
 			// endchar
 		} else if b0 == 18 {
@@ -154,13 +218,12 @@ func getSubrsIndex(nominalWidthX int, defaultWidthX int, globalSubrs [][]byte, l
 				pos++
 			}
 		} else if b0 == 20 {
-			// cntrmask
-			for i := 0; i <= state.cHints/8; i++ {
-				pos++
-			}
+			// cntrmask, same size as hintmask
+			state.cHints += state.clearEven()
+			pos += (state.cHints + 7) / 8
 		} else if b0 == 21 {
 			// rmoveto
-			state.popN(2)
+			state.clearStack()
 		} else if b0 == 22 {
 			// hmoveto
 			state.clearStack()
@@ -181,16 +244,25 @@ func getSubrsIndex(nominalWidthX int, defaultWidthX int, globalSubrs [][]byte, l
 			state.clearStack()
 		} else if b0 == 28 {
 			// shortint
-			log.Fatal("nyi: shortint")
+			state.push(int(int16(cs[pos+1])<<8 | int16(cs[pos+2])))
+			pos += 2
 		} else if b0 == 29 {
+			if len(state.stack) == 0 {
+				return fmt.Errorf("callgsubr without a subr number")
+			}
 			subrIdx := state.pop() + globalBias
+			calls = append(calls, subrCall{start: numStart, end: pos, global: true, index: subrIdx})
 
-			if subrIdx < len(globalSubrs) {
-				getSubrsIndex(nominalWidthX, defaultWidthX, globalSubrs, localSubrs, globalSubrs[subrIdx], state)
-				usedGlobalSubrsMap[subrIdx] = true
-			} else {
-				panic("subrIdx must be < len(globalSubrs)")
+			if subrIdx < 0 || subrIdx >= len(globalSubrs) {
+				return fmt.Errorf("global subr %d out of range (%d subrs)", subrIdx, len(globalSubrs))
 			}
+			usage.depth++
+			err := usage.getSubrsIndex(nominalWidthX, defaultWidthX, globalSubrs, localSubrs, globalSubrs[subrIdx], subrOwner{'g', state.fd, subrIdx}, state)
+			usage.depth--
+			if err != nil {
+				return err
+			}
+			usage.usedGlobalSubrs[subrIdx] = true
 			state.checkWd()
 		} else if b0 == 30 {
 			// vhcurveto
@@ -214,12 +286,188 @@ func getSubrsIndex(nominalWidthX int, defaultWidthX int, globalSubrs [][]byte, l
 			val := -(int(b0)-251)*256 - int(b1) - 108
 			state.push(val)
 		} else if b0 == 255 {
+			// 16.16 fixed point number, only the integer part is used
+			state.push(int(int32(cs[pos+1])<<24|int32(cs[pos+2])<<16|int32(cs[pos+3])<<8|int32(cs[pos+4])) >> 16)
 			pos += 4
-			// ignore for now
-			// state.clearStack()
 		} else {
 			fmt.Println("b", b0)
 			// state.clearStack()
 		}
+		if b0 == 28 || b0 >= 32 {
+			numStart = start
+		} else {
+			numStart = -1
+		}
+	}
+	usage.calls[owner] = calls
+	return nil
+}
+
+// type2OperandLen returns the number of bytes that follow b0 in the encoding
+// of a number.
+func type2OperandLen(b0 byte) int {
+	switch {
+	case b0 == 28:
+		return 2
+	case b0 >= 247 && b0 <= 254:
+		return 1
+	case b0 == 255:
+		return 4
+	}
+	return 0
+}
+
+// desubroutinizer inlines the subrs of a charstring.
+type desubroutinizer struct {
+	globalSubrs [][]byte
+	localSubrs  [][]byte
+	// number of operands on the stack and the last operand
+	numOperands int
+	lastOperand int
+	// start of the last operand in out, -1 if the last token is an operator
+	operandStart int
+	cHints       int
+	out          []byte
+	// start of each token in out and the number of operands on the stack
+	// before the token
+	tokenStarts []int
+	tokenDepths []int
+}
+
+// addToken appends the token to the output.
+func (d *desubroutinizer) addToken(token []byte) {
+	d.tokenStarts = append(d.tokenStarts, len(d.out))
+	d.tokenDepths = append(d.tokenDepths, d.numOperands)
+	d.out = append(d.out, token...)
+}
+
+// desubroutinize returns the charstring cs with all subr calls replaced by
+// the called subrs. The hint masks are kept, they refer to the stems in the
+// same charstring afterwards.
+func desubroutinize(cs []byte, globalSubrs [][]byte, localSubrs [][]byte) ([]byte, error) {
+	d, err := newDesubroutinizer(cs, globalSubrs, localSubrs)
+	if err != nil {
+		return nil, err
+	}
+	return d.out, nil
+}
+
+// newDesubroutinizer returns the desubroutinizer after inlining the subrs
+// of cs.
+func newDesubroutinizer(cs []byte, globalSubrs [][]byte, localSubrs [][]byte) (*desubroutinizer, error) {
+	d := &desubroutinizer{
+		globalSubrs:  globalSubrs,
+		localSubrs:   localSubrs,
+		operandStart: -1,
+		out:          make([]byte, 0, len(cs)),
+	}
+	if _, err := d.inline(cs, 0); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+// inline copies the charstring cs to d.out. It returns true if the end of the
+// glyph (endchar) is reached.
+func (d *desubroutinizer) inline(cs []byte, depth int) (bool, error) {
+	// maximum nesting of subr calls, see Type 2 charstring spec appendix B
+	if depth > 10 {
+		return false, fmt.Errorf("subrs nested too deep")
+	}
+	pos := 0
+	for pos < len(cs) {
+		b0 := cs[pos]
+		var numLen int
+		switch {
+		case b0 == 28:
+			numLen = 3
+		case b0 >= 32 && b0 <= 246:
+			numLen = 1
+		case b0 >= 247 && b0 <= 254:
+			numLen = 2
+		case b0 == 255:
+			numLen = 5
+		}
+		if pos+numLen > len(cs) {
+			return false, fmt.Errorf("charstring ends within a number")
+		}
+		if numLen > 0 {
+			d.operandStart = len(d.out)
+			d.addToken(cs[pos : pos+numLen])
+			d.numOperands++
+			switch numLen {
+			case 1:
+				d.lastOperand = int(b0) - 139
+			case 2:
+				if b0 <= 250 {
+					d.lastOperand = (int(b0)-247)*256 + int(cs[pos+1]) + 108
+				} else {
+					d.lastOperand = -(int(b0)-251)*256 - int(cs[pos+1]) - 108
+				}
+			case 3:
+				d.lastOperand = int(int16(cs[pos+1])<<8 | int16(cs[pos+2]))
+			case 5:
+				d.lastOperand = int(int32(cs[pos+1])<<24|int32(cs[pos+2])<<16|int32(cs[pos+3])<<8|int32(cs[pos+4])) >> 16
+			}
+			pos += numLen
+			continue
+		}
+
+		pos++
+		switch b0 {
+		case 10, 29:
+			if d.operandStart < 0 {
+				return false, fmt.Errorf("subr number is not a number in the charstring")
+			}
+			subrs := d.localSubrs
+			if b0 == 29 {
+				subrs = d.globalSubrs
+			}
+			idx := d.lastOperand + calculateBias(subrs)
+			if idx < 0 || idx >= len(subrs) {
+				return false, fmt.Errorf("subr %d does not exist", idx)
+			}
+			// remove the subr number from the output
+			d.out = d.out[:d.operandStart]
+			d.tokenStarts = d.tokenStarts[:len(d.tokenStarts)-1]
+			d.tokenDepths = d.tokenDepths[:len(d.tokenDepths)-1]
+			d.numOperands--
+			d.operandStart = -1
+			if endchar, err := d.inline(subrs[idx], depth+1); err != nil || endchar {
+				return endchar, err
+			}
+			continue
+		case 11:
+			// return
+			return false, nil
+		case 1, 3, 18, 23:
+			// hstem, vstem, hstemhm, vstemhm
+			d.cHints += d.numOperands / 2
+			d.addToken([]byte{b0})
+		case 19, 20:
+			// hintmask and cntrmask, the stack can have vstem values
+			d.cHints += d.numOperands / 2
+			maskLen := (d.cHints + 7) / 8
+			if pos+maskLen > len(cs) {
+				return false, fmt.Errorf("charstring ends within a hint mask")
+			}
+			d.addToken(cs[pos-1 : pos+maskLen])
+			pos += maskLen
+		case 12:
+			if pos >= len(cs) {
+				return false, fmt.Errorf("charstring ends within an operator")
+			}
+			d.addToken(cs[pos-1 : pos+1])
+			pos++
+		case 14:
+			// endchar
+			d.addToken([]byte{b0})
+			return true, nil
+		default:
+			d.addToken([]byte{b0})
+		}
+		d.numOperands = 0
+		d.operandStart = -1
 	}
+	return false, nil
 }
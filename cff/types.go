@@ -61,10 +61,10 @@ type Font struct {
 	global             *CFF
 	name               SID
 	bbox               []int
-	bluefuzz           int
+	bluefuzz           float64
 	bluescale          float64
-	blueshift          int
-	bluevalues         []int
+	blueshift          float64
+	bluevalues         []float64
 	charset            []SID
 	charsetOffset      int64
 	charsetFormat      uint8
@@ -74,29 +74,36 @@ type Font struct {
 	copyright          SID
 	data               []byte // for font writing
 	defaultWidthX      int
+	desubroutinized    bool
 	dict               []byte
 	encodingOffset     int
 	encoding           map[int]int
 	encodingFormat     uint8
-	familyblues        []int
-	familyotherblues   []int
+	expansionFactor    float64
+	familyblues        []float64
+	familyotherblues   []float64
 	fdarray            int64
+	fdFonts            []*Font
 	fdselect           int64
+	fdIndex            []uint8
+	fontMatrix         []float64
+	forceBold          bool
 	fullname           SID
 	familyname         SID
 	initialRandomSeed  int
+	languageGroup      int
 	nominalWidthX      int
 	notice             SID
 	ordering           SID
-	otherblues         []int
+	otherblues         []float64
 	privatedictoffset  int64
 	privatedictsize    int
 	privatedict        []byte
 	registry           SID
-	stdhw              int
-	stdvw              int
-	stemsnaph          []int
-	stemsnapv          []int
+	stdhw              float64
+	stdvw              float64
+	stemsnaph          []float64
+	stemsnapv          []float64
 	subrsOffset        int
 	subrsIndex         [][]byte
 	supplement         int
@@ -179,13 +179,10 @@ func (c *CFF) WriteCFFData(w io.Writer) error {
 	var stringGlobalSubrIndex bytes.Buffer
 	var dictIndex bytes.Buffer
 
-	// Now let's the dict index into a temporary buffer so we know the length
-	// of the buffer.
-	_, err = c.writeIndex(&dictIndex, DictIndex)
-	if err != nil {
-		return err
-	}
-	dictIndexLen := dictIndex.Len()
+	cf := c.Font[c.Fontindex]
+	// encodings can be ignored. This must be set before the length of the
+	// dict index is calculated.
+	cf.encodingOffset = 0
 
 	for _, idx := range []mainIndex{StringIndex, GlobalSubrIndex} {
 		_, err := c.writeIndex(&stringGlobalSubrIndex, idx)
@@ -194,33 +191,45 @@ func (c *CFF) WriteCFFData(w io.Writer) error {
 		}
 	}
 
-	cf := c.Font[c.Fontindex]
-	fi, err := cf.fontInfo()
-	if err != nil {
-		return err
-	}
 	// let's assume one font only for now
 	// offsets are now header + name index + len(dictindex) + len(string index) + len(global subr index) + offsets
 	// that is                         cur + len(dictindex)  + stringGlobalSubrIndex.Len() + offsets
-	baselen := cur + dictIndexLen + stringGlobalSubrIndex.Len()
-	// encodings can be ignored
-	cf.encodingOffset = 0
-
-	// the encoded size of the offsets can change. We calculate the delta and add this to the baselen
-	prevLen := len(cffDictEncodeNumber(int64(cf.charstringsOffset))) + len(cffDictEncodeNumber(int64(cf.charsetOffset))) + len(cffDictEncodeNumber(int64(cf.privatedictoffset)))
-	newLen := len(cffDictEncodeNumber(int64(baselen+fi.CharStringsOffset))) + len(cffDictEncodeNumber(int64(baselen+fi.CharSetOffset))) + len(cffDictEncodeNumber(int64(baselen+fi.PrivateDictOffset)))
-	delta := newLen - prevLen
-
-	baselen += delta
-	cf.charstringsOffset = int64(baselen + fi.CharStringsOffset)
-	cf.charsetOffset = int64(baselen + fi.CharSetOffset)
-	cf.privatedictoffset = int64(baselen + fi.PrivateDictOffset)
-	cf.privatedictsize = fi.PrivateDictSize
+	//
+	// The encoded size of the offsets in the dict index (and in the FDArray
+	// of CID-keyed fonts) depends on the offsets, so the data is laid out
+	// until the length of the dict index does not change anymore.
+	_, err = c.writeIndex(&dictIndex, DictIndex)
+	if err != nil {
+		return err
+	}
+	for {
+		baselen := cur + dictIndex.Len() + stringGlobalSubrIndex.Len()
+		fi, err := cf.fontInfo(baselen)
+		if err != nil {
+			return err
+		}
+		cf.charstringsOffset = int64(baselen + fi.CharStringsOffset)
+		cf.charsetOffset = int64(baselen + fi.CharSetOffset)
+		if cf.IsCIDFont() {
+			cf.fdselect = int64(baselen + fi.FDSelectOffset)
+			cf.fdarray = int64(baselen + fi.FDArrayOffset)
+		} else {
+			cf.privatedictoffset = int64(baselen + fi.PrivateDictOffset)
+			cf.privatedictsize = fi.PrivateDictSize
+		}
+		dictIndexLen := dictIndex.Len()
+		dictIndex.Reset()
+		if _, err = c.writeIndex(&dictIndex, DictIndex); err != nil {
+			return err
+		}
+		if dictIndex.Len() == dictIndexLen {
+			break
+		}
+	}
 
 	// now we can write all data
 	// header + NameIndex is already written to w
-	_, err = c.writeIndex(w, DictIndex)
-	if err != nil {
+	if _, err = dictIndex.WriteTo(w); err != nil {
 		return err
 	}
 
@@ -228,7 +237,9 @@ func (c *CFF) WriteCFFData(w io.Writer) error {
 	stringGlobalSubrIndex.WriteTo(w)
 
 	// For the selected font, the char string, private dict and local subr index are written.
-	// The data field is created in fontInfo() above.
+	// The data field is created in fontInfo() above. For CID-keyed fonts it
+	// also contains the FDSelect and the FDArray with the private dicts and
+	// local subrs of each font DICT.
 	_, err = w.Write(cf.data)
 	if err != nil {
 		return err
@@ -237,24 +248,38 @@ func (c *CFF) WriteCFFData(w io.Writer) error {
 }
 
 // Subset changes the font so that only the given code points remain in the font. Subset must only be called once.
-func (c *CFF) Subset(codepoints []int) {
-	c.Font[c.Fontindex].Subset(c.globalSubrIndex, codepoints)
+func (c *CFF) Subset(codepoints []int) error {
+	globalSubrIndex, err := c.Font[c.Fontindex].Subset(c.globalSubrIndex, codepoints)
+	if err != nil {
+		return err
+	}
+	c.globalSubrIndex = globalSubrIndex
+	return nil
 }
 
 type fontinfo struct {
 	CharSetOffset     int
 	CharStringsOffset int
 	EncodingOffset    int
+	FDArrayOffset     int
+	FDSelectOffset    int
 	PrivateDictSize   int
 	PrivateDictOffset int
 }
 
-func (f *Font) fontInfo() (*fontinfo, error) {
+// fontInfo creates the data of the font that follows the global subr index.
+// The offsets in the returned fontinfo are relative to the start of the data
+// which starts at baselen in the CFF file.
+func (f *Font) fontInfo(baselen int) (*fontinfo, error) {
 	fi := &fontinfo{}
 	fi.CharSetOffset = 0
 	var b bytes.Buffer
 
-	for _, index := range []mainIndex{CharStringsIndex, CharSet, PrivateDict, LocalSubrsIndex} {
+	indexes := []mainIndex{CharStringsIndex, CharSet, PrivateDict, LocalSubrsIndex}
+	if f.IsCIDFont() {
+		indexes = []mainIndex{CharStringsIndex, CharSet}
+	}
+	for _, index := range indexes {
 		switch index {
 		case CharSet:
 			fi.CharSetOffset = b.Len()
@@ -275,10 +300,86 @@ func (f *Font) fontInfo() (*fontinfo, error) {
 		}
 
 	}
+	if f.IsCIDFont() {
+		fi.FDSelectOffset = b.Len()
+		if _, err := f.writeFDSelect(&b); err != nil {
+			return nil, err
+		}
+		fi.FDArrayOffset = b.Len()
+		if err := f.writeFDArray(&b, baselen); err != nil {
+			return nil, err
+		}
+	}
 	f.data = b.Bytes()
 	return fi, nil
 }
 
+// writeFDArray writes the FDArray index followed by the private dict and the
+// local subrs of each font DICT. The FDArray index starts at the current
+// length of b which is at baselen+b.Len() in the CFF file.
+func (f *Font) writeFDArray(b *bytes.Buffer, baselen int) error {
+	// The position of the private dicts depends on the length of the FDArray
+	// index, which depends on the encoded private dict offsets.
+	var privateData bytes.Buffer
+	var fdArray bytes.Buffer
+	fdArrayOffset := baselen + b.Len()
+	fdArrayLen := 0
+	for {
+		privateData.Reset()
+		fdArray.Reset()
+		dicts := make([][]byte, len(f.fdFonts))
+		for i, fd := range f.fdFonts {
+			fd.privatedictoffset = int64(fdArrayOffset + fdArrayLen + privateData.Len())
+			l, err := fd.writePrivateDict(&privateData)
+			if err != nil {
+				return err
+			}
+			fd.privatedictsize = l
+			if _, err = fd.writeLocalSubrsIndex(&privateData); err != nil {
+				return err
+			}
+			dicts[i] = fd.cffEncodeFontDict()
+		}
+		if _, err := writeIndexData(&fdArray, dicts, "FDArray"); err != nil {
+			return err
+		}
+		if fdArray.Len() == fdArrayLen {
+			break
+		}
+		fdArrayLen = fdArray.Len()
+	}
+	b.Write(fdArray.Bytes())
+	b.Write(privateData.Bytes())
+	return nil
+}
+
+// writeFDSelect writes the font DICT index of each glyph in FDSelect format 3.
+func (f *Font) writeFDSelect(w io.Writer) (int, error) {
+	type fdRange struct {
+		First uint16
+		FD    uint8
+	}
+	var ranges []fdRange
+	for gid := 0; gid < len(f.CharStrings); gid++ {
+		if len(ranges) == 0 || ranges[len(ranges)-1].FD != f.fdIndex[gid] {
+			ranges = append(ranges, fdRange{First: uint16(gid), FD: f.fdIndex[gid]})
+		}
+	}
+	if err := write(w, uint8(3)); err != nil {
+		return 0, err
+	}
+	if err := write(w, uint16(len(ranges))); err != nil {
+		return 0, err
+	}
+	if err := write(w, ranges); err != nil {
+		return 0, err
+	}
+	if err := write(w, uint16(len(f.CharStrings))); err != nil {
+		return 0, err
+	}
+	return 5 + 3*len(ranges), nil
+}
+
 // cffDictEncodeFloat encodes a number. If the number is an integer number, it will be encoded by cffDictEncodeNumber().
 func cffDictEncodeFloat(num float64) []byte {
 	if math.Abs(float64(int(num))-num) < 0.0001 {
@@ -367,6 +468,13 @@ func cffDictEncodeNumber(num int64) []byte {
 // cffEncodeTopDict returns a byte slice of the encoded dictionary
 func (f *Font) cffEncodeTopDict() []byte {
 	var b []byte
+	if f.IsCIDFont() {
+		// ROS must be the first operator of a CID-keyed font
+		b = append(b, cffDictEncodeNumber(int64(f.registry))...)
+		b = append(b, cffDictEncodeNumber(int64(f.ordering))...)
+		b = append(b, cffDictEncodeNumber(int64(f.supplement))...)
+		b = append(b, 12, 30)
+	}
 	if i := f.version; i != 0 {
 		b = append(b, cffDictEncodeNumber(int64(i))...)
 		b = append(b, 0)
@@ -402,6 +510,7 @@ func (f *Font) cffEncodeTopDict() []byte {
 		b = append(b, cffDictEncodeNumber(int64(f.bbox[3]))...)
 		b = append(b, 5)
 	}
+	b = append(b, f.cffEncodeFontMatrix()...)
 	if num := f.underlinePosition; num != -100 {
 		b = append(b, cffDictEncodeFloat(num)...)
 		b = append(b, 12, 3)
@@ -422,69 +531,119 @@ func (f *Font) cffEncodeTopDict() []byte {
 		b = append(b, cffDictEncodeNumber(int64(num))...)
 		b = append(b, 17)
 	}
-	if num := f.privatedictoffset; num != 0 {
+	if num := f.privatedictoffset; num != 0 && !f.IsCIDFont() {
 		b = append(b, cffDictEncodeNumber(int64(f.privatedictsize))...)
 		b = append(b, cffDictEncodeNumber(int64(num))...)
 		b = append(b, 18)
 	}
+	if f.IsCIDFont() {
+		if num := f.cidcount; num != 0 && num != 8720 {
+			b = append(b, cffDictEncodeNumber(int64(num))...)
+			b = append(b, 12, 34)
+		}
+		b = append(b, cffDictEncodeNumber(f.fdarray)...)
+		b = append(b, 12, 36)
+		b = append(b, cffDictEncodeNumber(f.fdselect)...)
+		b = append(b, 12, 37)
+	}
+	return b
+}
+
+// cffEncodeFontMatrix returns the encoded font matrix or nil if the font has
+// no font matrix.
+func (f *Font) cffEncodeFontMatrix() []byte {
+	if len(f.fontMatrix) != 6 {
+		return nil
+	}
+	var b []byte
+	for _, v := range f.fontMatrix {
+		b = append(b, cffDictEncodeFloat(v)...)
+	}
+	return append(b, 12, 7)
+}
+
+// cffEncodeFontDict returns a byte slice of the encoded font DICT of a
+// CID-keyed font's FDArray.
+func (f *Font) cffEncodeFontDict() []byte {
+	var b []byte
+	if i := f.name; i != 0 {
+		b = append(b, cffDictEncodeNumber(int64(i))...)
+		b = append(b, 12, 38)
+	}
+	b = append(b, f.cffEncodeFontMatrix()...)
+	b = append(b, cffDictEncodeNumber(int64(f.privatedictsize))...)
+	b = append(b, cffDictEncodeNumber(f.privatedictoffset)...)
+	b = append(b, 18)
 	return b
 }
 
-// cffEncodePrivateDict returns a byte slice of the encoded dictionary
+// cffEncodeDictArray returns the encoded numbers followed by the operator.
+func cffEncodeDictArray(values []float64, op ...byte) []byte {
+	var b []byte
+	for _, v := range values {
+		b = append(b, cffDictEncodeFloat(v)...)
+	}
+	return append(b, op...)
+}
+
+// cffEncodePrivateDict returns a byte slice of the encoded dictionary. The
+// local subrs must be written directly after the private dict.
 func (f *Font) cffEncodePrivateDict() []byte {
 	var b []byte
 	if len(f.bluevalues) > 0 {
-		for _, v := range f.bluevalues {
-			b = append(b, cffDictEncodeNumber(int64(v))...)
-		}
-		b = append(b, 6)
+		b = append(b, cffEncodeDictArray(f.bluevalues, 6)...)
 	}
 	if len(f.otherblues) > 0 {
-		for _, v := range f.otherblues {
-			b = append(b, cffDictEncodeNumber(int64(v))...)
-		}
-		b = append(b, 7)
+		b = append(b, cffEncodeDictArray(f.otherblues, 7)...)
 	}
 	if len(f.familyblues) > 0 {
-		for _, v := range f.familyblues {
-			b = append(b, cffDictEncodeNumber(int64(v))...)
-		}
-		b = append(b, 8)
+		b = append(b, cffEncodeDictArray(f.familyblues, 8)...)
 	}
 	if len(f.familyotherblues) > 0 {
-		for _, v := range f.familyotherblues {
-			b = append(b, cffDictEncodeNumber(int64(v))...)
-		}
-		b = append(b, 9)
+		b = append(b, cffEncodeDictArray(f.familyotherblues, 9)...)
 	}
 
 	if num := f.bluescale; num != 0.039625 {
 		b = append(b, cffDictEncodeFloat(num)...)
 		b = append(b, 12, 9)
 	}
+	if num := f.blueshift; num != 7 {
+		b = append(b, cffDictEncodeFloat(num)...)
+		b = append(b, 12, 10)
+	}
 	if num := f.bluefuzz; num != 1 {
-		b = append(b, cffDictEncodeFloat(float64(f.bluefuzz))...)
+		b = append(b, cffDictEncodeFloat(num)...)
 		b = append(b, 12, 11)
 	}
 	if num := f.stdhw; num != 0 {
-		b = append(b, cffDictEncodeFloat(float64(f.stdhw))...)
+		b = append(b, cffDictEncodeFloat(num)...)
 		b = append(b, 10)
 	}
 	if num := f.stdvw; num != 0 {
-		b = append(b, cffDictEncodeFloat(float64(f.stdvw))...)
+		b = append(b, cffDictEncodeFloat(num)...)
 		b = append(b, 11)
 	}
 	if len(f.stemsnaph) > 0 {
-		for _, v := range f.stemsnaph {
-			b = append(b, cffDictEncodeNumber(int64(v))...)
-		}
-		b = append(b, 12, 12)
+		b = append(b, cffEncodeDictArray(f.stemsnaph, 12, 12)...)
 	}
 	if len(f.stemsnapv) > 0 {
-		for _, v := range f.stemsnapv {
-			b = append(b, cffDictEncodeNumber(int64(v))...)
-		}
-		b = append(b, 12, 13)
+		b = append(b, cffEncodeDictArray(f.stemsnapv, 12, 13)...)
+	}
+	if f.forceBold {
+		b = append(b, cffDictEncodeNumber(1)...)
+		b = append(b, 12, 14)
+	}
+	if num := f.languageGroup; num != 0 {
+		b = append(b, cffDictEncodeNumber(int64(num))...)
+		b = append(b, 12, 17)
+	}
+	if num := f.expansionFactor; num != 0.06 {
+		b = append(b, cffDictEncodeFloat(num)...)
+		b = append(b, 12, 18)
+	}
+	if num := f.initialRandomSeed; num != 0 {
+		b = append(b, cffDictEncodeNumber(int64(num))...)
+		b = append(b, 12, 19)
 	}
 	if num := f.defaultWidthX; num != 0 {
 		b = append(b, cffDictEncodeFloat(float64(num))...)
@@ -495,7 +654,13 @@ func (f *Font) cffEncodePrivateDict() []byte {
 		b = append(b, 21)
 	}
 	if len(f.subrsIndex) > 0 {
-		b = append(b, cffDictEncodeNumber(int64(len(b)+2))...)
+		// The subrs offset is relative to the start of the private dict and
+		// points to the end of the dict, so it includes its own encoding.
+		offset := len(b) + 2
+		for len(b)+len(cffDictEncodeNumber(int64(offset)))+1 != offset {
+			offset = len(b) + len(cffDictEncodeNumber(int64(offset))) + 1
+		}
+		b = append(b, cffDictEncodeNumber(int64(offset))...)
 		b = append(b, 19)
 	}
 	return b
@@ -520,43 +685,36 @@ func (f *Font) writeCharSet(w io.Writer) (int, error) {
 			}
 		}
 		return 1 + (len(f.CharStrings)-1)*2, nil
-	case 1:
-		var sid uint16
+	case 1, 2:
+		// ranges of consecutive SIDs (or CIDs), nLeft is one byte in format 1
+		// and two bytes in format 2
+		maxLeft := 0xff
+		if f.charsetFormat == 2 {
+			maxLeft = 0xffff
+		}
 		c := 1
-		cur := 0
-		i := 1
-
 		// f.charset[0] is notdef, we skip that
-		cs := f.charset[1:]
-		for {
-			sid = uint16(cs[cur])
-			if err = write(w, sid); err != nil {
+		cs := f.charset[1:len(f.CharStrings)]
+		for cur := 0; cur < len(cs); {
+			nLeft := 0
+			for cur+nLeft+1 < len(cs) && cs[cur+nLeft+1] == cs[cur]+SID(nLeft+1) && nLeft < maxLeft {
+				nLeft++
+			}
+			if err = write(w, uint16(cs[cur])); err != nil {
 				return 0, err
 			}
-			c += 2
-			glyphsLeft := uint8(0)
-		inner:
-			for {
-				// glyphsLeft is uint8, we need to check < 255
-				if cur+i < len(cs) && cs[cur+i] == SID(sid)+SID(i) && glyphsLeft < 255 {
-					glyphsLeft++
-					i++
-				} else {
-					if err = write(w, glyphsLeft); err != nil {
-						return 0, err
-					}
-					c++
-					cur = cur + i
-					i = 1
-					break inner
-				}
+			if f.charsetFormat == 1 {
+				err = write(w, uint8(nLeft))
+				c += 3
+			} else {
+				err = write(w, uint16(nLeft))
+				c += 4
 			}
-
-			if cur >= len(cs) {
-				break
+			if err != nil {
+				return 0, err
 			}
+			cur += nLeft + 1
 		}
-
 		return c, nil
 	}
 	return 0, nil
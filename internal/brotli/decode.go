@@ -0,0 +1,682 @@
+// Package brotli implements a decoder and a simple encoder for the Brotli
+// compressed data format as described in RFC 7932. It is used for WOFF2
+// fonts and has no dependencies outside of the standard library.
+package brotli
+
+import (
+	"errors"
+)
+
+var (
+	errCorrupt       = errors.New("brotli: corrupt input")
+	errUnexpectedEOF = errors.New("brotli: unexpected end of input")
+)
+
+type bitReader struct {
+	src   []byte
+	pos   int
+	val   uint64
+	nbits uint
+}
+
+func (br *bitReader) readBits(n uint) int {
+	for br.nbits < n {
+		if br.pos >= len(br.src) {
+			panic(errUnexpectedEOF)
+		}
+		br.val |= uint64(br.src[br.pos]) << br.nbits
+		br.pos++
+		br.nbits += 8
+	}
+	v := int(br.val & (1<<n - 1))
+	br.val >>= n
+	br.nbits -= n
+	return v
+}
+
+// alignToByte skips the bits up to the next byte boundary. These bits must
+// be zero.
+func (br *bitReader) alignToByte() {
+	if br.readBits(br.nbits%8) != 0 {
+		panic(errCorrupt)
+	}
+}
+
+// huffman is a canonical prefix code.
+type huffman struct {
+	count  [16]uint16 // number of codes of each length
+	symbol []uint16   // symbols ordered by code
+	single int        // the only symbol of a code with zero bits, or -1
+}
+
+// newHuffman creates the canonical prefix code for the code lengths.
+func newHuffman(lengths []uint8) *huffman {
+	h := &huffman{single: -1}
+	nonzero := 0
+	for sym, l := range lengths {
+		if l > 0 {
+			h.count[l]++
+			nonzero++
+			h.single = sym
+		}
+	}
+	if nonzero != 1 {
+		h.single = -1
+	}
+	var offsets [16]uint16
+	for l := 1; l < 15; l++ {
+		offsets[l+1] = offsets[l] + h.count[l]
+	}
+	h.symbol = make([]uint16, nonzero)
+	for sym, l := range lengths {
+		if l > 0 {
+			h.symbol[offsets[l]] = uint16(sym)
+			offsets[l]++
+		}
+	}
+	return h
+}
+
+// decode reads one symbol from br.
+func (h *huffman) decode(br *bitReader) int {
+	if h.single >= 0 {
+		return h.single
+	}
+	code, first, index := 0, 0, 0
+	for l := 1; l <= 15; l++ {
+		code |= br.readBits(1)
+		count := int(h.count[l])
+		if code-count < first {
+			return int(h.symbol[index+code-first])
+		}
+		index += count
+		first += count
+		first <<= 1
+		code <<= 1
+	}
+	panic(errCorrupt)
+}
+
+// alphabetBits returns the number of bits needed to store a symbol of the
+// alphabet with the given size.
+func alphabetBits(size int) uint {
+	n := uint(0)
+	for (1 << n) < size {
+		n++
+	}
+	return n
+}
+
+var codeLengthCodeOrder = [18]int{1, 2, 3, 4, 0, 5, 17, 6, 16, 7, 8, 9, 10, 11, 12, 13, 14, 15}
+
+// readCodeLengthCodeLength reads a code length code length with the static
+// variable length code from RFC 7932, section 3.5.
+func readCodeLengthCodeLength(br *bitReader) uint8 {
+	switch br.readBits(2) {
+	case 0:
+		return 0
+	case 1:
+		return 4
+	case 2:
+		return 3
+	}
+	if br.readBits(1) == 0 {
+		return 2
+	}
+	if br.readBits(1) == 0 {
+		return 1
+	}
+	return 5
+}
+
+// readPrefixCode reads a simple or a complex prefix code for an alphabet with
+// the given size (RFC 7932, section 3.4 and 3.5).
+func readPrefixCode(br *bitReader, alphabetSize int) *huffman {
+	lengths := make([]uint8, alphabetSize)
+	hskip := br.readBits(2)
+	if hskip == 1 {
+		// simple prefix code
+		nsym := br.readBits(2) + 1
+		bits := alphabetBits(alphabetSize)
+		symbols := make([]int, nsym)
+		for i := range symbols {
+			symbols[i] = br.readBits(bits)
+			if symbols[i] >= alphabetSize {
+				panic(errCorrupt)
+			}
+			for j := 0; j < i; j++ {
+				if symbols[j] == symbols[i] {
+					panic(errCorrupt)
+				}
+			}
+		}
+		switch nsym {
+		case 1:
+			return &huffman{single: symbols[0]}
+		case 2:
+			lengths[symbols[0]] = 1
+			lengths[symbols[1]] = 1
+		case 3:
+			lengths[symbols[0]] = 1
+			lengths[symbols[1]] = 2
+			lengths[symbols[2]] = 2
+		case 4:
+			if br.readBits(1) == 0 {
+				for _, s := range symbols {
+					lengths[s] = 2
+				}
+			} else {
+				lengths[symbols[0]] = 1
+				lengths[symbols[1]] = 2
+				lengths[symbols[2]] = 3
+				lengths[symbols[3]] = 3
+			}
+		}
+		return newHuffman(lengths)
+	}
+
+	// complex prefix code
+	var clLengths [18]uint8
+	space := 32
+	numCodes := 0
+	for i := hskip; i < 18; i++ {
+		l := readCodeLengthCodeLength(br)
+		clLengths[codeLengthCodeOrder[i]] = l
+		if l != 0 {
+			space -= 32 >> l
+			numCodes++
+			if space <= 0 {
+				break
+			}
+		}
+	}
+	if numCodes != 1 && space != 0 {
+		panic(errCorrupt)
+	}
+	clCode := newHuffman(clLengths[:])
+
+	symbol := 0
+	prevCodeLen := uint8(8)
+	repeat := 0
+	repeatCodeLen := uint8(0)
+	space = 32768
+	for symbol < alphabetSize && space > 0 {
+		p := clCode.decode(br)
+		if p < 16 {
+			repeat = 0
+			lengths[symbol] = uint8(p)
+			if p != 0 {
+				prevCodeLen = uint8(p)
+				space -= 32768 >> p
+			}
+			symbol++
+			continue
+		}
+		extraBits := uint(3)
+		newLen := uint8(0)
+		if p == 16 {
+			extraBits = 2
+			newLen = prevCodeLen
+		}
+		if repeatCodeLen != newLen {
+			repeat = 0
+			repeatCodeLen = newLen
+		}
+		oldRepeat := repeat
+		if repeat > 0 {
+			repeat -= 2
+			repeat <<= extraBits
+		}
+		repeat += br.readBits(extraBits) + 3
+		delta := repeat - oldRepeat
+		if symbol+delta > alphabetSize {
+			panic(errCorrupt)
+		}
+		for i := 0; i < delta; i++ {
+			lengths[symbol] = repeatCodeLen
+			symbol++
+		}
+		if repeatCodeLen != 0 {
+			space -= delta * (32768 >> repeatCodeLen)
+		}
+	}
+	if space != 0 {
+		panic(errCorrupt)
+	}
+	return newHuffman(lengths)
+}
+
+// readVarLenUint8 reads a number in the range 0-255.
+func readVarLenUint8(br *bitReader) int {
+	if br.readBits(1) == 0 {
+		return 0
+	}
+	n := uint(br.readBits(3))
+	if n == 0 {
+		return 1
+	}
+	return 1<<n + br.readBits(n)
+}
+
+var blockLengthBase = [26]int{1, 5, 9, 13, 17, 25, 33, 41, 49, 65, 81, 97, 113, 145, 177, 209, 241, 305, 369, 497, 753, 1265, 2289, 4337, 8433, 16625}
+var blockLengthExtra = [26]uint{2, 2, 2, 2, 3, 3, 3, 3, 4, 4, 4, 4, 5, 5, 5, 5, 6, 6, 7, 8, 9, 10, 11, 12, 13, 24}
+
+var insertLengthBase = [24]int{0, 1, 2, 3, 4, 5, 6, 8, 10, 14, 18, 26, 34, 50, 66, 98, 130, 194, 322, 578, 1090, 2114, 6210, 22594}
+var insertLengthExtra = [24]uint{0, 0, 0, 0, 0, 0, 1, 1, 2, 2, 3, 3, 4, 4, 5, 5, 6, 7, 8, 9, 10, 12, 14, 24}
+
+var copyLengthBase = [24]int{2, 3, 4, 5, 6, 7, 8, 9, 10, 12, 14, 18, 22, 30, 38, 54, 70, 102, 134, 198, 326, 582, 1094, 2118}
+var copyLengthExtra = [24]uint{0, 0, 0, 0, 0, 0, 0, 0, 1, 1, 2, 2, 3, 3, 4, 4, 5, 5, 6, 7, 8, 9, 10, 24}
+
+// distanceDelta is added to the last or second to last distance for the
+// distance codes 4-15.
+var distanceDelta = [6]int{-1, 1, -2, 2, -3, 3}
+
+// The insert and copy length code ranges for each 64 insert-and-copy codes.
+var insertRangeBase = [11]int{0, 0, 0, 0, 8, 8, 0, 16, 8, 16, 16}
+var copyRangeBase = [11]int{0, 8, 0, 8, 0, 8, 16, 0, 16, 8, 16}
+
+func readBlockLength(br *bitReader, code *huffman) int {
+	sym := code.decode(br)
+	return blockLengthBase[sym] + br.readBits(blockLengthExtra[sym])
+}
+
+// blockSwitch holds the block type state for one of the three categories
+// literals, insert-and-copy lengths and distances.
+type blockSwitch struct {
+	numTypes   int
+	typeCode   *huffman
+	lengthCode *huffman
+	typ        int
+	prevType   int
+	length     int
+}
+
+func readBlockSwitch(br *bitReader) *blockSwitch {
+	bs := &blockSwitch{prevType: 1, length: 1 << 24}
+	bs.numTypes = readVarLenUint8(br) + 1
+	if bs.numTypes >= 2 {
+		bs.typeCode = readPrefixCode(br, bs.numTypes+2)
+		bs.lengthCode = readPrefixCode(br, 26)
+		bs.length = readBlockLength(br, bs.lengthCode)
+	}
+	return bs
+}
+
+// next decrements the block length and switches to the next block type if
+// necessary.
+func (bs *blockSwitch) next(br *bitReader) {
+	if bs.length == 0 {
+		t := bs.typeCode.decode(br)
+		switch t {
+		case 0:
+			t = bs.prevType
+		case 1:
+			t = bs.typ + 1
+		default:
+			t -= 2
+		}
+		if t >= bs.numTypes {
+			t -= bs.numTypes
+		}
+		bs.prevType = bs.typ
+		bs.typ = t
+		bs.length = readBlockLength(br, bs.lengthCode)
+	}
+	bs.length--
+}
+
+// readContextMap reads a context map of the given size (RFC 7932, section 7.3).
+func readContextMap(br *bitReader, size int, numTrees int) []uint8 {
+	cmap := make([]uint8, size)
+	if numTrees < 2 {
+		return cmap
+	}
+	rlemax := 0
+	if br.readBits(1) == 1 {
+		rlemax = br.readBits(4) + 1
+	}
+	code := readPrefixCode(br, numTrees+rlemax)
+	for i := 0; i < size; {
+		sym := code.decode(br)
+		switch {
+		case sym == 0:
+			cmap[i] = 0
+			i++
+		case sym <= rlemax:
+			run := 1<<uint(sym) + br.readBits(uint(sym))
+			if i+run > size {
+				panic(errCorrupt)
+			}
+			for j := 0; j < run; j++ {
+				cmap[i] = 0
+				i++
+			}
+		default:
+			cmap[i] = uint8(sym - rlemax)
+			i++
+		}
+	}
+	if br.readBits(1) == 1 {
+		// inverse move to front transform
+		var mtf [256]uint8
+		for i := range mtf {
+			mtf[i] = uint8(i)
+		}
+		for i, v := range cmap {
+			val := mtf[v]
+			cmap[i] = val
+			copy(mtf[1:v+1], mtf[:v])
+			mtf[0] = val
+		}
+	}
+	return cmap
+}
+
+// Context modes for literals.
+const (
+	contextLSB6 = iota
+	contextMSB6
+	contextUTF8
+	contextSigned
+)
+
+func literalContext(mode int, p1, p2 byte) int {
+	switch mode {
+	case contextLSB6:
+		return int(p1 & 0x3f)
+	case contextMSB6:
+		return int(p1 >> 2)
+	case contextUTF8:
+		return int(contextLut0[p1] | contextLut1[p2])
+	}
+	return int(contextLut2[p1]<<3 | contextLut2[p2])
+}
+
+// Decode decompresses the Brotli stream src.
+func Decode(src []byte) (dst []byte, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			if e, ok := r.(error); ok && (e == errCorrupt || e == errUnexpectedEOF) {
+				dst = nil
+				err = e
+				return
+			}
+			panic(r)
+		}
+	}()
+	return decode(src), nil
+}
+
+func decode(src []byte) []byte {
+	br := &bitReader{src: src}
+	var dst []byte
+
+	// stream header
+	wbits := 16
+	if br.readBits(1) == 1 {
+		if n := br.readBits(3); n != 0 {
+			wbits = 17 + n
+		} else if n = br.readBits(3); n == 1 {
+			// large window brotli is not supported
+			panic(errCorrupt)
+		} else if n != 0 {
+			wbits = 8 + n
+		} else {
+			wbits = 17
+		}
+	}
+	maxBackwardDistance := 1<<uint(wbits) - 16
+	distRB := [4]int{16, 15, 11, 4}
+	distRBIdx := 0
+
+	for {
+		// meta-block header
+		isLast := br.readBits(1) == 1
+		if isLast && br.readBits(1) == 1 {
+			// ISLASTEMPTY
+			break
+		}
+		mnibbles := br.readBits(2) + 4
+		if mnibbles == 7 {
+			// metadata, skip
+			if br.readBits(1) != 0 {
+				panic(errCorrupt)
+			}
+			mskipbytes := uint(br.readBits(2))
+			mskiplen := 0
+			for i := uint(0); i < mskipbytes; i++ {
+				b := br.readBits(8)
+				if i+1 == mskipbytes && mskipbytes > 1 && b == 0 {
+					panic(errCorrupt)
+				}
+				mskiplen |= b << (8 * i)
+			}
+			if mskipbytes > 0 {
+				mskiplen++
+			}
+			br.alignToByte()
+			for i := 0; i < mskiplen; i++ {
+				br.readBits(8)
+			}
+			if isLast {
+				break
+			}
+			continue
+		}
+		mlen := 0
+		for i := 0; i < mnibbles; i++ {
+			nibble := br.readBits(4)
+			if i+1 == mnibbles && mnibbles > 4 && nibble == 0 {
+				panic(errCorrupt)
+			}
+			mlen |= nibble << uint(4*i)
+		}
+		mlen++
+		if !isLast && br.readBits(1) == 1 {
+			// uncompressed meta-block
+			br.alignToByte()
+			for i := 0; i < mlen; i++ {
+				dst = append(dst, byte(br.readBits(8)))
+			}
+			continue
+		}
+
+		literalSwitch := readBlockSwitch(br)
+		commandSwitch := readBlockSwitch(br)
+		distanceSwitch := readBlockSwitch(br)
+		npostfix := uint(br.readBits(2))
+		ndirect := br.readBits(4) << npostfix
+		contextModes := make([]int, literalSwitch.numTypes)
+		for i := range contextModes {
+			contextModes[i] = br.readBits(2)
+		}
+		numTreesL := readVarLenUint8(br) + 1
+		contextMapL := readContextMap(br, 64*literalSwitch.numTypes, numTreesL)
+		numTreesD := readVarLenUint8(br) + 1
+		contextMapD := readContextMap(br, 4*distanceSwitch.numTypes, numTreesD)
+
+		literalCodes := make([]*huffman, numTreesL)
+		for i := range literalCodes {
+			literalCodes[i] = readPrefixCode(br, 256)
+		}
+		commandCodes := make([]*huffman, commandSwitch.numTypes)
+		for i := range commandCodes {
+			commandCodes[i] = readPrefixCode(br, 704)
+		}
+		distanceCodes := make([]*huffman, numTreesD)
+		for i := range distanceCodes {
+			distanceCodes[i] = readPrefixCode(br, 16+ndirect+48<<npostfix)
+		}
+
+		end := len(dst) + mlen
+		for len(dst) < end {
+			commandSwitch.next(br)
+			cmd := commandCodes[commandSwitch.typ].decode(br)
+			rangeIdx := cmd >> 6
+			insertCode := insertRangeBase[rangeIdx] + (cmd>>3)&7
+			copyCode := copyRangeBase[rangeIdx] + cmd&7
+			insertLen := insertLengthBase[insertCode] + br.readBits(insertLengthExtra[insertCode])
+			copyLen := copyLengthBase[copyCode] + br.readBits(copyLengthExtra[copyCode])
+
+			for i := 0; i < insertLen; i++ {
+				literalSwitch.next(br)
+				var p1, p2 byte
+				if l := len(dst); l > 1 {
+					p1, p2 = dst[l-1], dst[l-2]
+				} else if l == 1 {
+					p1 = dst[0]
+				}
+				ctx := literalContext(contextModes[literalSwitch.typ], p1, p2)
+				tree := contextMapL[64*literalSwitch.typ+ctx]
+				dst = append(dst, byte(literalCodes[tree].decode(br)))
+			}
+			if len(dst) >= end {
+				break
+			}
+
+			var distance int
+			dcode := 0
+			if cmd >= 128 {
+				distanceSwitch.next(br)
+				ctx := 3
+				if copyLen <= 4 {
+					ctx = copyLen - 2
+				}
+				tree := contextMapD[4*distanceSwitch.typ+ctx]
+				dcode = distanceCodes[tree].decode(br)
+			}
+			switch {
+			case dcode < 16:
+				last := distRB[(distRBIdx+3)&3]
+				secondLast := distRB[(distRBIdx+2)&3]
+				switch dcode {
+				case 0:
+					distance = last
+				case 1:
+					distance = secondLast
+				case 2:
+					distance = distRB[(distRBIdx+1)&3]
+				case 3:
+					distance = distRB[distRBIdx&3]
+				default:
+					base := last
+					if dcode >= 10 {
+						base = secondLast
+					}
+					distance = base + distanceDelta[(dcode-4)%6]
+				}
+				if distance <= 0 {
+					panic(errCorrupt)
+				}
+			case dcode < 16+ndirect:
+				distance = dcode - 15
+			default:
+				d := dcode - ndirect - 16
+				ndistbits := uint(1 + d>>(npostfix+1))
+				hcode := d >> npostfix
+				lcode := d & (1<<npostfix - 1)
+				offset := (2+hcode&1)<<ndistbits - 4
+				distance = (offset+br.readBits(ndistbits))<<npostfix + lcode + ndirect + 1
+			}
+
+			maxDistance := maxBackwardDistance
+			if len(dst) < maxDistance {
+				maxDistance = len(dst)
+			}
+			if distance > maxDistance {
+				// static dictionary reference
+				if copyLen < minDictionaryWordLength || copyLen > maxDictionaryWordLength {
+					panic(errCorrupt)
+				}
+				wordID := distance - maxDistance - 1
+				nbits := ndbits[copyLen]
+				index := wordID & (1<<nbits - 1)
+				transformID := wordID >> nbits
+				if transformID >= len(transforms) {
+					panic(errCorrupt)
+				}
+				start := doffset[copyLen] + index*copyLen
+				dst = transformWord(dst, dictionary[start:start+copyLen], transformID)
+				if len(dst) > end {
+					panic(errCorrupt)
+				}
+				continue
+			}
+			if dcode != 0 {
+				distRB[distRBIdx&3] = distance
+				distRBIdx++
+			}
+			if len(dst)+copyLen > end {
+				panic(errCorrupt)
+			}
+			pos := len(dst) - distance
+			for i := 0; i < copyLen; i++ {
+				dst = append(dst, dst[pos+i])
+			}
+		}
+		if len(dst) != end {
+			panic(errCorrupt)
+		}
+		if isLast {
+			break
+		}
+	}
+	return dst
+}
+
+var contextLut0 = [256]uint8{
+	0, 0, 0, 0, 0, 0, 0, 0, 0, 4, 4, 0, 0, 4, 0, 0,
+	0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+	8, 12, 16, 12, 12, 20, 12, 16, 24, 28, 12, 12, 32, 12, 36, 12,
+	44, 44, 44, 44, 44, 44, 44, 44, 44, 44, 32, 32, 24, 40, 28, 12,
+	12, 48, 52, 52, 52, 48, 52, 52, 52, 48, 52, 52, 52, 52, 52, 48,
+	52, 52, 52, 52, 52, 48, 52, 52, 52, 52, 52, 24, 12, 28, 12, 12,
+	12, 56, 60, 60, 60, 56, 60, 60, 60, 56, 60, 60, 60, 60, 60, 56,
+	60, 60, 60, 60, 60, 56, 60, 60, 60, 60, 60, 24, 12, 28, 12, 0,
+	0, 1, 0, 1, 0, 1, 0, 1, 0, 1, 0, 1, 0, 1, 0, 1,
+	0, 1, 0, 1, 0, 1, 0, 1, 0, 1, 0, 1, 0, 1, 0, 1,
+	0, 1, 0, 1, 0, 1, 0, 1, 0, 1, 0, 1, 0, 1, 0, 1,
+	0, 1, 0, 1, 0, 1, 0, 1, 0, 1, 0, 1, 0, 1, 0, 1,
+	2, 3, 2, 3, 2, 3, 2, 3, 2, 3, 2, 3, 2, 3, 2, 3,
+	2, 3, 2, 3, 2, 3, 2, 3, 2, 3, 2, 3, 2, 3, 2, 3,
+	2, 3, 2, 3, 2, 3, 2, 3, 2, 3, 2, 3, 2, 3, 2, 3,
+	2, 3, 2, 3, 2, 3, 2, 3, 2, 3, 2, 3, 2, 3, 2, 3,
+}
+
+var contextLut1 = [256]uint8{
+	0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+	0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+	0, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1,
+	2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 1, 1, 1, 1, 1, 1,
+	1, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2,
+	2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 1, 1, 1, 1, 1,
+	1, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3,
+	3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 1, 1, 1, 1, 0,
+	0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+	0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+	0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+	0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+	0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+	0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0,
+	2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2,
+	2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2,
+}
+
+var contextLut2 = [256]uint8{
+	0, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1, 1,
+	2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2,
+	2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2,
+	2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2, 2,
+	3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3,
+	3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3,
+	3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3,
+	3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3, 3,
+	4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4,
+	4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4,
+	4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4,
+	4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4, 4,
+	5, 5, 5, 5, 5, 5, 5, 5, 5, 5, 5, 5, 5, 5, 5, 5,
+	5, 5, 5, 5, 5, 5, 5, 5, 5, 5, 5, 5, 5, 5, 5, 5,
+	5, 5, 5, 5, 5, 5, 5, 5, 5, 5, 5, 5, 5, 5, 5, 5,
+	6, 6, 6, 6, 6, 6, 6, 6, 6, 6, 6, 6, 6, 6, 6, 7,
+}
@@ -0,0 +1,61 @@
+package brotli
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"testing"
+)
+
+func TestDecode(t *testing.T) {
+	want := "Hello, hello, hello! The quick brown fox jumps over the lazy dog. The quick brown fox jumps over the lazy dog again."
+	// compressed with the reference encoder at quality 0, 5 and 11
+	data := []string{
+		"8b398048656c6c6f2c2068656c6c6f2c2068656c6c6f212054686520717569636b2062726f776e20666f78206a756d7073206f76657220746865206c617a7920646f672e2054686520717569636b2062726f776e20666f78206a756d7073206f76657220746865206c617a7920646f6720616761696e2e03",
+		"1b73000004e2b7bda99e5d2c59baa12813194f943f61030edccb70938d06e061636c3b96e0891f76acada984c2d544c897b0e599647969d75807b9d33ec6b8d6fdff11a518414a31",
+		"1b7300009c09762cc4b22925d84fa8a9c2d0de2499195b83b8cce5ed90333c3d8e71e0b07dbebfc94a7b8c6d6309c754f069754341334428cb74c279a4dff6b311c42903",
+	}
+	for i, h := range data {
+		src, err := hex.DecodeString(h)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := Decode(src)
+		if err != nil {
+			t.Errorf("stream %d: %s", i, err)
+			continue
+		}
+		if string(got) != want {
+			t.Errorf("stream %d: got %q, want %q", i, got, want)
+		}
+	}
+	// truncated stream
+	src, _ := hex.DecodeString(data[2])
+	if _, err := Decode(src[:len(src)/2]); err == nil {
+		t.Errorf("Decode(truncated) got no error")
+	}
+}
+
+func TestEncode(t *testing.T) {
+	var text []byte
+	for i := 0; i < 2000; i++ {
+		text = append(text, fmt.Sprintf("line %d: the quick brown fox jumps over the lazy dog %d\n", i, i*i%97)...)
+	}
+	random := make([]byte, 70000)
+	x := uint32(1)
+	for i := range random {
+		x = x*1103515245 + 12345
+		random[i] = byte(x >> 16)
+	}
+	for _, src := range [][]byte{nil, []byte("a"), []byte("abababababababababab"), text, random} {
+		enc := Encode(src)
+		got, err := Decode(enc)
+		if err != nil {
+			t.Errorf("Decode(Encode(%d bytes)): %s", len(src), err)
+			continue
+		}
+		if !bytes.Equal(got, src) {
+			t.Errorf("Decode(Encode(%d bytes)) differs from the input", len(src))
+		}
+	}
+}
@@ -0,0 +1,27 @@
+package brotli
+
+import (
+	_ "embed" // for the static dictionary
+)
+
+// dictionary is the static dictionary from RFC 7932, appendix A.
+//
+//go:embed dictionary.bin
+var dictionary []byte
+
+// ndbits is the number of bits of the word index for each word length.
+var ndbits = [25]uint{0, 0, 0, 0, 10, 10, 11, 11, 10, 10, 10, 10, 10, 9, 9, 8, 7, 7, 8, 7, 7, 6, 6, 5, 5}
+
+// doffset is the start of the words of each length in the dictionary.
+var doffset [25]int
+
+const (
+	minDictionaryWordLength = 4
+	maxDictionaryWordLength = 24
+)
+
+func init() {
+	for i := minDictionaryWordLength; i < maxDictionaryWordLength; i++ {
+		doffset[i+1] = doffset[i] + i<<ndbits[i]
+	}
+}
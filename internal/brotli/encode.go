@@ -0,0 +1,541 @@
+package brotli
+
+import (
+	"sort"
+)
+
+const (
+	encodeWindowBits  = 22
+	encodeMaxDistance = 1<<encodeWindowBits - 16
+	metaBlockSize     = 1 << 20
+	minMatchLength    = 4
+	maxMatchLength    = 1 << 16
+	maxChainLength    = 48
+	hashBits          = 16
+)
+
+type bitWriter struct {
+	dst   []byte
+	val   uint64
+	nbits uint
+}
+
+func (bw *bitWriter) writeBits(n uint, v uint64) {
+	bw.val |= v << bw.nbits
+	bw.nbits += n
+	for bw.nbits >= 8 {
+		bw.dst = append(bw.dst, byte(bw.val))
+		bw.val >>= 8
+		bw.nbits -= 8
+	}
+}
+
+// alignToByte writes zero bits up to the next byte boundary.
+func (bw *bitWriter) alignToByte() {
+	if bw.nbits > 0 {
+		bw.writeBits(8-bw.nbits, 0)
+	}
+}
+
+// prefixCode is a canonical prefix code used by the encoder.
+type prefixCode struct {
+	lengths []uint8
+	codes   []uint16 // bit reversed codes, ready to be written LSB first
+}
+
+// huffmanLengths returns the code lengths of a prefix code for the symbol
+// frequencies. No code is longer than maxBits.
+func huffmanLengths(freq []int, maxBits int) []uint8 {
+	lengths := make([]uint8, len(freq))
+	type node struct {
+		weight      int
+		left, right int // children, -1 for leaves
+		symbol      int
+	}
+	for countLimit := 1; ; countLimit *= 2 {
+		var nodes []node
+		for sym, f := range freq {
+			if f > 0 {
+				if f < countLimit {
+					f = countLimit
+				}
+				nodes = append(nodes, node{weight: f, left: -1, right: -1, symbol: sym})
+			}
+		}
+		if len(nodes) == 0 {
+			return lengths
+		}
+		if len(nodes) == 1 {
+			lengths[nodes[0].symbol] = 1
+			return lengths
+		}
+		sort.SliceStable(nodes, func(i, j int) bool { return nodes[i].weight < nodes[j].weight })
+		numLeaves := len(nodes)
+		// two queue construction: leaves in nodes[0:numLeaves], inner nodes
+		// appended in increasing weight order
+		leaf, inner := 0, numLeaves
+		pick := func() int {
+			if leaf < numLeaves && (inner >= len(nodes) || nodes[leaf].weight <= nodes[inner].weight) {
+				leaf++
+				return leaf - 1
+			}
+			inner++
+			return inner - 1
+		}
+		for i := 0; i < numLeaves-1; i++ {
+			a := pick()
+			b := pick()
+			nodes = append(nodes, node{weight: nodes[a].weight + nodes[b].weight, left: a, right: b})
+		}
+		depth := make([]int, len(nodes))
+		maxDepth := 0
+		for i := len(nodes) - 1; i >= numLeaves; i-- {
+			for _, c := range []int{nodes[i].left, nodes[i].right} {
+				depth[c] = depth[i] + 1
+				if depth[c] > maxDepth {
+					maxDepth = depth[c]
+				}
+			}
+		}
+		if maxDepth > maxBits {
+			continue
+		}
+		for i := 0; i < numLeaves; i++ {
+			lengths[nodes[i].symbol] = uint8(depth[i])
+		}
+		return lengths
+	}
+}
+
+// newPrefixCode assigns canonical codes to the code lengths.
+func newPrefixCode(lengths []uint8) *prefixCode {
+	pc := &prefixCode{lengths: lengths, codes: make([]uint16, len(lengths))}
+	var count, next [16]int
+	for _, l := range lengths {
+		count[l]++
+	}
+	count[0] = 0
+	code := 0
+	for l := 1; l < 16; l++ {
+		code = (code + count[l-1]) << 1
+		next[l] = code
+	}
+	for sym, l := range lengths {
+		if l == 0 {
+			continue
+		}
+		c := next[l]
+		next[l]++
+		rev := 0
+		for i := uint8(0); i < l; i++ {
+			rev = rev<<1 | c&1
+			c >>= 1
+		}
+		pc.codes[sym] = uint16(rev)
+	}
+	return pc
+}
+
+func (pc *prefixCode) write(bw *bitWriter, sym int) {
+	bw.writeBits(uint(pc.lengths[sym]), uint64(pc.codes[sym]))
+}
+
+// writeCodeLengthCodeLength writes a code length code length with the static
+// variable length code from RFC 7932, section 3.5.
+func writeCodeLengthCodeLength(bw *bitWriter, l uint8) {
+	switch l {
+	case 0:
+		bw.writeBits(2, 0)
+	case 4:
+		bw.writeBits(2, 1)
+	case 3:
+		bw.writeBits(2, 2)
+	case 2:
+		bw.writeBits(3, 3)
+	case 1:
+		bw.writeBits(4, 7)
+	default:
+		bw.writeBits(4, 15)
+	}
+}
+
+// buildPrefixCode creates a prefix code for the histogram and writes its
+// description to bw.
+func buildPrefixCode(bw *bitWriter, freq []int) *prefixCode {
+	lengths := huffmanLengths(freq, 15)
+	var symbols []int
+	for sym, l := range lengths {
+		if l > 0 {
+			symbols = append(symbols, sym)
+		}
+	}
+	if len(symbols) == 0 {
+		// unused alphabet, any symbol will do
+		symbols = append(symbols, 0)
+		lengths[0] = 1
+	}
+	if len(symbols) <= 4 {
+		// simple prefix code
+		sort.SliceStable(symbols, func(i, j int) bool { return lengths[symbols[i]] < lengths[symbols[j]] })
+		bw.writeBits(2, 1)
+		bw.writeBits(2, uint64(len(symbols)-1))
+		for _, sym := range symbols {
+			bw.writeBits(alphabetBits(len(freq)), uint64(sym))
+		}
+		if len(symbols) == 4 {
+			if lengths[symbols[0]] == 1 {
+				bw.writeBits(1, 1)
+			} else {
+				bw.writeBits(1, 0)
+			}
+		}
+		if len(symbols) == 1 {
+			lengths[symbols[0]] = 0
+		}
+		return newPrefixCode(lengths)
+	}
+
+	// complex prefix code, the code lengths are run length encoded
+	type token struct {
+		code  int
+		extra int
+	}
+	var tokens []token
+	last := len(lengths)
+	for last > 0 && lengths[last-1] == 0 {
+		last--
+	}
+	for i := 0; i < last; {
+		l := lengths[i]
+		run := 1
+		for i+run < last && lengths[i+run] == l {
+			run++
+		}
+		i += run
+		if l != 0 {
+			tokens = append(tokens, token{code: int(l)})
+			run--
+		}
+		// two repeat codes in a row have a different meaning, so they are
+		// separated by a literal code length
+		for run > 0 {
+			switch {
+			case l == 0 && run >= 3:
+				n := run
+				if n > 10 {
+					n = 10
+				}
+				tokens = append(tokens, token{code: 17, extra: n - 3})
+				run -= n
+			case l != 0 && run >= 3:
+				n := run
+				if n > 6 {
+					n = 6
+				}
+				tokens = append(tokens, token{code: 16, extra: n - 3})
+				run -= n
+			default:
+				tokens = append(tokens, token{code: int(l)})
+				run--
+				continue
+			}
+			if run > 0 {
+				tokens = append(tokens, token{code: int(l)})
+				run--
+			}
+		}
+	}
+	clFreq := make([]int, 18)
+	for _, t := range tokens {
+		clFreq[t.code]++
+	}
+	clLengths := huffmanLengths(clFreq, 5)
+	numCodes := 0
+	for _, l := range clLengths {
+		if l > 0 {
+			numCodes++
+		}
+	}
+	bw.writeBits(2, 0) // HSKIP
+	n := 18
+	if numCodes > 1 {
+		for n > 0 && clLengths[codeLengthCodeOrder[n-1]] == 0 {
+			n--
+		}
+	}
+	for i := 0; i < n; i++ {
+		writeCodeLengthCodeLength(bw, clLengths[codeLengthCodeOrder[i]])
+	}
+	if numCodes == 1 {
+		// a code with a single symbol uses zero bits
+		for i := range clLengths {
+			clLengths[i] = 0
+		}
+	}
+	clCode := newPrefixCode(clLengths)
+	for _, t := range tokens {
+		clCode.write(bw, t.code)
+		switch t.code {
+		case 16:
+			bw.writeBits(2, uint64(t.extra))
+		case 17:
+			bw.writeBits(3, uint64(t.extra))
+		}
+	}
+	return newPrefixCode(lengths)
+}
+
+// lengthCode returns the insert or copy length code for n and the value of
+// the extra bits.
+func lengthCode(base []int, n int) (int, int) {
+	code := len(base) - 1
+	for base[code] > n {
+		code--
+	}
+	return code, n - base[code]
+}
+
+// commandCode returns the insert-and-copy length code for the insert and copy
+// codes. If useLast is true and the combination allows it, the code implies
+// the last distance.
+func commandCode(insertCode, copyCode int, useLast bool) (int, bool) {
+	if useLast && insertCode < 8 && copyCode < 16 {
+		return (copyCode>>3)<<6 | insertCode<<3 | copyCode&7, true
+	}
+	for r := 2; r < len(insertRangeBase); r++ {
+		ib, cb := insertRangeBase[r], copyRangeBase[r]
+		if insertCode >= ib && insertCode < ib+8 && copyCode >= cb && copyCode < cb+8 {
+			return r<<6 | (insertCode-ib)<<3 | (copyCode - cb), false
+		}
+	}
+	panic("brotli: invalid length codes")
+}
+
+type command struct {
+	insertPos  int // start of the literals in src
+	insertLen  int
+	copyLen    int
+	distance   int
+	useLast    bool // the distance is the last distance
+	cmdCode    int
+	implicit   bool // the command code implies distance code 0
+	distCode   int
+	distExtra  int
+	distNBits  uint
+	insertCode int
+	copyCode   int
+}
+
+// distanceCode returns the distance code (with NPOSTFIX and NDIRECT set to 0)
+// for the distance, the extra bits and their count.
+func distanceCode(distance int) (int, int, uint) {
+	d := distance + 3
+	nbits := uint(0)
+	for d>>(nbits+2) != 0 {
+		nbits++
+	}
+	prefix := (d >> nbits) & 1
+	code := 16 + 2*(int(nbits)-1) + prefix
+	return code, d - (2+prefix)<<nbits, nbits
+}
+
+type matcher struct {
+	src  []byte
+	head []int32
+	prev []int32
+	mask int
+}
+
+func newMatcher(src []byte) *matcher {
+	size := 1
+	for size < len(src) && size < 1<<encodeWindowBits {
+		size <<= 1
+	}
+	m := &matcher{src: src, head: make([]int32, 1<<hashBits), prev: make([]int32, size), mask: size - 1}
+	for i := range m.head {
+		m.head[i] = -1
+	}
+	return m
+}
+
+func (m *matcher) hash(pos int) int {
+	v := uint32(m.src[pos]) | uint32(m.src[pos+1])<<8 | uint32(m.src[pos+2])<<16 | uint32(m.src[pos+3])<<24
+	return int((v * 0x1E35A7BD) >> (32 - hashBits))
+}
+
+func (m *matcher) insert(pos int) {
+	if pos+minMatchLength > len(m.src) {
+		return
+	}
+	h := m.hash(pos)
+	m.prev[pos&m.mask] = m.head[h]
+	m.head[h] = int32(pos)
+}
+
+func (m *matcher) matchLength(a, b, max int) int {
+	n := 0
+	for n < max && m.src[a+n] == m.src[b+n] {
+		n++
+	}
+	return n
+}
+
+// find returns the longest match for pos that ends before end.
+func (m *matcher) find(pos, end, lastDistance int) (length, distance int) {
+	maxLen := end - pos
+	if maxLen > maxMatchLength {
+		maxLen = maxMatchLength
+	}
+	if maxLen < minMatchLength {
+		return 0, 0
+	}
+	maxDist := pos
+	if maxDist > encodeMaxDistance {
+		maxDist = encodeMaxDistance
+	}
+	if lastDistance <= maxDist {
+		if l := m.matchLength(pos-lastDistance, pos, maxLen); l >= minMatchLength {
+			length, distance = l, lastDistance
+		}
+	}
+	cand := int(m.head[m.hash(pos)])
+	for chain := 0; cand >= 0 && chain < maxChainLength && length < maxLen; chain++ {
+		d := pos - cand
+		if d > maxDist || d <= 0 {
+			break
+		}
+		if m.src[cand+length] == m.src[pos+length] {
+			if l := m.matchLength(cand, pos, maxLen); l > length {
+				length, distance = l, d
+			}
+		}
+		next := int(m.prev[cand&m.mask])
+		if next >= cand {
+			break
+		}
+		cand = next
+	}
+	if length < minMatchLength {
+		return 0, 0
+	}
+	return length, distance
+}
+
+// Encode compresses src into a Brotli stream. The encoder does greedy LZ77
+// matching and uses a single prefix code for the literals, the commands and
+// the distances of each meta-block. It does not use the static dictionary.
+func Encode(src []byte) []byte {
+	bw := &bitWriter{}
+	// WBITS = 22
+	bw.writeBits(1, 1)
+	bw.writeBits(3, encodeWindowBits-17)
+	m := newMatcher(src)
+	distRB := [4]int{16, 15, 11, 4}
+	distRBIdx := 0
+	for start := 0; start < len(src); start += metaBlockSize {
+		end := start + metaBlockSize
+		if end > len(src) {
+			end = len(src)
+		}
+		isLast := end == len(src)
+
+		var commands []command
+		insertStart := start
+		for pos := start; pos < end; {
+			last := distRB[(distRBIdx+3)&3]
+			length, distance := m.find(pos, end, last)
+			if length == 0 {
+				m.insert(pos)
+				pos++
+				continue
+			}
+			cmd := command{insertPos: insertStart, insertLen: pos - insertStart, copyLen: length, distance: distance}
+			cmd.useLast = distance == last
+			if !cmd.useLast {
+				distRB[distRBIdx&3] = distance
+				distRBIdx++
+			}
+			commands = append(commands, cmd)
+			for i := 0; i < length; i++ {
+				m.insert(pos + i)
+			}
+			pos += length
+			insertStart = pos
+		}
+		if insertStart < end {
+			commands = append(commands, command{insertPos: insertStart, insertLen: end - insertStart})
+		}
+
+		literalFreq := make([]int, 256)
+		commandFreq := make([]int, 704)
+		distanceFreq := make([]int, 64)
+		for i := range commands {
+			cmd := &commands[i]
+			for _, c := range src[cmd.insertPos : cmd.insertPos+cmd.insertLen] {
+				literalFreq[c]++
+			}
+			cmd.insertCode, _ = lengthCode(insertLengthBase[:], cmd.insertLen)
+			if cmd.copyLen == 0 {
+				// the meta-block ends after the literals
+				cmd.cmdCode, _ = commandCode(cmd.insertCode, 0, false)
+				commandFreq[cmd.cmdCode]++
+				continue
+			}
+			cmd.copyCode, _ = lengthCode(copyLengthBase[:], cmd.copyLen)
+			cmd.cmdCode, cmd.implicit = commandCode(cmd.insertCode, cmd.copyCode, cmd.useLast)
+			commandFreq[cmd.cmdCode]++
+			if !cmd.implicit {
+				if !cmd.useLast {
+					cmd.distCode, cmd.distExtra, cmd.distNBits = distanceCode(cmd.distance)
+				}
+				distanceFreq[cmd.distCode]++
+			}
+		}
+
+		// meta-block header
+		mlen := end - start - 1
+		nibbles := 4
+		for mlen>>(4*uint(nibbles)) != 0 {
+			nibbles++
+		}
+		if isLast {
+			bw.writeBits(2, 1) // ISLAST, not ISLASTEMPTY
+		} else {
+			bw.writeBits(1, 0)
+		}
+		bw.writeBits(2, uint64(nibbles-4))
+		bw.writeBits(uint(4*nibbles), uint64(mlen))
+		if !isLast {
+			bw.writeBits(1, 0) // not uncompressed
+		}
+		// one block type for each category, NPOSTFIX, NDIRECT, literal
+		// context mode, one literal tree and one distance tree
+		bw.writeBits(3, 0)
+		bw.writeBits(6, 0)
+		bw.writeBits(2, contextLSB6)
+		bw.writeBits(2, 0)
+
+		literalPC := buildPrefixCode(bw, literalFreq)
+		commandPC := buildPrefixCode(bw, commandFreq)
+		distancePC := buildPrefixCode(bw, distanceFreq)
+		for _, cmd := range commands {
+			commandPC.write(bw, cmd.cmdCode)
+			bw.writeBits(insertLengthExtra[cmd.insertCode], uint64(cmd.insertLen-insertLengthBase[cmd.insertCode]))
+			if cmd.copyLen > 0 {
+				bw.writeBits(copyLengthExtra[cmd.copyCode], uint64(cmd.copyLen-copyLengthBase[cmd.copyCode]))
+			}
+			for _, c := range src[cmd.insertPos : cmd.insertPos+cmd.insertLen] {
+				literalPC.write(bw, int(c))
+			}
+			if cmd.copyLen > 0 && !cmd.implicit {
+				distancePC.write(bw, cmd.distCode)
+				bw.writeBits(cmd.distNBits, uint64(cmd.distExtra))
+			}
+		}
+	}
+	if len(src) == 0 {
+		bw.writeBits(2, 3) // ISLAST, ISLASTEMPTY
+	}
+	bw.alignToByte()
+	return bw.dst
+}
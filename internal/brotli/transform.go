@@ -0,0 +1,209 @@
+package brotli
+
+// Word transformation types, see RFC 7932, section 8.
+const (
+	transformIdentity = iota
+	transformOmitLast1
+	transformOmitLast2
+	transformOmitLast3
+	transformOmitLast4
+	transformOmitLast5
+	transformOmitLast6
+	transformOmitLast7
+	transformOmitLast8
+	transformOmitLast9
+	transformUppercaseFirst
+	transformUppercaseAll
+	transformOmitFirst1
+	transformOmitFirst2
+	transformOmitFirst3
+	transformOmitFirst4
+	transformOmitFirst5
+	transformOmitFirst6
+	transformOmitFirst7
+	transformOmitFirst8
+	transformOmitFirst9
+)
+
+type transform struct {
+	prefix string
+	typ    int
+	suffix string
+}
+
+// transforms is the list of word transformations from RFC 7932, appendix B.
+var transforms = []transform{
+	{"", transformIdentity, ""},
+	{"", transformIdentity, " "},
+	{" ", transformIdentity, " "},
+	{"", transformOmitFirst1, ""},
+	{"", transformUppercaseFirst, " "},
+	{"", transformIdentity, " the "},
+	{" ", transformIdentity, ""},
+	{"s ", transformIdentity, " "},
+	{"", transformIdentity, " of "},
+	{"", transformUppercaseFirst, ""},
+	{"", transformIdentity, " and "},
+	{"", transformOmitFirst2, ""},
+	{"", transformOmitLast1, ""},
+	{", ", transformIdentity, " "},
+	{"", transformIdentity, ", "},
+	{" ", transformUppercaseFirst, " "},
+	{"", transformIdentity, " in "},
+	{"", transformIdentity, " to "},
+	{"e ", transformIdentity, " "},
+	{"", transformIdentity, "\""},
+	{"", transformIdentity, "."},
+	{"", transformIdentity, "\">"},
+	{"", transformIdentity, "\n"},
+	{"", transformOmitLast3, ""},
+	{"", transformIdentity, "]"},
+	{"", transformIdentity, " for "},
+	{"", transformOmitFirst3, ""},
+	{"", transformOmitLast2, ""},
+	{"", transformIdentity, " a "},
+	{"", transformIdentity, " that "},
+	{" ", transformUppercaseFirst, ""},
+	{"", transformIdentity, ". "},
+	{".", transformIdentity, ""},
+	{" ", transformIdentity, ", "},
+	{"", transformOmitFirst4, ""},
+	{"", transformIdentity, " with "},
+	{"", transformIdentity, "'"},
+	{"", transformIdentity, " from "},
+	{"", transformIdentity, " by "},
+	{"", transformOmitFirst5, ""},
+	{"", transformOmitFirst6, ""},
+	{" the ", transformIdentity, ""},
+	{"", transformOmitLast4, ""},
+	{"", transformIdentity, ". The "},
+	{"", transformUppercaseAll, ""},
+	{"", transformIdentity, " on "},
+	{"", transformIdentity, " as "},
+	{"", transformIdentity, " is "},
+	{"", transformOmitLast7, ""},
+	{"", transformOmitLast1, "ing "},
+	{"", transformIdentity, "\n\t"},
+	{"", transformIdentity, ":"},
+	{" ", transformIdentity, ". "},
+	{"", transformIdentity, "ed "},
+	{"", transformOmitFirst9, ""},
+	{"", transformOmitFirst7, ""},
+	{"", transformOmitLast6, ""},
+	{"", transformIdentity, "("},
+	{"", transformUppercaseFirst, ", "},
+	{"", transformOmitLast8, ""},
+	{"", transformIdentity, " at "},
+	{"", transformIdentity, "ly "},
+	{" the ", transformIdentity, " of "},
+	{"", transformOmitLast5, ""},
+	{"", transformOmitLast9, ""},
+	{" ", transformUppercaseFirst, ", "},
+	{"", transformUppercaseFirst, "\""},
+	{".", transformIdentity, "("},
+	{"", transformUppercaseAll, " "},
+	{"", transformUppercaseFirst, "\">"},
+	{"", transformIdentity, "=\""},
+	{" ", transformIdentity, "."},
+	{".com/", transformIdentity, ""},
+	{" the ", transformIdentity, " of the "},
+	{"", transformUppercaseFirst, "'"},
+	{"", transformIdentity, ". This "},
+	{"", transformIdentity, ","},
+	{".", transformIdentity, " "},
+	{"", transformUppercaseFirst, "("},
+	{"", transformUppercaseFirst, "."},
+	{"", transformIdentity, " not "},
+	{" ", transformIdentity, "=\""},
+	{"", transformIdentity, "er "},
+	{" ", transformUppercaseAll, " "},
+	{"", transformIdentity, "al "},
+	{" ", transformUppercaseAll, ""},
+	{"", transformIdentity, "='"},
+	{"", transformUppercaseAll, "\""},
+	{"", transformUppercaseFirst, ". "},
+	{" ", transformIdentity, "("},
+	{"", transformIdentity, "ful "},
+	{" ", transformUppercaseFirst, ". "},
+	{"", transformIdentity, "ive "},
+	{"", transformIdentity, "less "},
+	{"", transformUppercaseAll, "'"},
+	{"", transformIdentity, "est "},
+	{" ", transformUppercaseFirst, "."},
+	{"", transformUppercaseAll, "\">"},
+	{" ", transformIdentity, "='"},
+	{"", transformUppercaseFirst, ","},
+	{"", transformIdentity, "ize "},
+	{"", transformUppercaseAll, "."},
+	{"\xc2\xa0", transformIdentity, ""},
+	{" ", transformIdentity, ","},
+	{"", transformUppercaseFirst, "=\""},
+	{"", transformUppercaseAll, "=\""},
+	{"", transformIdentity, "ous "},
+	{"", transformUppercaseAll, ", "},
+	{"", transformUppercaseFirst, "='"},
+	{" ", transformUppercaseFirst, ","},
+	{" ", transformUppercaseAll, "=\""},
+	{" ", transformUppercaseAll, ", "},
+	{"", transformUppercaseAll, ","},
+	{"", transformUppercaseAll, "("},
+	{"", transformUppercaseAll, ". "},
+	{" ", transformUppercaseAll, "."},
+	{"", transformUppercaseAll, "='"},
+	{" ", transformUppercaseAll, ". "},
+	{" ", transformUppercaseFirst, "=\""},
+	{" ", transformUppercaseAll, "='"},
+	{" ", transformUppercaseFirst, "='"},
+}
+
+// ferment changes the case of the UTF-8 character at word[pos] and returns
+// the length of the character.
+func ferment(word []byte, pos int) int {
+	if word[pos] < 192 {
+		if word[pos] >= 'a' && word[pos] <= 'z' {
+			word[pos] ^= 32
+		}
+		return 1
+	}
+	if word[pos] < 224 {
+		if pos+1 < len(word) {
+			word[pos+1] ^= 32
+		}
+		return 2
+	}
+	if pos+2 < len(word) {
+		word[pos+2] ^= 5
+	}
+	return 3
+}
+
+// transformWord appends the dictionary word transformed by the transform
+// with the given id to dst.
+func transformWord(dst []byte, word []byte, id int) []byte {
+	t := transforms[id]
+	dst = append(dst, t.prefix...)
+	start := len(dst)
+	switch {
+	case t.typ <= transformOmitLast9:
+		if l := len(word) - t.typ; l > 0 {
+			dst = append(dst, word[:l]...)
+		}
+	case t.typ >= transformOmitFirst1:
+		if skip := t.typ - transformOmitFirst1 + 1; skip < len(word) {
+			dst = append(dst, word[skip:]...)
+		}
+	default:
+		dst = append(dst, word...)
+		w := dst[start:]
+		if t.typ == transformUppercaseFirst {
+			if len(w) > 0 {
+				ferment(w, 0)
+			}
+		} else {
+			for pos := 0; pos < len(w); {
+				pos += ferment(w, pos)
+			}
+		}
+	}
+	return append(dst, t.suffix...)
+}
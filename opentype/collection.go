@@ -0,0 +1,87 @@
+package opentype
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// Magic numbers at the start of a font file.
+const (
+	magicTrueType   = 0x00010000
+	magicOpenType   = 0x4F54544F // OTTO
+	magicCollection = 0x74746366 // ttcf
+)
+
+// readCollectionOffsets reads the TTC header after the 'ttcf' tag and returns
+// the offsets of the table directories of all faces in the collection. The
+// reader must be positioned directly after the tag.
+//
+// See https://docs.microsoft.com/en-us/typography/opentype/spec/otff#collections
+func readCollectionOffsets(r io.ReadSeeker) ([]uint32, error) {
+	var majorVersion, minorVersion uint16
+	var numFonts uint32
+	if err := binary.Read(r, binary.BigEndian, &majorVersion); err != nil {
+		return nil, err
+	}
+	if err := binary.Read(r, binary.BigEndian, &minorVersion); err != nil {
+		return nil, err
+	}
+	if majorVersion != 1 && majorVersion != 2 {
+		return nil, fmt.Errorf("unsupported font collection version %d.%d", majorVersion, minorVersion)
+	}
+	if err := binary.Read(r, binary.BigEndian, &numFonts); err != nil {
+		return nil, err
+	}
+	// the DSIG fields of a version 2 header are not interesting for us
+	pos, err := r.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, err
+	}
+	size, err := r.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+	if int64(numFonts)*4 > size-pos {
+		return nil, fmt.Errorf("font collection with %d faces is larger than the file", numFonts)
+	}
+	if _, err = r.Seek(pos, io.SeekStart); err != nil {
+		return nil, err
+	}
+	offsets := make([]uint32, numFonts)
+	if err := binary.Read(r, binary.BigEndian, offsets); err != nil {
+		return nil, err
+	}
+	return offsets, nil
+}
+
+// NumFaces returns the number of faces in the font file. This is 1 for
+// ordinary TrueType and OpenType fonts and the number of fonts for TrueType
+// and OpenType collections (.ttc, .otc) and WOFF2 collections.
+func NumFaces(r io.ReadSeeker) (int, error) {
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return 0, err
+	}
+	var magic uint32
+	if err := binary.Read(r, binary.BigEndian, &magic); err != nil {
+		return 0, err
+	}
+	switch magic {
+	case magicTrueType, magicOpenType, magicWOFF:
+		return 1, nil
+	case magicWOFF2:
+		sfnt, err := decodeWOFF2(r)
+		if err != nil {
+			return 0, err
+		}
+		return NumFaces(bytes.NewReader(sfnt))
+	case magicCollection:
+		offsets, err := readCollectionOffsets(r)
+		if err != nil {
+			return 0, err
+		}
+		return len(offsets), nil
+	}
+	return 0, fmt.Errorf("unknown magic %v", magic)
+}
@@ -0,0 +1,132 @@
+package opentype
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Bits of the fsType field of the OS/2 table.
+const (
+	fsTypeRestricted   = 0x0002
+	fsTypePreviewPrint = 0x0004
+	fsTypeEditable     = 0x0008
+	fsTypeNoSubsetting = 0x0100
+	fsTypeBitmapOnly   = 0x0200
+)
+
+// EmbeddingPermissions are the embedding permissions of the fsType field of
+// the OS/2 table. Exactly one of Installable, Restricted, PreviewPrint and
+// Editable is true.
+type EmbeddingPermissions struct {
+	Installable  bool // the font may be embedded and installed permanently
+	Restricted   bool // the font must not be embedded
+	PreviewPrint bool // the font may be embedded for viewing and printing only
+	Editable     bool // the font may be embedded in editable documents
+	NoSubsetting bool // the font must only be embedded completely
+	BitmapOnly   bool // only the bitmaps of the font may be embedded
+}
+
+func (p EmbeddingPermissions) String() string {
+	var parts []string
+	switch {
+	case p.Installable:
+		parts = append(parts, "installable")
+	case p.Editable:
+		parts = append(parts, "editable")
+	case p.PreviewPrint:
+		parts = append(parts, "preview & print")
+	case p.Restricted:
+		parts = append(parts, "restricted")
+	}
+	if p.NoSubsetting {
+		parts = append(parts, "no subsetting")
+	}
+	if p.BitmapOnly {
+		parts = append(parts, "bitmap only")
+	}
+	return strings.Join(parts, ", ")
+}
+
+// EmbeddingPermissions decodes the fsType field of the OS/2 table. Old fonts
+// can have several usage bits set, then the least restrictive one is used.
+// Fonts without an OS/2 table are installable.
+func (tt *Font) EmbeddingPermissions() EmbeddingPermissions {
+	fsType := tt.OS2.FsType
+	p := EmbeddingPermissions{
+		NoSubsetting: fsType&fsTypeNoSubsetting != 0,
+		BitmapOnly:   fsType&fsTypeBitmapOnly != 0,
+	}
+	// bit 0 is reserved
+	switch {
+	case fsType&0x000e == 0:
+		p.Installable = true
+	case fsType&fsTypeEditable != 0:
+		p.Editable = true
+	case fsType&fsTypePreviewPrint != 0:
+		p.PreviewPrint = true
+	default:
+		p.Restricted = true
+	}
+	return p
+}
+
+// EmbeddingPolicy decides whether the embedding permissions of a font are
+// checked.
+type EmbeddingPolicy int
+
+const (
+	// EmbeddingIgnore does not check the embedding permissions.
+	EmbeddingIgnore EmbeddingPolicy = iota
+	// EmbeddingEnforce makes Subset, SubsetCompact, WriteSubset, Write,
+	// WriteWOFF and WriteWOFF2 return an *EmbeddingError if the font must not
+	// be subset or embedded. Embedding is not allowed for restricted fonts and
+	// for fonts that only allow bitmap embedding.
+	EmbeddingEnforce
+)
+
+// EmbeddingError is returned if the embedding permissions of a font do not
+// allow an operation.
+type EmbeddingError struct {
+	FontName    string
+	Operation   string // "subset" or "embed"
+	FsType      uint16
+	Permissions EmbeddingPermissions
+}
+
+func (e *EmbeddingError) Error() string {
+	verb := "embedded"
+	if e.Operation == "subset" {
+		verb = "subset"
+	}
+	return fmt.Sprintf("font %s must not be %s (fsType 0x%04X: %s)", e.FontName, verb, e.FsType, e.Permissions)
+}
+
+// checkEmbedding returns an *EmbeddingError if the policy of the font is
+// EmbeddingEnforce and the permissions do not allow the operation ("subset"
+// or "embed").
+func (tt *Font) checkEmbedding(operation string) error {
+	if tt.EmbeddingPolicy != EmbeddingEnforce {
+		return nil
+	}
+	p := tt.EmbeddingPermissions()
+	allowed := true
+	switch operation {
+	case "subset":
+		allowed = !p.NoSubsetting
+	case "embed":
+		allowed = !p.Restricted && !p.BitmapOnly && !(p.NoSubsetting && tt.subsetCodepoints != nil)
+	}
+	if allowed {
+		return nil
+	}
+	fontName := tt.FontName
+	if tt.IsCFF && tt.CFF != nil {
+		fontName = tt.CFF.FontName()
+	}
+	return &EmbeddingError{
+		FontName:    fontName,
+		Operation:   operation,
+		FsType:      tt.OS2.FsType,
+		Permissions: p,
+	}
+}
@@ -0,0 +1,57 @@
+package opentype
+
+import "fmt"
+
+// Glyph classes of the GDEF table
+const (
+	GlyphClassBase      = 1
+	GlyphClassLigature  = 2
+	GlyphClassMark      = 3
+	GlyphClassComponent = 4
+)
+
+// GDEF has the glyph classes and the mark classes of the glyph definition
+// table.
+type GDEF struct {
+	GlyphClasses      ClassDef
+	MarkAttachClasses ClassDef
+	MarkGlyphSets     []Coverage
+}
+
+func (tt *Font) readGDEF() error {
+	data, err := tt.ReadTableData("GDEF")
+	if err != nil {
+		return err
+	}
+	if tt.GDEF, err = parseGDEF(data); err != nil {
+		return fmt.Errorf("GDEF: %s", err)
+	}
+	return nil
+}
+
+func parseGDEF(data []byte) (*GDEF, error) {
+	p := &layoutParser{data: data}
+	major, minor := p.uint16(0), p.uint16(2)
+	if p.err == nil && major != 1 {
+		return nil, fmt.Errorf("unknown version %d.%d", major, minor)
+	}
+	gdef := &GDEF{
+		GlyphClasses:      p.classDef(p.offset(0, 4)),
+		MarkAttachClasses: p.classDef(p.offset(0, 10)),
+	}
+	if minor >= 2 {
+		if sets := p.offset(0, 12); sets >= 0 {
+			if format := p.uint16(sets); format != 1 {
+				return nil, fmt.Errorf("unknown mark glyph sets format %d", format)
+			}
+			n := p.uint16(sets + 2)
+			for i := 0; i < n && p.err == nil; i++ {
+				gdef.MarkGlyphSets = append(gdef.MarkGlyphSets, p.coverage(sets+p.uint32(sets+4+4*i)))
+			}
+		}
+	}
+	if p.err != nil {
+		return nil, p.err
+	}
+	return gdef, nil
+}
@@ -0,0 +1,276 @@
+package opentype
+
+import (
+	"fmt"
+
+	"github.com/speedata/gootf/cff"
+)
+
+// maxComponentDepth limits the nesting of composite glyphs.
+const maxComponentDepth = 10
+
+// glyfPoint is a point of a TrueType glyph.
+type glyfPoint struct {
+	x, y    float64
+	onCurve bool
+}
+
+// glyfOutline returns the outline of the TrueType glyph gid in font units.
+// Composite glyphs are resolved into one outline.
+func (tt *Font) glyfOutline(gid int) (Path, error) {
+	contours, err := tt.glyfContours(gid, 0)
+	if err != nil {
+		return nil, err
+	}
+	var path Path
+	for _, contour := range contours {
+		path = appendContour(path, contour)
+	}
+	return path, nil
+}
+
+// glyfContours decodes the glyph gid into its contours. depth is the nesting
+// depth of composite glyphs.
+func (tt *Font) glyfContours(gid int, depth int) ([][]glyfPoint, error) {
+	if gid < 0 || gid >= len(tt.Glyph) {
+		return nil, fmt.Errorf("glyph %d does not exist", gid)
+	}
+	if depth > maxComponentDepth {
+		return nil, fmt.Errorf("glyph %d: components nested too deep", gid)
+	}
+	data := tt.Glyph[gid]
+	if len(data) == 0 {
+		return nil, nil
+	}
+	g := &woff2Buffer{data: data}
+	nContours := g.int16()
+	// skip the bounding box
+	g.bytes(8)
+	var contours [][]glyfPoint
+	var err error
+	if nContours >= 0 {
+		contours, err = decodeSimpleGlyph(g, int(nContours))
+	} else {
+		contours, err = tt.decodeCompositeGlyph(g, depth)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("glyph %d: %s", gid, err)
+	}
+	if g.err != nil {
+		return nil, fmt.Errorf("glyph %d: glyph data too short", gid)
+	}
+	return contours, nil
+}
+
+// decodeSimpleGlyph reads the contours of a simple glyph after the glyph
+// header.
+func decodeSimpleGlyph(g *woff2Buffer, nContours int) ([][]glyfPoint, error) {
+	if nContours == 0 {
+		return nil, nil
+	}
+	endPts := make([]int, nContours)
+	for i := range endPts {
+		endPts[i] = int(g.uint16())
+		if i > 0 && endPts[i] < endPts[i-1] {
+			return nil, fmt.Errorf("invalid contour end points")
+		}
+	}
+	instructionLength := int(g.uint16())
+	g.bytes(instructionLength)
+	nPoints := endPts[len(endPts)-1] + 1
+	flags := make([]byte, 0, nPoints)
+	for len(flags) < nPoints && g.err == nil {
+		flag := g.uint8()
+		flags = append(flags, flag)
+		if flag&glyfRepeat != 0 {
+			for n := g.uint8(); n > 0; n-- {
+				flags = append(flags, flag)
+			}
+		}
+	}
+	if g.err != nil {
+		return nil, nil
+	}
+	if len(flags) != nPoints {
+		return nil, fmt.Errorf("invalid flags")
+	}
+	points := make([]glyfPoint, nPoints)
+	x, y := 0, 0
+	for i, flag := range flags {
+		switch {
+		case flag&glyfXShort != 0:
+			if flag&glyfThisXIsSame != 0 {
+				x += int(g.uint8())
+			} else {
+				x -= int(g.uint8())
+			}
+		case flag&glyfThisXIsSame == 0:
+			x += int(g.int16())
+		}
+		points[i].x = float64(x)
+		points[i].onCurve = flag&glyfOnCurve != 0
+	}
+	for i, flag := range flags {
+		switch {
+		case flag&glyfYShort != 0:
+			if flag&glyfThisYIsSame != 0 {
+				y += int(g.uint8())
+			} else {
+				y -= int(g.uint8())
+			}
+		case flag&glyfThisYIsSame == 0:
+			y += int(g.int16())
+		}
+		points[i].y = float64(y)
+	}
+	contours := make([][]glyfPoint, nContours)
+	start := 0
+	for i, end := range endPts {
+		contours[i] = points[start : end+1]
+		start = end + 1
+	}
+	return contours, nil
+}
+
+// decodeCompositeGlyph reads the components of a composite glyph after the
+// glyph header and returns the transformed contours of all components.
+func (tt *Font) decodeCompositeGlyph(g *woff2Buffer, depth int) ([][]glyfPoint, error) {
+	var contours [][]glyfPoint
+	for {
+		flags := g.uint16()
+		componentIndex := int(g.uint16())
+		var arg1, arg2 int
+		switch {
+		case flags&flagArg1And2AreWords != 0 && flags&flagArgsAreXYValues != 0:
+			arg1, arg2 = int(g.int16()), int(g.int16())
+		case flags&flagArg1And2AreWords != 0:
+			arg1, arg2 = int(g.uint16()), int(g.uint16())
+		case flags&flagArgsAreXYValues != 0:
+			arg1, arg2 = int(int8(g.uint8())), int(int8(g.uint8()))
+		default:
+			arg1, arg2 = int(g.uint8()), int(g.uint8())
+		}
+		// the transformation matrix a b c d in F2Dot14 format
+		f2dot14 := func() float64 {
+			return float64(g.int16()) / 16384
+		}
+		a, b, c, d := 1.0, 0.0, 0.0, 1.0
+		switch {
+		case flags&flagWeHaveAScale != 0:
+			a = f2dot14()
+			d = a
+		case flags&flagWeHaveAnXAndYScale != 0:
+			a, d = f2dot14(), f2dot14()
+		case flags&flagWeHaveATwoByTwo != 0:
+			a, b, c, d = f2dot14(), f2dot14(), f2dot14(), f2dot14()
+		}
+		if g.err != nil {
+			return nil, nil
+		}
+		component, err := tt.glyfContours(componentIndex, depth+1)
+		if err != nil {
+			return nil, err
+		}
+		transformed := make([][]glyfPoint, len(component))
+		for i, contour := range component {
+			transformed[i] = make([]glyfPoint, len(contour))
+			for j, pt := range contour {
+				transformed[i][j] = glyfPoint{
+					x:       a*pt.x + c*pt.y,
+					y:       b*pt.x + d*pt.y,
+					onCurve: pt.onCurve,
+				}
+			}
+		}
+		var dx, dy float64
+		if flags&flagArgsAreXYValues != 0 {
+			dx, dy = float64(arg1), float64(arg2)
+			if flags&flagScaledComponentOffset != 0 && flags&flagUnscaledComponentOffset == 0 {
+				dx, dy = a*dx+c*dy, b*dx+d*dy
+			}
+		} else {
+			// arg1 is a point of the glyph so far, arg2 a point of the
+			// component and both points must match.
+			parent, ok := nthPoint(contours, arg1)
+			if !ok {
+				return nil, fmt.Errorf("invalid point number %d", arg1)
+			}
+			child, ok := nthPoint(transformed, arg2)
+			if !ok {
+				return nil, fmt.Errorf("invalid point number %d in component %d", arg2, componentIndex)
+			}
+			dx, dy = parent.x-child.x, parent.y-child.y
+		}
+		for _, contour := range transformed {
+			for j := range contour {
+				contour[j].x += dx
+				contour[j].y += dy
+			}
+		}
+		contours = append(contours, transformed...)
+		if flags&flagMoreComponents == 0 {
+			break
+		}
+	}
+	return contours, nil
+}
+
+// nthPoint returns the point number n of the contours.
+func nthPoint(contours [][]glyfPoint, n int) (glyfPoint, bool) {
+	for _, contour := range contours {
+		if n < len(contour) {
+			return contour[n], true
+		}
+		n -= len(contour)
+	}
+	return glyfPoint{}, false
+}
+
+// appendContour converts the points of a TrueType contour into path segments.
+// Two consecutive off-curve points have an implied on-curve point in the
+// middle.
+func appendContour(path Path, contour []glyfPoint) Path {
+	if len(contour) == 0 {
+		return path
+	}
+	midpoint := func(p, q glyfPoint) glyfPoint {
+		return glyfPoint{x: (p.x + q.x) / 2, y: (p.y + q.y) / 2, onCurve: true}
+	}
+	// find an on-curve start point
+	var start glyfPoint
+	first, last := contour[0], contour[len(contour)-1]
+	switch {
+	case first.onCurve:
+		start = first
+		contour = contour[1:]
+	case last.onCurve:
+		start = last
+		contour = contour[:len(contour)-1]
+	default:
+		start = midpoint(first, last)
+	}
+	path = append(path, cff.Segment{Op: cff.MoveTo, Args: [3]cff.Point{{X: start.x, Y: start.y}}})
+	var control *glyfPoint
+	for i := range contour {
+		pt := contour[i]
+		switch {
+		case pt.onCurve && control == nil:
+			path = append(path, cff.Segment{Op: cff.LineTo, Args: [3]cff.Point{{X: pt.x, Y: pt.y}}})
+		case pt.onCurve:
+			path = append(path, cff.Segment{Op: cff.QuadTo, Args: [3]cff.Point{{X: control.x, Y: control.y}, {X: pt.x, Y: pt.y}}})
+			control = nil
+		case control == nil:
+			control = &contour[i]
+		default:
+			mid := midpoint(*control, pt)
+			path = append(path, cff.Segment{Op: cff.QuadTo, Args: [3]cff.Point{{X: control.x, Y: control.y}, {X: mid.x, Y: mid.y}}})
+			control = &contour[i]
+		}
+	}
+	// The contour is closed implicitly, only a curve back to the start
+	// point is needed.
+	if control != nil {
+		path = append(path, cff.Segment{Op: cff.QuadTo, Args: [3]cff.Point{{X: control.x, Y: control.y}, {X: start.x, Y: start.y}}})
+	}
+	return path
+}
@@ -0,0 +1,427 @@
+package opentype
+
+import "fmt"
+
+// GPOS lookup types. The subtables of the lookups are *SinglePos, *PairPos,
+// *CursivePos, *MarkBasePos, *MarkLigPos, *MarkMarkPos, *SequenceContext and
+// *ChainedSequenceContext.
+const (
+	GPOSSingle = iota + 1
+	GPOSPair
+	GPOSCursive
+	GPOSMarkToBase
+	GPOSMarkToLigature
+	GPOSMarkToMark
+	GPOSContext
+	GPOSChainedContext
+	GPOSExtension
+)
+
+// Device has the adjustments of a value in pixels for a range of sizes in
+// pixels per em. If VariationIndex is true, the device table refers to the
+// variation data of a variable font in DeltaSetOuterIndex and
+// DeltaSetInnerIndex instead.
+type Device struct {
+	StartSize          int
+	EndSize            int
+	Deltas             []int
+	VariationIndex     bool
+	DeltaSetOuterIndex int
+	DeltaSetInnerIndex int
+}
+
+// Delta returns the adjustment for the size in pixels per em.
+func (d *Device) Delta(ppem int) int {
+	if d == nil || d.VariationIndex || ppem < d.StartSize || ppem > d.EndSize || ppem-d.StartSize >= len(d.Deltas) {
+		return 0
+	}
+	return d.Deltas[ppem-d.StartSize]
+}
+
+// ValueRecord has the adjustments of a glyph position in font units. The
+// device tables are nil if the record has none.
+type ValueRecord struct {
+	XPlacement int
+	YPlacement int
+	XAdvance   int
+	YAdvance   int
+	XPlaDevice *Device
+	YPlaDevice *Device
+	XAdvDevice *Device
+	YAdvDevice *Device
+}
+
+// Anchor is an attachment point of a glyph in font units. AnchorPoint is the
+// index of a contour point of the glyph or -1.
+type Anchor struct {
+	X           int
+	Y           int
+	AnchorPoint int
+	XDevice     *Device
+	YDevice     *Device
+}
+
+// SinglePos adjusts the position of single glyphs (GPOS type 1).
+type SinglePos struct {
+	Values map[int]ValueRecord
+}
+
+// PairValue has the adjustments of the two glyphs of a pair.
+type PairValue struct {
+	First  ValueRecord
+	Second ValueRecord
+}
+
+// PairPos adjusts the positions of pairs of glyphs (GPOS type 2). Format 1
+// has the pairs of glyphs in Pairs, the key of the map is the first glyph.
+// Format 2 has the values for pairs of classes in ClassPairs indexed by the
+// class of the first glyph and the class of the second glyph. Only glyphs
+// in Coverage can be the first glyph of a pair. ValueFormat1 and
+// ValueFormat2 are the value formats of the two glyphs, a pair with a value
+// for the second glyph is not kerned with the following glyph.
+type PairPos struct {
+	Format       int
+	Coverage     Coverage
+	ValueFormat1 int
+	ValueFormat2 int
+	Pairs        map[int]map[int]PairValue
+	ClassDef1    ClassDef
+	ClassDef2    ClassDef
+	ClassPairs   [][]PairValue
+}
+
+// Lookup returns the adjustments for the pair of glyphs.
+func (pp *PairPos) Lookup(first, second int) (PairValue, bool) {
+	if _, ok := pp.Coverage[first]; !ok {
+		return PairValue{}, false
+	}
+	if pp.Format == 1 {
+		pv, ok := pp.Pairs[first][second]
+		return pv, ok
+	}
+	c1, c2 := pp.ClassDef1[first], pp.ClassDef2[second]
+	if c1 >= len(pp.ClassPairs) || c2 >= len(pp.ClassPairs[c1]) {
+		return PairValue{}, false
+	}
+	return pp.ClassPairs[c1][c2], true
+}
+
+// EntryExit has the entry and the exit anchor of a glyph, both can be nil.
+type EntryExit struct {
+	Entry *Anchor
+	Exit  *Anchor
+}
+
+// CursivePos connects glyphs at their exit and entry anchors (GPOS type 3).
+type CursivePos struct {
+	EntryExits map[int]EntryExit
+}
+
+// MarkRecord is the class and the anchor of a mark glyph.
+type MarkRecord struct {
+	Class  int
+	Anchor Anchor
+}
+
+// MarkBasePos attaches marks to base glyphs (GPOS type 4). The anchors of the
+// base glyphs are indexed by the mark class, missing anchors are nil.
+type MarkBasePos struct {
+	ClassCount int
+	Marks      map[int]MarkRecord
+	Bases      map[int][]*Anchor
+}
+
+// MarkLigPos attaches marks to ligatures (GPOS type 5). The anchors of the
+// ligatures are indexed by the component and the mark class, missing anchors
+// are nil.
+type MarkLigPos struct {
+	ClassCount int
+	Marks      map[int]MarkRecord
+	Ligatures  map[int][][]*Anchor
+}
+
+// MarkMarkPos attaches marks to other marks (GPOS type 6). The anchors of the
+// base marks are indexed by the mark class, missing anchors are nil.
+type MarkMarkPos struct {
+	ClassCount int
+	Marks      map[int]MarkRecord
+	BaseMarks  map[int][]*Anchor
+}
+
+func (tt *Font) readGPOS() error {
+	data, err := tt.ReadTableData("GPOS")
+	if err != nil {
+		return err
+	}
+	if tt.GPOS, err = parseLayoutTable(data, GPOSExtension, parseGPOSSubtable); err != nil {
+		return fmt.Errorf("GPOS: %s", err)
+	}
+	return nil
+}
+
+func parseGPOSSubtable(p *layoutParser, lookupType, off int) LookupSubtable {
+	format := p.uint16(off)
+	switch lookupType {
+	case GPOSContext:
+		return p.sequenceContext(off)
+	case GPOSChainedContext:
+		return p.chainedSequenceContext(off)
+	case GPOSSingle, GPOSPair:
+		if format != 1 && format != 2 {
+			p.fail(fmt.Errorf("unknown format %d of lookup type %d", format, lookupType))
+			return nil
+		}
+	case GPOSCursive, GPOSMarkToBase, GPOSMarkToLigature, GPOSMarkToMark:
+		if format != 1 {
+			p.fail(fmt.Errorf("unknown format %d of lookup type %d", format, lookupType))
+			return nil
+		}
+	default:
+		p.fail(fmt.Errorf("unknown lookup type %d", lookupType))
+		return nil
+	}
+	cov := p.coverage(off + p.uint16(off+2))
+	switch lookupType {
+	case GPOSSingle:
+		valueFormat := p.uint16(off + 4)
+		st := &SinglePos{Values: make(map[int]ValueRecord, len(cov))}
+		if format == 1 {
+			vr, _ := p.valueRecord(off, off+6, valueFormat)
+			for gid := range cov {
+				st.Values[gid] = vr
+			}
+			return st
+		}
+		count, size := p.uint16(off+6), valueRecordSize(valueFormat)
+		for gid, idx := range cov {
+			if idx >= count {
+				p.fail(errLayoutCorrupt)
+				return nil
+			}
+			st.Values[gid], _ = p.valueRecord(off, off+8+idx*size, valueFormat)
+		}
+		return st
+	case GPOSPair:
+		return p.pairPos(off, format, cov)
+	case GPOSCursive:
+		st := &CursivePos{EntryExits: make(map[int]EntryExit, len(cov))}
+		count := p.uint16(off + 4)
+		for gid, idx := range cov {
+			if idx >= count {
+				p.fail(errLayoutCorrupt)
+				return nil
+			}
+			rec := off + 6 + 4*idx
+			st.EntryExits[gid] = EntryExit{
+				Entry: p.anchor(p.offset(off, rec)),
+				Exit:  p.anchor(p.offset(off, rec+2)),
+			}
+		}
+		return st
+	case GPOSMarkToBase, GPOSMarkToMark:
+		baseCov := p.coverage(off + p.uint16(off+4))
+		classCount := p.uint16(off + 6)
+		marks := p.markArray(off+p.uint16(off+8), cov, classCount)
+		baseArray := off + p.uint16(off+10)
+		bases := make(map[int][]*Anchor, len(baseCov))
+		baseCount := p.uint16(baseArray)
+		for gid, idx := range baseCov {
+			if idx >= baseCount {
+				p.fail(errLayoutCorrupt)
+				return nil
+			}
+			bases[gid] = p.anchors(baseArray, baseArray+2+2*classCount*idx, classCount)
+		}
+		if lookupType == GPOSMarkToMark {
+			return &MarkMarkPos{ClassCount: classCount, Marks: marks, BaseMarks: bases}
+		}
+		return &MarkBasePos{ClassCount: classCount, Marks: marks, Bases: bases}
+	case GPOSMarkToLigature:
+		ligCov := p.coverage(off + p.uint16(off+4))
+		classCount := p.uint16(off + 6)
+		st := &MarkLigPos{
+			ClassCount: classCount,
+			Marks:      p.markArray(off+p.uint16(off+8), cov, classCount),
+			Ligatures:  make(map[int][][]*Anchor, len(ligCov)),
+		}
+		ligArray := off + p.uint16(off+10)
+		ligCount := p.uint16(ligArray)
+		for gid, idx := range ligCov {
+			if idx >= ligCount {
+				p.fail(errLayoutCorrupt)
+				return nil
+			}
+			attach := ligArray + p.uint16(ligArray+2+2*idx)
+			componentCount := p.uint16(attach)
+			components := make([][]*Anchor, 0, componentCount)
+			for i := 0; i < componentCount && p.err == nil; i++ {
+				components = append(components, p.anchors(attach, attach+2+2*classCount*i, classCount))
+			}
+			st.Ligatures[gid] = components
+		}
+		return st
+	}
+	return nil
+}
+
+func (p *layoutParser) pairPos(off, format int, cov Coverage) *PairPos {
+	valueFormat1, valueFormat2 := p.uint16(off+4), p.uint16(off+6)
+	size1, size2 := valueRecordSize(valueFormat1), valueRecordSize(valueFormat2)
+	pp := &PairPos{Format: format, Coverage: cov, ValueFormat1: valueFormat1, ValueFormat2: valueFormat2}
+	if format == 1 {
+		pp.Pairs = make(map[int]map[int]PairValue, len(cov))
+		setCount := p.uint16(off + 8)
+		for gid, idx := range cov {
+			if idx >= setCount {
+				p.fail(errLayoutCorrupt)
+				return nil
+			}
+			pairSet := off + p.uint16(off+10+2*idx)
+			count := p.uint16(pairSet)
+			pairs := make(map[int]PairValue, count)
+			for i := 0; i < count && p.err == nil; i++ {
+				rec := pairSet + 2 + i*(2+size1+size2)
+				var pv PairValue
+				pv.First, _ = p.valueRecord(pairSet, rec+2, valueFormat1)
+				pv.Second, _ = p.valueRecord(pairSet, rec+2+size1, valueFormat2)
+				pairs[p.uint16(rec)] = pv
+			}
+			pp.Pairs[gid] = pairs
+		}
+		return pp
+	}
+	pp.ClassDef1 = p.classDef(p.offset(off, off+8))
+	pp.ClassDef2 = p.classDef(p.offset(off, off+10))
+	class1Count, class2Count := p.uint16(off+12), p.uint16(off+14)
+	if !p.check(off+16, class1Count*class2Count*(size1+size2)) {
+		return nil
+	}
+	pos := off + 16
+	pp.ClassPairs = make([][]PairValue, class1Count)
+	for c1 := range pp.ClassPairs {
+		pp.ClassPairs[c1] = make([]PairValue, class2Count)
+		for c2 := range pp.ClassPairs[c1] {
+			var pv PairValue
+			pv.First, pos = p.valueRecord(off, pos, valueFormat1)
+			pv.Second, pos = p.valueRecord(off, pos, valueFormat2)
+			pp.ClassPairs[c1][c2] = pv
+		}
+	}
+	return pp
+}
+
+// valueRecordSize returns the size in bytes of a value record.
+func valueRecordSize(valueFormat int) int {
+	size := 0
+	for bit := 1; bit < 0x100; bit <<= 1 {
+		if valueFormat&bit != 0 {
+			size += 2
+		}
+	}
+	return size
+}
+
+// valueRecord reads the value record at off and returns it and the position
+// after the record. The device offsets are relative to base.
+func (p *layoutParser) valueRecord(base, off, valueFormat int) (ValueRecord, int) {
+	var vr ValueRecord
+	values := []*int{&vr.XPlacement, &vr.YPlacement, &vr.XAdvance, &vr.YAdvance}
+	for i, v := range values {
+		if valueFormat&(1<<i) != 0 {
+			*v = p.int16(off)
+			off += 2
+		}
+	}
+	devices := []**Device{&vr.XPlaDevice, &vr.YPlaDevice, &vr.XAdvDevice, &vr.YAdvDevice}
+	for i, d := range devices {
+		if valueFormat&(0x10<<i) != 0 {
+			*d = p.device(p.offset(base, off))
+			off += 2
+		}
+	}
+	return vr, off
+}
+
+func (p *layoutParser) device(off int) *Device {
+	if off < 0 {
+		return nil
+	}
+	d := &Device{StartSize: p.uint16(off), EndSize: p.uint16(off + 2)}
+	deltaFormat := p.uint16(off + 4)
+	if deltaFormat == 0x8000 {
+		return &Device{VariationIndex: true, DeltaSetOuterIndex: d.StartSize, DeltaSetInnerIndex: d.EndSize}
+	}
+	if deltaFormat < 1 || deltaFormat > 3 {
+		p.fail(fmt.Errorf("unknown delta format %d", deltaFormat))
+		return nil
+	}
+	if d.EndSize < d.StartSize {
+		return d
+	}
+	bits := 1 << deltaFormat // 2, 4 or 8 bits per value
+	perWord := 16 / bits
+	count := d.EndSize - d.StartSize + 1
+	words := p.uint16s(off+6, (count+perWord-1)/perWord)
+	if words == nil {
+		return nil
+	}
+	d.Deltas = make([]int, count)
+	for i := range d.Deltas {
+		shift := 16 - bits*(i%perWord+1)
+		v := (words[i/perWord] >> shift) & (1<<bits - 1)
+		if v >= 1<<(bits-1) {
+			v -= 1 << bits
+		}
+		d.Deltas[i] = v
+	}
+	return d
+}
+
+// anchor reads the anchor table at off, it returns nil for a null offset.
+func (p *layoutParser) anchor(off int) *Anchor {
+	if off < 0 {
+		return nil
+	}
+	a := &Anchor{X: p.int16(off + 2), Y: p.int16(off + 4), AnchorPoint: -1}
+	switch format := p.uint16(off); format {
+	case 1:
+	case 2:
+		a.AnchorPoint = p.uint16(off + 6)
+	case 3:
+		a.XDevice = p.device(p.offset(off, off+6))
+		a.YDevice = p.device(p.offset(off, off+8))
+	default:
+		p.fail(fmt.Errorf("unknown anchor format %d", format))
+	}
+	return a
+}
+
+// anchors reads n anchor offsets at off, relative to base.
+func (p *layoutParser) anchors(base, off, n int) []*Anchor {
+	ret := make([]*Anchor, 0, n)
+	for i := 0; i < n && p.err == nil; i++ {
+		ret = append(ret, p.anchor(p.offset(base, off+2*i)))
+	}
+	return ret
+}
+
+// markArray reads the mark array at off for the marks in cov.
+func (p *layoutParser) markArray(off int, cov Coverage, classCount int) map[int]MarkRecord {
+	count := p.uint16(off)
+	marks := make(map[int]MarkRecord, len(cov))
+	for gid, idx := range cov {
+		if idx >= count {
+			p.fail(errLayoutCorrupt)
+			return nil
+		}
+		rec := off + 2 + 4*idx
+		class := p.uint16(rec)
+		a := p.anchor(p.offset(off, rec+2))
+		if class >= classCount || a == nil {
+			p.fail(errLayoutCorrupt)
+			return nil
+		}
+		marks[gid] = MarkRecord{Class: class, Anchor: *a}
+	}
+	return marks
+}
@@ -0,0 +1,169 @@
+package opentype
+
+import "fmt"
+
+// GSUB lookup types. The subtables of the lookups are *SingleSubst,
+// *MultipleSubst, *AlternateSubst, *LigatureSubst, *SequenceContext,
+// *ChainedSequenceContext and *ReverseChainSingleSubst.
+const (
+	GSUBSingle = iota + 1
+	GSUBMultiple
+	GSUBAlternate
+	GSUBLigature
+	GSUBContext
+	GSUBChainedContext
+	GSUBExtension
+	GSUBReverseChainedContext
+)
+
+// SingleSubst replaces one glyph by another glyph (GSUB type 1).
+type SingleSubst struct {
+	Substitutes map[int]int
+}
+
+// MultipleSubst replaces one glyph by a sequence of glyphs (GSUB type 2).
+type MultipleSubst struct {
+	Sequences map[int][]int
+}
+
+// AlternateSubst has alternative glyphs for a glyph (GSUB type 3).
+type AlternateSubst struct {
+	Alternates map[int][]int
+}
+
+// Ligature is a ligature glyph and its components without the first one.
+type Ligature struct {
+	Glyph      int
+	Components []int
+}
+
+// LigatureSubst replaces sequences of glyphs by ligatures (GSUB type 4). The
+// map key is the first component, the ligatures are in the order of
+// preference.
+type LigatureSubst struct {
+	Ligatures map[int][]Ligature
+}
+
+// ReverseChainSingleSubst replaces one glyph by another glyph in a chained
+// context, it is applied from the end of the text to the start (GSUB type 8).
+// The backtrack coverages start with the glyph next to the input glyph.
+type ReverseChainSingleSubst struct {
+	Coverage           Coverage
+	BacktrackCoverages []Coverage
+	LookaheadCoverages []Coverage
+	Substitutes        map[int]int
+}
+
+func (tt *Font) readGSUB() error {
+	data, err := tt.ReadTableData("GSUB")
+	if err != nil {
+		return err
+	}
+	if tt.GSUB, err = parseLayoutTable(data, GSUBExtension, parseGSUBSubtable); err != nil {
+		return fmt.Errorf("GSUB: %s", err)
+	}
+	return nil
+}
+
+func parseGSUBSubtable(p *layoutParser, lookupType, off int) LookupSubtable {
+	format := p.uint16(off)
+	if lookupType == GSUBContext {
+		return p.sequenceContext(off)
+	}
+	if lookupType == GSUBChainedContext {
+		return p.chainedSequenceContext(off)
+	}
+	if lookupType < GSUBSingle || lookupType > GSUBReverseChainedContext {
+		p.fail(fmt.Errorf("unknown lookup type %d", lookupType))
+		return nil
+	}
+	if format != 1 && !(lookupType == GSUBSingle && format == 2) {
+		p.fail(fmt.Errorf("unknown format %d of lookup type %d", format, lookupType))
+		return nil
+	}
+	cov := p.coverage(off + p.uint16(off+2))
+	switch lookupType {
+	case GSUBSingle:
+		st := &SingleSubst{Substitutes: make(map[int]int, len(cov))}
+		if format == 1 {
+			delta := p.int16(off + 4)
+			for gid := range cov {
+				st.Substitutes[gid] = (gid + delta) & 0xffff
+			}
+		} else {
+			substitutes := p.uint16s(off+6, p.uint16(off+4))
+			for gid, idx := range cov {
+				if idx >= len(substitutes) {
+					p.fail(errLayoutCorrupt)
+					return nil
+				}
+				st.Substitutes[gid] = substitutes[idx]
+			}
+		}
+		return st
+	case GSUBMultiple, GSUBAlternate:
+		sequences := p.sequences(off, off+4, cov)
+		if lookupType == GSUBMultiple {
+			return &MultipleSubst{Sequences: sequences}
+		}
+		return &AlternateSubst{Alternates: sequences}
+	case GSUBLigature:
+		st := &LigatureSubst{Ligatures: make(map[int][]Ligature, len(cov))}
+		setOffsets := p.ruleSetOffsets(off, off+4)
+		for gid, idx := range cov {
+			if idx >= len(setOffsets) || setOffsets[idx] < 0 {
+				p.fail(errLayoutCorrupt)
+				return nil
+			}
+			var ligatures []Ligature
+			for _, ligOffset := range p.ruleSetOffsets(setOffsets[idx], setOffsets[idx]) {
+				componentCount := p.uint16(ligOffset + 2)
+				if componentCount == 0 {
+					p.fail(errLayoutCorrupt)
+					return nil
+				}
+				ligatures = append(ligatures, Ligature{
+					Glyph:      p.uint16(ligOffset),
+					Components: p.uint16s(ligOffset+4, componentCount-1),
+				})
+			}
+			st.Ligatures[gid] = ligatures
+		}
+		return st
+	case GSUBReverseChainedContext:
+		st := &ReverseChainSingleSubst{Coverage: cov}
+		pos := off + 4
+		n := p.uint16(pos)
+		st.BacktrackCoverages = p.coverages(off, pos+2, n)
+		pos += 2 + 2*n
+		n = p.uint16(pos)
+		st.LookaheadCoverages = p.coverages(off, pos+2, n)
+		pos += 2 + 2*n
+		substitutes := p.uint16s(pos+2, p.uint16(pos))
+		st.Substitutes = make(map[int]int, len(cov))
+		for gid, idx := range cov {
+			if idx >= len(substitutes) {
+				p.fail(errLayoutCorrupt)
+				return nil
+			}
+			st.Substitutes[gid] = substitutes[idx]
+		}
+		return st
+	}
+	return nil
+}
+
+// sequences reads the glyph sequences of multiple and alternate
+// substitutions. The offsets at off are indexed by the coverage index.
+func (p *layoutParser) sequences(base, off int, cov Coverage) map[int][]int {
+	offsets := p.ruleSetOffsets(base, off)
+	ret := make(map[int][]int, len(cov))
+	for gid, idx := range cov {
+		if idx >= len(offsets) || offsets[idx] < 0 {
+			p.fail(errLayoutCorrupt)
+			return nil
+		}
+		ret[gid] = p.uint16s(offsets[idx]+2, p.uint16(offsets[idx]))
+	}
+	return ret
+}
@@ -0,0 +1,152 @@
+package opentype
+
+import (
+	"encoding/binary"
+	"fmt"
+)
+
+// kernSubtable is a horizontal subtable of the kern table. Format 0 has the
+// kerning values of glyph pairs, format 2 a two dimensional array of values
+// for classes of glyphs.
+type kernSubtable struct {
+	format   int
+	override bool // the value replaces the sum of the previous subtables
+	pairs    map[[2]int]int
+	// format 2: the class values are byte offsets into data
+	data         []byte
+	arrayOffset  int
+	leftClasses  map[int]int
+	rightClasses map[int]int
+}
+
+// readKern reads the kern table in the Microsoft and in the Apple variant.
+// Only subtables with horizontal kerning values are kept.
+func (tt *Font) readKern() error {
+	data, err := tt.ReadTableData("kern")
+	if err != nil {
+		return err
+	}
+	if tt.kern, err = parseKern(data); err != nil {
+		return fmt.Errorf("kern: %s", err)
+	}
+	return nil
+}
+
+func parseKern(data []byte) ([]kernSubtable, error) {
+	p := &layoutParser{data: data}
+	apple := p.uint16(0) == 1
+	var nTables, pos int
+	if apple {
+		nTables, pos = p.uint32(4), 8
+	} else {
+		nTables, pos = p.uint16(2), 4
+	}
+	var subtables []kernSubtable
+	for i := 0; i < nTables && p.err == nil; i++ {
+		var length, headerLength, format int
+		var horizontal, skip bool
+		st := kernSubtable{}
+		if apple {
+			length, headerLength = p.uint32(pos), 8
+			coverage := p.uint16(pos + 4)
+			format = coverage & 0xff
+			// vertical, cross-stream and variation values
+			skip = coverage&0xe000 != 0
+			horizontal = true
+		} else {
+			length, headerLength = p.uint16(pos+2), 6
+			coverage := p.uint16(pos + 4)
+			format = coverage >> 8
+			horizontal = coverage&0x0001 != 0
+			// minimum and cross-stream values
+			skip = coverage&0x0006 != 0
+			st.override = coverage&0x0008 != 0
+			if nTables == 1 && format == 0 {
+				// the length field can overflow for large format 0 subtables
+				length = len(data) - pos
+			}
+		}
+		if length < headerLength || !p.check(pos, length) {
+			return nil, errLayoutCorrupt
+		}
+		if horizontal && !skip {
+			st.format = format
+			switch format {
+			case 0:
+				p.kernPairs(pos+headerLength, &st)
+				subtables = append(subtables, st)
+			case 2:
+				st.data = data[pos : pos+length]
+				sub := &layoutParser{data: st.data}
+				st.arrayOffset = sub.uint16(headerLength + 6)
+				st.leftClasses = sub.kernClasses(sub.uint16(headerLength + 2))
+				st.rightClasses = sub.kernClasses(sub.uint16(headerLength + 4))
+				if sub.err != nil {
+					return nil, sub.err
+				}
+				subtables = append(subtables, st)
+			}
+		}
+		pos += length
+	}
+	if p.err != nil {
+		return nil, p.err
+	}
+	return subtables, nil
+}
+
+// kernPairs reads the pairs of a format 0 subtable at off.
+func (p *layoutParser) kernPairs(off int, st *kernSubtable) {
+	n := p.uint16(off)
+	if !p.check(off+8, 6*n) {
+		return
+	}
+	st.pairs = make(map[[2]int]int, n)
+	for i := 0; i < n; i++ {
+		rec := off + 8 + 6*i
+		st.pairs[[2]int{p.uint16(rec), p.uint16(rec + 2)}] = p.int16(rec + 4)
+	}
+}
+
+// kernClasses reads a class table of a format 2 subtable.
+func (p *layoutParser) kernClasses(off int) map[int]int {
+	first := p.uint16(off)
+	classes := map[int]int{}
+	for i, v := range p.uint16s(off+4, p.uint16(off+2)) {
+		classes[first+i] = v
+	}
+	return classes
+}
+
+// Kern returns the kerning value of the glyph pair from the kern table in
+// font units. It returns 0 if the font has no kern table.
+func (tt *Font) Kern(left, right int) int {
+	value := 0
+	for _, st := range tt.kern {
+		var v int
+		var ok bool
+		switch st.format {
+		case 0:
+			v, ok = st.pairs[[2]int{left, right}]
+		case 2:
+			var l, r int
+			if l, ok = st.leftClasses[left]; ok && l >= st.arrayOffset {
+				r, ok = st.rightClasses[right]
+			} else {
+				ok = false
+			}
+			if idx := l + r; ok && idx >= 0 && idx+2 <= len(st.data) {
+				v = int(int16(binary.BigEndian.Uint16(st.data[idx:])))
+			}
+		}
+		if !ok {
+			continue
+		}
+		if st.override {
+			value = v
+		} else {
+			value += v
+		}
+	}
+	return value
+}
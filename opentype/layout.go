@@ -0,0 +1,566 @@
+package opentype
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Lookup flags
+const (
+	LookupRightToLeft         = 0x0001
+	LookupIgnoreBaseGlyphs    = 0x0002
+	LookupIgnoreLigatures     = 0x0004
+	LookupIgnoreMarks         = 0x0008
+	LookupUseMarkFilteringSet = 0x0010
+	LookupMarkAttachmentType  = 0xff00
+)
+
+// layoutTables are read by ReadTables if the font has them. Errors in these
+// tables do not stop reading the font, see Font.TableErrors.
+var layoutTables = []string{"GDEF", "GSUB", "GPOS", "kern"}
+
+var errLayoutCorrupt = errors.New("corrupt layout table")
+
+// LayoutTable is the common structure of the GSUB and the GPOS table.
+type LayoutTable struct {
+	Scripts  []Script
+	Features []Feature
+	Lookups  []Lookup
+}
+
+// Script is an entry of the script list.
+type Script struct {
+	Tag             string
+	DefaultLanguage *Language // nil if the script has no default language system
+	Languages       []Language
+}
+
+// Language is a language system of a script.
+type Language struct {
+	Tag             string
+	RequiredFeature int   // index into the features or -1
+	Features        []int // indexes into the features
+}
+
+// Feature is an entry of the feature list.
+type Feature struct {
+	Tag     string
+	Lookups []int // indexes into the lookups
+}
+
+// Lookup is an entry of the lookup list. The subtables of extension lookups
+// are resolved, Type is the type of the extension subtables.
+type Lookup struct {
+	Type             int
+	Flag             uint16
+	MarkFilteringSet int // index of the mark glyph set in GDEF if the flag has LookupUseMarkFilteringSet
+	Subtables        []LookupSubtable
+}
+
+// LookupSubtable is a subtable of a lookup. See the GSUB and GPOS types for
+// the possible values.
+type LookupSubtable interface{}
+
+// Coverage maps the glyph ids of a coverage table to their coverage index.
+type Coverage map[int]int
+
+// ClassDef maps glyph ids to their class. Glyphs not in the map have class 0.
+type ClassDef map[int]int
+
+// SequenceLookup is a lookup that is applied at a position of the input
+// sequence of a context.
+type SequenceLookup struct {
+	SequenceIndex int
+	LookupIndex   int
+}
+
+// SequenceRule is a rule of a sequence context. Input are the glyphs or
+// classes of the input sequence without the first one.
+type SequenceRule struct {
+	Input   []int
+	Lookups []SequenceLookup
+}
+
+// SequenceContext is a contextual lookup subtable (GSUB type 5, GPOS type 7).
+// Format 1 has glyph based rules, RuleSets is indexed by the coverage index
+// of the first glyph. Format 2 has class based rules, RuleSets is indexed by
+// the class of the first glyph. Format 3 has one coverage table per input
+// glyph in InputCoverages and the lookups in Lookups.
+type SequenceContext struct {
+	Format         int
+	Coverage       Coverage
+	RuleSets       [][]SequenceRule
+	ClassDef       ClassDef
+	InputCoverages []Coverage
+	Lookups        []SequenceLookup
+}
+
+// ChainedSequenceRule is a rule of a chained sequence context. The backtrack
+// sequence starts with the glyph next to the input sequence. Input are the
+// glyphs or classes of the input sequence without the first one.
+type ChainedSequenceRule struct {
+	Backtrack []int
+	Input     []int
+	Lookahead []int
+	Lookups   []SequenceLookup
+}
+
+// ChainedSequenceContext is a chained contextual lookup subtable (GSUB type 6,
+// GPOS type 8). The formats are the same as for SequenceContext, format 2
+// has separate class definitions for the three sequences. The backtrack
+// coverages of format 3 start with the glyph next to the input sequence.
+type ChainedSequenceContext struct {
+	Format             int
+	Coverage           Coverage
+	RuleSets           [][]ChainedSequenceRule
+	BacktrackClassDef  ClassDef
+	InputClassDef      ClassDef
+	LookaheadClassDef  ClassDef
+	BacktrackCoverages []Coverage
+	InputCoverages     []Coverage
+	LookaheadCoverages []Coverage
+	Lookups            []SequenceLookup
+}
+
+// FindScript returns the script with the tag or the default script (DFLT) if
+// there is no such script. It returns nil if there is neither.
+func (l *LayoutTable) FindScript(tag string) *Script {
+	tag = layoutTag(tag)
+	var dflt *Script
+	for i := range l.Scripts {
+		switch l.Scripts[i].Tag {
+		case tag:
+			return &l.Scripts[i]
+		case "DFLT":
+			dflt = &l.Scripts[i]
+		}
+	}
+	return dflt
+}
+
+// FindLanguage returns the language system with the tag or the default
+// language system if there is no such language. The result can be nil.
+func (s *Script) FindLanguage(tag string) *Language {
+	tag = layoutTag(tag)
+	for i := range s.Languages {
+		if s.Languages[i].Tag == tag {
+			return &s.Languages[i]
+		}
+	}
+	return s.DefaultLanguage
+}
+
+// FeatureTags returns the sorted tags of all features of the table.
+func (l *LayoutTable) FeatureTags() []string {
+	seen := map[string]bool{}
+	var tags []string
+	for _, f := range l.Features {
+		if !seen[f.Tag] {
+			seen[f.Tag] = true
+			tags = append(tags, f.Tag)
+		}
+	}
+	sort.Strings(tags)
+	return tags
+}
+
+// LookupIndexes returns the sorted indexes of the lookups for the features in
+// the script and language. The required feature of the language is always
+// included.
+func (l *LayoutTable) LookupIndexes(script, language string, features []string) []int {
+	s := l.FindScript(script)
+	if s == nil {
+		return nil
+	}
+	lang := s.FindLanguage(language)
+	if lang == nil {
+		return nil
+	}
+	want := map[string]bool{}
+	for _, f := range features {
+		want[layoutTag(f)] = true
+	}
+	fidx := lang.Features
+	if lang.RequiredFeature >= 0 {
+		fidx = append([]int{lang.RequiredFeature}, fidx...)
+	}
+	seen := map[int]bool{}
+	var lookups []int
+	for _, fi := range fidx {
+		f := l.Features[fi]
+		if !want[f.Tag] && fi != lang.RequiredFeature {
+			continue
+		}
+		for _, li := range f.Lookups {
+			if !seen[li] {
+				seen[li] = true
+				lookups = append(lookups, li)
+			}
+		}
+	}
+	sort.Ints(lookups)
+	return lookups
+}
+
+// layoutTag pads a script, language or feature tag with spaces.
+func layoutTag(tag string) string {
+	if len(tag) < 4 {
+		tag += strings.Repeat(" ", 4-len(tag))
+	}
+	return tag
+}
+
+// layoutParser reads the offset based structures of the layout tables. All
+// offsets are absolute positions in data. After an error all subsequent
+// reads return zero and the first error is kept in err.
+type layoutParser struct {
+	data []byte
+	err  error
+}
+
+// fail keeps err if it is the first error.
+func (p *layoutParser) fail(err error) {
+	if p.err == nil {
+		p.err = err
+	}
+}
+
+func (p *layoutParser) check(off, n int) bool {
+	if p.err != nil {
+		return false
+	}
+	if off < 0 || n < 0 || off+n > len(p.data) {
+		p.err = errLayoutCorrupt
+		return false
+	}
+	return true
+}
+
+func (p *layoutParser) uint16(off int) int {
+	if !p.check(off, 2) {
+		return 0
+	}
+	return int(binary.BigEndian.Uint16(p.data[off:]))
+}
+
+func (p *layoutParser) int16(off int) int {
+	return int(int16(p.uint16(off)))
+}
+
+func (p *layoutParser) uint32(off int) int {
+	if !p.check(off, 4) {
+		return 0
+	}
+	return int(binary.BigEndian.Uint32(p.data[off:]))
+}
+
+func (p *layoutParser) tag(off int) string {
+	if !p.check(off, 4) {
+		return ""
+	}
+	return string(p.data[off : off+4])
+}
+
+// offset reads the Offset16 at off and returns base plus the offset or -1 for
+// a null offset.
+func (p *layoutParser) offset(base, off int) int {
+	o := p.uint16(off)
+	if o == 0 {
+		return -1
+	}
+	return base + o
+}
+
+// uint16s reads n uint16 values at off.
+func (p *layoutParser) uint16s(off, n int) []int {
+	if !p.check(off, 2*n) {
+		return nil
+	}
+	ret := make([]int, n)
+	for i := range ret {
+		ret[i] = int(binary.BigEndian.Uint16(p.data[off+2*i:]))
+	}
+	return ret
+}
+
+func (p *layoutParser) coverage(off int) Coverage {
+	cov := Coverage{}
+	switch format := p.uint16(off); format {
+	case 1:
+		for i, gid := range p.uint16s(off+4, p.uint16(off+2)) {
+			cov[gid] = i
+		}
+	case 2:
+		n := p.uint16(off + 2)
+		if !p.check(off+4, 6*n) {
+			return cov
+		}
+		for i := 0; i < n; i++ {
+			r := off + 4 + 6*i
+			start, end, idx := p.uint16(r), p.uint16(r+2), p.uint16(r+4)
+			for gid := start; gid <= end; gid++ {
+				cov[gid] = idx + gid - start
+			}
+		}
+	default:
+		p.fail(fmt.Errorf("unknown coverage format %d", format))
+	}
+	return cov
+}
+
+// coverages reads n offsets to coverage tables at off, relative to base.
+func (p *layoutParser) coverages(base, off, n int) []Coverage {
+	ret := make([]Coverage, 0, n)
+	for i := 0; i < n && p.err == nil; i++ {
+		ret = append(ret, p.coverage(base+p.uint16(off+2*i)))
+	}
+	return ret
+}
+
+func (p *layoutParser) classDef(off int) ClassDef {
+	cd := ClassDef{}
+	if off < 0 {
+		return cd
+	}
+	switch format := p.uint16(off); format {
+	case 1:
+		start := p.uint16(off + 2)
+		for i, class := range p.uint16s(off+6, p.uint16(off+4)) {
+			if class != 0 {
+				cd[start+i] = class
+			}
+		}
+	case 2:
+		n := p.uint16(off + 2)
+		if !p.check(off+4, 6*n) {
+			return cd
+		}
+		for i := 0; i < n; i++ {
+			r := off + 4 + 6*i
+			start, end, class := p.uint16(r), p.uint16(r+2), p.uint16(r+4)
+			for gid := start; gid <= end && class != 0; gid++ {
+				cd[gid] = class
+			}
+		}
+	default:
+		p.fail(fmt.Errorf("unknown class definition format %d", format))
+	}
+	return cd
+}
+
+func (p *layoutParser) sequenceLookups(off, n int) []SequenceLookup {
+	values := p.uint16s(off, 2*n)
+	if values == nil {
+		return nil
+	}
+	ret := make([]SequenceLookup, n)
+	for i := range ret {
+		ret[i] = SequenceLookup{SequenceIndex: values[2*i], LookupIndex: values[2*i+1]}
+	}
+	return ret
+}
+
+// ruleSetOffsets reads the count and the offsets of the rule sets at off and
+// returns the absolute positions, -1 for null offsets.
+func (p *layoutParser) ruleSetOffsets(base, off int) []int {
+	n := p.uint16(off)
+	ret := make([]int, 0, n)
+	for i := 0; i < n && p.err == nil; i++ {
+		ret = append(ret, p.offset(base, off+2+2*i))
+	}
+	return ret
+}
+
+func (p *layoutParser) sequenceContext(off int) *SequenceContext {
+	sc := &SequenceContext{Format: p.uint16(off)}
+	switch sc.Format {
+	case 1, 2:
+		sc.Coverage = p.coverage(off + p.uint16(off+2))
+		setsOffset := off + 4
+		if sc.Format == 2 {
+			sc.ClassDef = p.classDef(p.offset(off, off+4))
+			setsOffset = off + 6
+		}
+		for _, setOffset := range p.ruleSetOffsets(off, setsOffset) {
+			var rules []SequenceRule
+			if setOffset >= 0 {
+				for _, ruleOffset := range p.ruleSetOffsets(setOffset, setOffset) {
+					glyphCount, lookupCount := p.uint16(ruleOffset), p.uint16(ruleOffset+2)
+					if glyphCount == 0 {
+						p.fail(errLayoutCorrupt)
+						return sc
+					}
+					rules = append(rules, SequenceRule{
+						Input:   p.uint16s(ruleOffset+4, glyphCount-1),
+						Lookups: p.sequenceLookups(ruleOffset+4+2*(glyphCount-1), lookupCount),
+					})
+				}
+			}
+			sc.RuleSets = append(sc.RuleSets, rules)
+		}
+	case 3:
+		glyphCount, lookupCount := p.uint16(off+2), p.uint16(off+4)
+		sc.InputCoverages = p.coverages(off, off+6, glyphCount)
+		sc.Lookups = p.sequenceLookups(off+6+2*glyphCount, lookupCount)
+	default:
+		p.fail(fmt.Errorf("unknown sequence context format %d", sc.Format))
+	}
+	return sc
+}
+
+func (p *layoutParser) chainedSequenceContext(off int) *ChainedSequenceContext {
+	sc := &ChainedSequenceContext{Format: p.uint16(off)}
+	switch sc.Format {
+	case 1, 2:
+		sc.Coverage = p.coverage(off + p.uint16(off+2))
+		setsOffset := off + 4
+		if sc.Format == 2 {
+			sc.BacktrackClassDef = p.classDef(p.offset(off, off+4))
+			sc.InputClassDef = p.classDef(p.offset(off, off+6))
+			sc.LookaheadClassDef = p.classDef(p.offset(off, off+8))
+			setsOffset = off + 10
+		}
+		for _, setOffset := range p.ruleSetOffsets(off, setsOffset) {
+			var rules []ChainedSequenceRule
+			if setOffset >= 0 {
+				for _, ruleOffset := range p.ruleSetOffsets(setOffset, setOffset) {
+					var rule ChainedSequenceRule
+					pos := ruleOffset
+					n := p.uint16(pos)
+					rule.Backtrack = p.uint16s(pos+2, n)
+					pos += 2 + 2*n
+					if n = p.uint16(pos); n == 0 {
+						p.fail(errLayoutCorrupt)
+						return sc
+					}
+					rule.Input = p.uint16s(pos+2, n-1)
+					pos += 2 * n
+					n = p.uint16(pos)
+					rule.Lookahead = p.uint16s(pos+2, n)
+					pos += 2 + 2*n
+					rule.Lookups = p.sequenceLookups(pos+2, p.uint16(pos))
+					rules = append(rules, rule)
+				}
+			}
+			sc.RuleSets = append(sc.RuleSets, rules)
+		}
+	case 3:
+		pos := off + 2
+		n := p.uint16(pos)
+		sc.BacktrackCoverages = p.coverages(off, pos+2, n)
+		pos += 2 + 2*n
+		n = p.uint16(pos)
+		sc.InputCoverages = p.coverages(off, pos+2, n)
+		pos += 2 + 2*n
+		n = p.uint16(pos)
+		sc.LookaheadCoverages = p.coverages(off, pos+2, n)
+		pos += 2 + 2*n
+		sc.Lookups = p.sequenceLookups(pos+2, p.uint16(pos))
+	default:
+		p.fail(fmt.Errorf("unknown chained sequence context format %d", sc.Format))
+	}
+	return sc
+}
+
+// parseLayoutTable reads the script, feature and lookup lists of a GSUB or
+// GPOS table. Lookups of type extensionType are extension lookups,
+// parseSubtable reads the other lookup subtables.
+func parseLayoutTable(data []byte, extensionType int, parseSubtable func(p *layoutParser, lookupType, off int) LookupSubtable) (*LayoutTable, error) {
+	p := &layoutParser{data: data}
+	if major := p.uint16(0); p.err == nil && major != 1 {
+		return nil, fmt.Errorf("unknown version %d.%d", major, p.uint16(2))
+	}
+	scriptList, featureList, lookupList := p.uint16(4), p.uint16(6), p.uint16(8)
+	l := &LayoutTable{}
+
+	n := p.uint16(featureList)
+	for i := 0; i < n && p.err == nil; i++ {
+		rec := featureList + 2 + 6*i
+		off := featureList + p.uint16(rec+4)
+		l.Features = append(l.Features, Feature{
+			Tag:     p.tag(rec),
+			Lookups: p.uint16s(off+4, p.uint16(off+2)),
+		})
+	}
+
+	n = p.uint16(scriptList)
+	for i := 0; i < n && p.err == nil; i++ {
+		rec := scriptList + 2 + 6*i
+		off := scriptList + p.uint16(rec+4)
+		s := Script{Tag: p.tag(rec)}
+		if langOffset := p.offset(off, off); langOffset >= 0 {
+			lang := p.language(langOffset, "dflt", len(l.Features))
+			s.DefaultLanguage = &lang
+		}
+		langCount := p.uint16(off + 2)
+		for j := 0; j < langCount && p.err == nil; j++ {
+			langRec := off + 4 + 6*j
+			s.Languages = append(s.Languages, p.language(off+p.uint16(langRec+4), p.tag(langRec), len(l.Features)))
+		}
+		l.Scripts = append(l.Scripts, s)
+	}
+
+	n = p.uint16(lookupList)
+	for i := 0; i < n && p.err == nil; i++ {
+		off := lookupList + p.uint16(lookupList+2+2*i)
+		lookup := Lookup{Type: p.uint16(off), Flag: uint16(p.uint16(off + 2))}
+		subtableCount := p.uint16(off + 4)
+		if lookup.Flag&LookupUseMarkFilteringSet != 0 {
+			lookup.MarkFilteringSet = p.uint16(off + 6 + 2*subtableCount)
+		}
+		for j := 0; j < subtableCount && p.err == nil; j++ {
+			subOffset := off + p.uint16(off+6+2*j)
+			lookupType := lookup.Type
+			if lookupType == extensionType {
+				if format := p.uint16(subOffset); format != 1 {
+					return nil, fmt.Errorf("unknown extension format %d", format)
+				}
+				lookupType = p.uint16(subOffset + 2)
+				subOffset += p.uint32(subOffset + 4)
+				if lookupType == extensionType {
+					return nil, fmt.Errorf("extension lookup %d refers to an extension", i)
+				}
+				if j == 0 {
+					lookup.Type = lookupType
+				} else if lookupType != lookup.Type {
+					return nil, fmt.Errorf("lookup %d has subtables of different types", i)
+				}
+			}
+			if st := parseSubtable(p, lookupType, subOffset); st != nil {
+				lookup.Subtables = append(lookup.Subtables, st)
+			}
+		}
+		l.Lookups = append(l.Lookups, lookup)
+	}
+	if p.err != nil {
+		return nil, p.err
+	}
+	for _, f := range l.Features {
+		for _, li := range f.Lookups {
+			if li >= len(l.Lookups) {
+				return nil, fmt.Errorf("feature %s refers to lookup %d which does not exist", f.Tag, li)
+			}
+		}
+	}
+	return l, nil
+}
+
+func (p *layoutParser) language(off int, tag string, numFeatures int) Language {
+	lang := Language{Tag: tag, RequiredFeature: p.uint16(off + 2)}
+	if lang.RequiredFeature == 0xffff {
+		lang.RequiredFeature = -1
+	}
+	lang.Features = p.uint16s(off+6, p.uint16(off+4))
+	if lang.RequiredFeature >= numFeatures {
+		p.fail(errLayoutCorrupt)
+	}
+	for _, fi := range lang.Features {
+		if fi >= numFeatures {
+			p.fail(errLayoutCorrupt)
+		}
+	}
+	return lang
+}
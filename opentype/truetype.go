@@ -10,7 +10,9 @@ import (
 	"math"
 	"os"
 	"sort"
+	"strconv"
 	"strings"
+	"unicode"
 	"unicode/utf16"
 
 	"github.com/speedata/gootf/cff"
@@ -98,7 +100,9 @@ func (tt *Font) readTable(tbl string) error {
 		if err != nil {
 			return err
 		}
-		tt.CFF.Fontindex = tt.fontindex
+		if !tt.IsCollection {
+			tt.CFF.Fontindex = tt.fontindex
+		}
 	case "head":
 		if err = tt.readHead(thistable); err != nil {
 			return err
@@ -147,17 +151,44 @@ func (tt *Font) readTable(tbl string) error {
 		if err = tt.readName(off); err != nil {
 			return err
 		}
-	// case "kern":
-	// 	// tt.readKern(off)
+	case "kern":
+		if err = tt.readKern(); err != nil {
+			return err
+		}
 	case "hhea":
 		tt.readHhea(off)
+	case "vhea":
+		if err = tt.readVhea(thistable); err != nil {
+			return err
+		}
+	case "vmtx":
+		if err = tt.readVmtx(thistable); err != nil {
+			return err
+		}
+	case "VORG":
+		if err = tt.readVORG(thistable); err != nil {
+			return err
+		}
+	case "GDEF":
+		if err = tt.readGDEF(); err != nil {
+			return err
+		}
+	case "GSUB":
+		if err = tt.readGSUB(); err != nil {
+			return err
+		}
+	case "GPOS":
+		if err = tt.readGPOS(); err != nil {
+			return err
+		}
 	default:
 		// fmt.Printf("    skip table %s\n", tbl)
 	}
 	return nil
 }
 
-// WriteTable writes the table to w.
+// WriteTable writes the table to w. Tables that gootf does not interpret are
+// copied unchanged from the font file.
 func (tt *Font) WriteTable(w io.Writer, tbl string) error {
 	var err error
 	switch tbl {
@@ -173,6 +204,12 @@ func (tt *Font) WriteTable(w io.Writer, tbl string) error {
 		err = tt.writeMaxp(w)
 	case "hmtx":
 		err = tt.writeHmtx(w)
+	case "vhea":
+		err = tt.writeVhea(w)
+	case "vmtx":
+		err = tt.writeVmtx(w)
+	case "VORG":
+		err = tt.writeVORG(w)
 	case "fpgm":
 		err = tt.writeFpgm(w)
 	case "cvt ":
@@ -185,8 +222,16 @@ func (tt *Font) WriteTable(w io.Writer, tbl string) error {
 		err = tt.writePost(w)
 	case "OS/2":
 		err = tt.writeOs2(w)
+	case "name":
+		err = tt.writeName(w)
+	case "cmap":
+		err = tt.writeCmap(w)
 	default:
-		// fmt.Printf("    skip write table %s\n", tbl)
+		// no writer for this table, copy the original data
+		var data []byte
+		if data, err = tt.ReadTableData(tbl); err == nil {
+			_, err = w.Write(data)
+		}
 	}
 	if err != nil {
 		return err
@@ -194,60 +239,187 @@ func (tt *Font) WriteTable(w io.Writer, tbl string) error {
 	return nil
 }
 
-// readName reads the name table from the TrueType font.
+// readName reads the name table from the TrueType font. All name records are
+// kept for writing, the names map has the first record for each name id.
 func (tt *Font) readName(offset int64) error {
 	var version, count, stringOffset uint16
 	tt.read(&version)
 	tt.read(&count)
 	tt.read(&stringOffset)
+	if version > 1 {
+		return fmt.Errorf("unsupported name table version %d", version)
+	}
 
 	type nameentry struct {
-		platformID, encodingID, languageID, nameID, length uint16
-		offset                                             int64
+		record         nameRecord
+		length, offset uint16
+	}
+	entries := make([]nameentry, count)
+	for i := range entries {
+		ne := &entries[i]
+		tt.read(&ne.record.platformID)
+		tt.read(&ne.record.encodingID)
+		tt.read(&ne.record.languageID)
+		tt.read(&ne.record.nameID)
+		tt.read(&ne.length)
+		tt.read(&ne.offset)
+	}
+	// version 1 has language tag records (length, offset)
+	var langTags []uint16
+	if version == 1 {
+		var langTagCount uint16
+		tt.read(&langTagCount)
+		langTags = make([]uint16, 2*int(langTagCount))
+		tt.read(langTags)
+	}
+	readString := func(length, o uint16) []byte {
+		tt.r.Seek(offset+int64(stringOffset)+int64(o), io.SeekStart)
+		buf := make([]byte, length)
+		tt.read(buf)
+		return buf
+	}
+
+	tt.nameRecords = make([]nameRecord, 0, len(entries))
+	for _, ne := range entries {
+		ne.record.data = readString(ne.length, ne.offset)
+		tt.nameRecords = append(tt.nameRecords, ne.record)
+		if _, ok := tt.names[int(ne.record.nameID)]; !ok {
+			tt.names[int(ne.record.nameID)] = decodeName(ne.record.platformID, ne.record.data)
+		}
 	}
-	var names []nameentry
-	switch version {
-	case 0:
-		for i := uint16(0); i < count; i++ {
-			ne := nameentry{}
-			tt.read(&ne.platformID)
-			tt.read(&ne.encodingID)
-			tt.read(&ne.languageID)
-			tt.read(&ne.nameID)
-			tt.read(&ne.length)
-			var o uint16
-			tt.read(&o)
-			ne.offset = int64(o)
-			names = append(names, ne)
-		}
-		for _, ne := range names {
-			tt.r.Seek(ne.offset+int64(stringOffset)+offset, io.SeekStart)
-			if _, ok := tt.names[int(ne.nameID)]; ok {
-				continue
-			}
-			if ne.platformID == 3 && ne.encodingID == 1 {
-				var dec []uint16
-				c := uint16(0)
-				for {
-					c += 2
-					if c > ne.length {
-						break
-					}
-					var char uint16
-					tt.read(&char)
-					dec = append(dec, char)
-				}
-				tt.names[int(ne.nameID)] = string(utf16.Decode(dec))
-			} else {
-				buf := make([]byte, ne.length)
-				tt.r.Read(buf)
-				tt.names[int(ne.nameID)] = string(buf)
+	tt.nameLangTags = nil
+	for i := 0; i < len(langTags); i += 2 {
+		tt.nameLangTags = append(tt.nameLangTags, readString(langTags[i], langTags[i+1]))
+	}
+	tt.FontName = tt.names[6]
+	return nil
+}
+
+// decodeName returns the string of a name record. The Unicode and Windows
+// platforms use UTF-16BE, the other platforms are read as single byte
+// strings.
+func decodeName(platformID uint16, data []byte) string {
+	if platformID != 0 && platformID != 3 {
+		return string(data)
+	}
+	dec := make([]uint16, len(data)/2)
+	for i := range dec {
+		dec[i] = binary.BigEndian.Uint16(data[2*i:])
+	}
+	return string(utf16.Decode(dec))
+}
+
+// encodeName is the reverse of decodeName. Characters that can't be encoded
+// in a single byte string are replaced by a question mark.
+func encodeName(platformID uint16, name string) []byte {
+	if platformID != 0 && platformID != 3 {
+		ret := make([]byte, 0, len(name))
+		for _, r := range name {
+			if r > 0x7f {
+				r = '?'
 			}
+			ret = append(ret, byte(r))
 		}
-	default:
-		panic("not implemented yet: name version != 0")
+		return ret
+	}
+	enc := utf16.Encode([]rune(name))
+	ret := make([]byte, 2*len(enc))
+	for i, c := range enc {
+		binary.BigEndian.PutUint16(ret[2*i:], c)
+	}
+	return ret
+}
+
+// writeName writes the name table with all name records. Equal strings are
+// stored only once.
+func (tt *Font) writeName(w io.Writer) error {
+	records := make([]nameRecord, len(tt.nameRecords))
+	copy(records, tt.nameRecords)
+	sort.SliceStable(records, func(i, j int) bool {
+		a, b := records[i], records[j]
+		if a.platformID != b.platformID {
+			return a.platformID < b.platformID
+		}
+		if a.encodingID != b.encodingID {
+			return a.encodingID < b.encodingID
+		}
+		if a.languageID != b.languageID {
+			return a.languageID < b.languageID
+		}
+		return a.nameID < b.nameID
+	})
+
+	var storage bytes.Buffer
+	stringOffsets := make(map[string]int)
+	stringOffset := func(data []byte) uint16 {
+		o, ok := stringOffsets[string(data)]
+		if !ok {
+			o = storage.Len()
+			stringOffsets[string(data)] = o
+			storage.Write(data)
+		}
+		return uint16(o)
+	}
+
+	var version uint16
+	headerLength := 6 + 12*len(records)
+	if len(tt.nameLangTags) > 0 {
+		version = 1
+		headerLength += 2 + 4*len(tt.nameLangTags)
+	}
+	var header bytes.Buffer
+	tt.write(&header, version)
+	tt.write(&header, uint16(len(records)))
+	tt.write(&header, uint16(headerLength))
+	for _, rec := range records {
+		tt.write(&header, []uint16{rec.platformID, rec.encodingID, rec.languageID, rec.nameID, uint16(len(rec.data))})
+		tt.write(&header, stringOffset(rec.data))
+	}
+	if version == 1 {
+		tt.write(&header, uint16(len(tt.nameLangTags)))
+		for _, tag := range tt.nameLangTags {
+			tt.write(&header, uint16(len(tag)))
+			tt.write(&header, stringOffset(tag))
+		}
+	}
+	if storage.Len() > 0xFFFF {
+		return fmt.Errorf("name table: string storage too large")
+	}
+	header.WriteTo(w)
+	storage.WriteTo(w)
+	return nil
+}
+
+// SetName changes the name with the given id (for example 1 for the font
+// family or 6 for the PostScript name) in all name records. If the font has
+// no record for the id, a Windows record for US English is added.
+func (tt *Font) SetName(id int, name string) error {
+	if _, ok := tt.tables["name"]; ok && !tt.tablesRead["name"] {
+		if err := tt.readTable("name"); err != nil {
+			return err
+		}
+	}
+	tt.tablesRead["name"] = true
+	found := false
+	for i, rec := range tt.nameRecords {
+		if int(rec.nameID) == id {
+			tt.nameRecords[i].data = encodeName(rec.platformID, name)
+			found = true
+		}
+	}
+	if !found {
+		tt.nameRecords = append(tt.nameRecords, nameRecord{
+			platformID: 3,
+			encodingID: 1,
+			languageID: 0x409,
+			nameID:     uint16(id),
+			data:       encodeName(3, name),
+		})
+	}
+	tt.names[id] = name
+	if id == 6 {
+		tt.FontName = name
 	}
-	tt.FontName = tt.names[6]
 	return nil
 }
 
@@ -331,15 +503,14 @@ func (tt *Font) readHmtx(tbl tableOffsetLength) error {
 }
 
 func (tt *Font) writeHmtx(w io.Writer) error {
-	l := len(tt.advanceWidth)
+	l := int(tt.Hhea.NumberOfHMetrics)
 	for i := 0; i < l; i++ {
 		tt.write(w, tt.advanceWidth[i])
 		tt.write(w, tt.lsb[i])
 	}
-	lLsb := len(tt.lsb) - l
-
-	for i := 0; i < lLsb; i++ {
-		tt.write(w, tt.lsb[i+l])
+	// the remaining glyphs have the same advance width as the last one
+	for i := l; i < len(tt.lsb); i++ {
+		tt.write(w, tt.lsb[i])
 	}
 	return nil
 }
@@ -437,6 +608,25 @@ func (tt *Font) readOs2(tbl tableOffsetLength) error {
 
 func (tt *Font) writeOs2(w io.Writer) error {
 	tt.write(w, tt.OS2)
+	add := tt.OS2AdditionalFields
+
+	if tt.OS2.Version > 0 {
+		tt.write(w, add.UlCodePageRange1)
+		tt.write(w, add.UlCodePageRange2)
+	}
+
+	if tt.OS2.Version > 1 {
+		tt.write(w, add.SxHeight)
+		tt.write(w, add.SCapHeight)
+		tt.write(w, add.UsDefaultChar)
+		tt.write(w, add.UsBreakChar)
+		tt.write(w, add.UsMaxContext)
+	}
+
+	if tt.OS2.Version > 4 {
+		tt.write(w, add.UsLowerOpticalPointSize)
+		tt.write(w, add.UsUpperOpticalPointSize)
+	}
 	return nil
 }
 
@@ -649,23 +839,12 @@ func (tt *Font) writeGlyf(w io.Writer) error {
 	return nil
 }
 
-func (tt *Font) readKern(tbl tableOffsetLength) error {
-	var version, nTables uint16
-	tt.read(&version)
-	tt.read(&nTables)
-
-	for i := uint16(0); i < nTables; i++ {
-		tt.read(&version)
-	}
-	return nil
-}
-
 // readCmap reads the cmap table from an OpenType font.
 func (tt *Font) readCmap(tbl tableOffsetLength) error {
 	var version uint16
-	var subtables uint16
+	var numSubtables uint16
 	tt.read(&version)
-	tt.read(&subtables)
+	tt.read(&numSubtables)
 
 	type cmaptbl struct {
 		platform, encoding uint16
@@ -674,7 +853,7 @@ func (tt *Font) readCmap(tbl tableOffsetLength) error {
 	cmaptables := make(map[uint32]cmaptbl)
 	var offsetCMap uint32
 
-	for i := uint16(0); i < subtables; i++ {
+	for i := uint16(0); i < numSubtables; i++ {
 		ct := cmaptbl{}
 		tt.read(&ct.platform)
 		tt.read(&ct.encoding)
@@ -686,12 +865,30 @@ func (tt *Font) readCmap(tbl tableOffsetLength) error {
 	if err != nil {
 		return err
 	}
+	// format 0 is used only if there is no other subtable, format 12 adds
+	// to the format 4 characters
+	type subtable struct {
+		offset uint32
+		format uint16
+	}
+	subtables := make([]subtable, 0, len(cmaptables))
 	for offsetCMap := range cmaptables {
+		st := subtable{offset: offsetCMap}
 		tt.r.Seek(int64(tbl.offset)+int64(offsetCMap), io.SeekStart)
-		var format uint16
-		tt.read(&format)
+		tt.read(&st.format)
+		subtables = append(subtables, st)
+	}
+	sort.Slice(subtables, func(i, j int) bool {
+		if subtables[i].format != subtables[j].format {
+			return subtables[i].format < subtables[j].format
+		}
+		return subtables[i].offset < subtables[j].offset
+	})
+	for _, st := range subtables {
+		offsetCMap := st.offset
+		tt.r.Seek(int64(tbl.offset)+int64(offsetCMap)+2, io.SeekStart)
 
-		switch format {
+		switch format := st.format; format {
 		case 0:
 			if len(tt.ToUni) == 0 {
 				tt.ToUni = make(map[int]rune, 256)
@@ -750,15 +947,23 @@ func (tt *Font) readCmap(tbl tableOffsetLength) error {
 				if s == 0xffff {
 					break
 				}
+				// glyph ids are calculated modulo 65536
 				if ro == 0 {
-					for j := s; j <= e; j++ {
-						tt.ToUni[int(j)+int(delta)] = rune(j)
-						tt.ToCodepoint[rune(j)] = int(j) + int(delta)
+					for j := int(s); j <= int(e); j++ {
+						cp := (j + int(delta)) & 0xffff
+						tt.ToUni[cp] = rune(j)
+						tt.ToCodepoint[rune(j)] = cp
 					}
 				} else {
-					for j := s; j <= e; j++ {
-						offset := uint32(ro) + 2*uint32(i-int(segCount)+int(j-s))
+					for j := int(s); j <= int(e); j++ {
+						offset := uint32(ro) + 2*uint32(i-int(segCount)+j-int(s))
+						if pos+offset+1 >= uint32(len(rawTable)) {
+							return fmt.Errorf("cmap: invalid idRangeOffset")
+						}
 						cp := int(rawTable[pos+offset])<<8 + int(rawTable[pos+offset+1])
+						if cp != 0 {
+							cp = (cp + int(delta)) & 0xffff
+						}
 						tt.ToUni[cp] = rune(j)
 						tt.ToCodepoint[rune(j)] = cp
 					}
@@ -768,29 +973,40 @@ func (tt *Font) readCmap(tbl tableOffsetLength) error {
 		// Trimmed table mapping
 		// ignore
 		case 12:
-			if len(tt.ToUni) == 0 {
+			if tt.ToUni == nil {
 				tt.ToUni = make(map[int]rune, 256)
 				tt.ToCodepoint = make(map[rune]int, 256)
+			}
 
-				// Segmented coverage
-				var zero uint16
-				var length, language, ngroups uint32
-				var startCharCode, endCharCode, startGlyphID uint32
-				tt.read(&zero)
-				tt.read(&length)
-				tt.read(&language)
-				tt.read(&ngroups)
-
-				for i := uint32(0); i < ngroups; i++ {
-					tt.read(&startCharCode)
-					tt.read(&endCharCode)
-					tt.read(&startGlyphID)
-					for i, c := 0, startCharCode; c <= endCharCode; i, c = i+1, c+1 {
-						tt.ToUni[int(startGlyphID)+i] = rune(c)
-						tt.ToCodepoint[rune(c)] = int(startGlyphID) + i
-					}
+			// Segmented coverage
+			var zero uint16
+			var length, language, ngroups uint32
+			var startCharCode, endCharCode, startGlyphID uint32
+			tt.read(&zero)
+			tt.read(&length)
+			tt.read(&language)
+			tt.read(&ngroups)
+
+			for i := uint32(0); i < ngroups; i++ {
+				tt.read(&startCharCode)
+				tt.read(&endCharCode)
+				tt.read(&startGlyphID)
+				if endCharCode > unicode.MaxRune {
+					return fmt.Errorf("cmap: invalid character code %d", endCharCode)
 				}
+				for i, c := 0, startCharCode; c <= endCharCode; i, c = i+1, c+1 {
+					tt.ToUni[int(startGlyphID)+i] = rune(c)
+					tt.ToCodepoint[rune(c)] = int(startGlyphID) + i
+				}
+			}
+		case 14:
+			// Unicode variation sequences, kept unchanged
+			var length uint32
+			tt.read(&length)
+			if uint64(offsetCMap)+uint64(length) > uint64(len(rawTable)) {
+				return fmt.Errorf("cmap: invalid format 14 subtable")
 			}
+			tt.cmapVariations = rawTable[offsetCMap : offsetCMap+length]
 		default:
 			return fmt.Errorf("format %d not supported in cmap", format)
 		}
@@ -798,6 +1014,185 @@ func (tt *Font) readCmap(tbl tableOffsetLength) error {
 	return nil
 }
 
+// cmapMapping is a character to glyph id mapping for the cmap table.
+type cmapMapping struct {
+	r   rune
+	gid int
+}
+
+// cmapMappings returns the characters of the font sorted by code point. If
+// the font is a subset, only the characters of glyphs in the subset are
+// returned.
+func (tt *Font) cmapMappings() []cmapMapping {
+	var inSubset map[int]bool
+	if tt.subsetCodepoints != nil {
+		inSubset = make(map[int]bool, len(tt.subsetCodepoints))
+		for _, cp := range tt.subsetCodepoints {
+			inSubset[cp] = true
+		}
+	}
+	mappings := make([]cmapMapping, 0, len(tt.ToCodepoint))
+	for r, gid := range tt.ToCodepoint {
+		if gid <= 0 || gid >= int(tt.Maxp.NumGlyphs) || r < 0 || r > unicode.MaxRune {
+			continue
+		}
+		if inSubset != nil && !inSubset[gid] {
+			continue
+		}
+		mappings = append(mappings, cmapMapping{r: r, gid: gid})
+	}
+	sort.Slice(mappings, func(i, j int) bool { return mappings[i].r < mappings[j].r })
+	return mappings
+}
+
+// writeCmap writes a cmap table with a format 4 subtable for the characters
+// in the Basic Multilingual Plane and a format 12 subtable if the font has
+// characters outside of the BMP. The format 14 subtable of the font is kept
+// unless the font is subsetted.
+func (tt *Font) writeCmap(w io.Writer) error {
+	mappings := tt.cmapMappings()
+
+	// format 4: one segment for each run of consecutive characters. The
+	// segment uses idDelta if the glyph ids are consecutive as well and the
+	// glyph id array otherwise.
+	type segment struct {
+		start, end int // index in mappings
+	}
+	var segments []segment
+	bmp := 0
+	for bmp < len(mappings) && mappings[bmp].r < 0xffff {
+		bmp++
+	}
+	for i := 0; i < bmp; {
+		j := i + 1
+		for j < bmp && mappings[j].r == mappings[j-1].r+1 {
+			j++
+		}
+		segments = append(segments, segment{i, j})
+		i = j
+	}
+	segCount := len(segments) + 1
+	endCode := make([]uint16, 0, segCount)
+	startCode := make([]uint16, 0, segCount)
+	idDelta := make([]int16, 0, segCount)
+	idRangeOffsets := make([]uint16, 0, segCount)
+	var glyphIDArray []uint16
+	for i, seg := range segments {
+		first := mappings[seg.start]
+		startCode = append(startCode, uint16(first.r))
+		endCode = append(endCode, uint16(mappings[seg.end-1].r))
+		consecutive := true
+		for _, m := range mappings[seg.start+1 : seg.end] {
+			if m.gid-int(m.r) != first.gid-int(first.r) {
+				consecutive = false
+				break
+			}
+		}
+		if consecutive {
+			idDelta = append(idDelta, int16(first.gid-int(first.r)))
+			idRangeOffsets = append(idRangeOffsets, 0)
+			continue
+		}
+		idDelta = append(idDelta, 0)
+		// offset from this entry of idRangeOffsets to the glyph ids
+		idRangeOffsets = append(idRangeOffsets, uint16(2*(segCount-i+len(glyphIDArray))))
+		for _, m := range mappings[seg.start:seg.end] {
+			glyphIDArray = append(glyphIDArray, uint16(m.gid))
+		}
+	}
+	// the last segment maps 0xFFFF to .notdef
+	startCode = append(startCode, 0xffff)
+	endCode = append(endCode, 0xffff)
+	idDelta = append(idDelta, 1)
+	idRangeOffsets = append(idRangeOffsets, 0)
+
+	format4Len := 16 + 8*segCount + 2*len(glyphIDArray)
+	if format4Len > 0xffff {
+		return fmt.Errorf("cmap: too many characters for a format 4 subtable")
+	}
+
+	// format 12: one group for each run of consecutive characters and glyph
+	// ids
+	var groups [][3]uint32
+	if bmp < len(mappings) {
+		for i := 0; i < len(mappings); {
+			j := i + 1
+			for j < len(mappings) && mappings[j].r == mappings[j-1].r+1 && mappings[j].gid == mappings[j-1].gid+1 {
+				j++
+			}
+			groups = append(groups, [3]uint32{uint32(mappings[i].r), uint32(mappings[j-1].r), uint32(mappings[i].gid)})
+			i = j
+		}
+	}
+
+	format12Len := 0
+	if groups != nil {
+		format12Len = 16 + 12*len(groups)
+	}
+	// the variation sequences refer to glyph ids of the original font
+	variations := tt.cmapVariations
+	if tt.subsetCodepoints != nil {
+		variations = nil
+	}
+
+	type encodingRecord struct {
+		platformID, encodingID uint16
+		format                 int
+	}
+	records := []encodingRecord{{0, 3, 4}}
+	if groups != nil {
+		records = append(records, encodingRecord{0, 4, 12})
+	}
+	if variations != nil {
+		records = append(records, encodingRecord{0, 5, 14})
+	}
+	records = append(records, encodingRecord{3, 1, 4})
+	if groups != nil {
+		records = append(records, encodingRecord{3, 10, 12})
+	}
+	subtableOffsets := make(map[int]uint32)
+	subtableOffsets[4] = uint32(4 + 8*len(records))
+	subtableOffsets[12] = subtableOffsets[4] + uint32(format4Len)
+	subtableOffsets[14] = subtableOffsets[12] + uint32(format12Len)
+	tt.write(w, uint16(0))
+	tt.write(w, uint16(len(records)))
+	for _, rec := range records {
+		tt.write(w, rec.platformID)
+		tt.write(w, rec.encodingID)
+		tt.write(w, subtableOffsets[rec.format])
+	}
+
+	entrySelector := 0
+	for 2<<entrySelector <= segCount {
+		entrySelector++
+	}
+	searchRange := 2 << entrySelector
+	tt.write(w, uint16(4))
+	tt.write(w, uint16(format4Len))
+	tt.write(w, uint16(0)) // language
+	tt.write(w, uint16(2*segCount))
+	tt.write(w, uint16(searchRange))
+	tt.write(w, uint16(entrySelector))
+	tt.write(w, uint16(2*segCount-searchRange))
+	tt.write(w, endCode)
+	tt.write(w, uint16(0)) // reservedPad
+	tt.write(w, startCode)
+	tt.write(w, idDelta)
+	tt.write(w, idRangeOffsets)
+	tt.write(w, glyphIDArray)
+
+	if groups != nil {
+		tt.write(w, uint16(12))
+		tt.write(w, uint16(0))
+		tt.write(w, uint32(format12Len))
+		tt.write(w, uint32(0)) // language
+		tt.write(w, uint32(len(groups)))
+		tt.write(w, groups)
+	}
+	tt.write(w, variations)
+	return nil
+}
+
 func (tt *Font) readPost(tbl tableOffsetLength) error {
 
 	post := Post{}
@@ -835,13 +1230,11 @@ func (tt *Font) readPost(tbl tableOffsetLength) error {
 				tt.GlyphNames = append(tt.GlyphNames, fontGylphNames[idx-258])
 			}
 		}
-	case 0x25000:
-		panic("not implemented yet (POST version 2.5)")
+	case 0x25000, 0x40000:
+		// version 2.5 (deprecated) and version 4 (AAT) are kept unchanged
+		tt.postData = tt.readToTableEnd("post")
 	case 0x30000:
 		// no more fields
-	case 0x40000:
-		// AAT
-		panic("not implemented yet (POST version 4)")
 	}
 
 	tt.Post = post
@@ -860,23 +1253,40 @@ func (tt *Font) writePost(w io.Writer) error {
 	tt.write(w, tbl.MaxMemType42)
 	tt.write(w, tbl.MinMemType1)
 	tt.write(w, tbl.MaxMemType1)
-	tt.write(w, tt.Maxp.NumGlyphs)
 
-	fontGlyphNames := make([]string, 0, tt.Maxp.NumGlyphs)
-	glyphIndex := make([]uint16, tt.Maxp.NumGlyphs)
-
-	for i, n := range tt.GlyphNames {
-		if idx, ok := macGlyphNameIndex[n]; ok {
+	switch tbl.Version {
+	case 0x20000:
+		numGlyphs := int(tt.Maxp.NumGlyphs)
+		tt.write(w, uint16(numGlyphs))
+
+		// glyphs without a name get .notdef (index 0)
+		glyphIndex := make([]uint16, numGlyphs)
+		fontGlyphNames := []string{}
+		fontGlyphNameIndex := make(map[string]uint16)
+		for i := 0; i < numGlyphs && i < len(tt.GlyphNames); i++ {
+			n := tt.GlyphNames[i]
+			if idx, ok := macGlyphNameIndex[n]; ok {
+				glyphIndex[i] = idx
+				continue
+			}
+			idx, ok := fontGlyphNameIndex[n]
+			if !ok {
+				if len(n) > 255 {
+					return fmt.Errorf("post table: glyph name %q too long", n)
+				}
+				idx = uint16(258 + len(fontGlyphNames))
+				fontGlyphNames = append(fontGlyphNames, n)
+				fontGlyphNameIndex[n] = idx
+			}
 			glyphIndex[i] = idx
-		} else {
-			fontGlyphNames = append(fontGlyphNames, n)
-			glyphIndex[i] = uint16(len(fontGlyphNames)) + 258
 		}
-	}
-	tt.write(w, glyphIndex)
-	for _, n := range fontGlyphNames {
-		tt.write(w, byte(len(n)))
-		tt.write(w, []byte(n))
+		tt.write(w, glyphIndex)
+		for _, n := range fontGlyphNames {
+			tt.write(w, byte(len(n)))
+			tt.write(w, []byte(n))
+		}
+	case 0x25000, 0x40000:
+		tt.write(w, tt.postData)
 	}
 	return nil
 }
@@ -900,12 +1310,49 @@ func Open(r io.ReadSeeker, fontindex int) (*Font, error) {
 	tt.names = make(map[int]string)
 	// to mark that the Head table is not read yet
 	tt.Head.IndexToLocFormat = -1
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
 	tt.read(&tt.sfntVersion)
 
+	if tt.sfntVersion == magicWOFF || tt.sfntVersion == magicWOFF2 {
+		// The tables are decompressed into memory and the font is read as
+		// an ordinary sfnt file from now on.
+		var sfnt []byte
+		var err error
+		if tt.sfntVersion == magicWOFF {
+			sfnt, err = decodeWOFF(r)
+		} else {
+			sfnt, err = decodeWOFF2(r)
+		}
+		if err != nil {
+			return nil, err
+		}
+		r = bytes.NewReader(sfnt)
+		tt.r = r
+		tt.read(&tt.sfntVersion)
+	}
+
+	if tt.sfntVersion == magicCollection {
+		offsets, err := readCollectionOffsets(r)
+		if err != nil {
+			return nil, err
+		}
+		if fontindex < 0 || fontindex >= len(offsets) {
+			return nil, fmt.Errorf("font index %d out of range, the collection has %d faces", fontindex, len(offsets))
+		}
+		tt.IsCollection = true
+		tt.faceOffset = int64(offsets[fontindex])
+		if _, err = r.Seek(tt.faceOffset, io.SeekStart); err != nil {
+			return nil, err
+		}
+		tt.read(&tt.sfntVersion)
+	}
+
 	switch tt.sfntVersion {
-	case 65536:
+	case magicTrueType:
 		// OK
-	case 0x4F54544F:
+	case magicOpenType:
 		tt.IsCFF = true
 		tt.UnitsPerEM = 1000
 		// OpenType CFF
@@ -918,7 +1365,7 @@ func Open(r io.ReadSeeker, fontindex int) (*Font, error) {
 
 	for i := uint16(0); i < numtables; i++ {
 		ol := tableOffsetLength{}
-		pos := int64(16*i + 12)
+		pos := tt.faceOffset + int64(16*i+12)
 		r.Seek(pos, io.SeekStart)
 		tbl := make([]byte, 4)
 		n, err := r.Read(tbl)
@@ -940,7 +1387,9 @@ func Open(r io.ReadSeeker, fontindex int) (*Font, error) {
 	return tt, nil
 }
 
-// ReadTables reads all tables from the font file
+// ReadTables reads all tables from the font file. Errors in the optional
+// vertical metrics tables (vhea, vmtx and VORG) and layout tables (GDEF, GSUB,
+// GPOS and kern) are stored in TableErrors and the table is left out.
 func (tt *Font) ReadTables() error {
 	var interestingTables []string
 	var err error
@@ -955,11 +1404,67 @@ func (tt *Font) ReadTables() error {
 			return err
 		}
 	}
+	for _, tblname := range verticalTables {
+		if _, ok := tt.tables[tblname]; !ok {
+			continue
+		}
+		if err = tt.readTable(tblname); err == nil {
+			continue
+		}
+		tt.addTableError(tblname, err)
+		// the vertical metrics are calculated from the hhea table instead
+		switch tblname {
+		case "vhea", "vmtx":
+			tt.advanceHeight = nil
+			tt.tsb = nil
+		case "VORG":
+			tt.vorg = nil
+		}
+	}
+	for _, tblname := range layoutTables {
+		if _, ok := tt.tables[tblname]; !ok {
+			continue
+		}
+		if err = tt.readTable(tblname); err == nil {
+			continue
+		}
+		tt.addTableError(tblname, err)
+		switch tblname {
+		case "GDEF":
+			tt.GDEF = nil
+		case "GSUB":
+			tt.GSUB = nil
+		case "GPOS":
+			tt.GPOS = nil
+		case "kern":
+			tt.kern = nil
+		}
+	}
 	return nil
 }
 
+// addTableError stores the error of an optional table in TableErrors.
+func (tt *Font) addTableError(tblname string, err error) {
+	if tt.TableErrors == nil {
+		tt.TableErrors = make(map[string]error)
+	}
+	tt.TableErrors[tblname] = err
+}
+
+// omitFromSubset reports whether a table is left out of subset fonts because
+// it could not be read. The vhea table is useless without the vmtx table.
+func (tt *Font) omitFromSubset(tblname string) bool {
+	if tblname == "vhea" {
+		tblname = "vmtx"
+	}
+	return tt.TableErrors[tblname] != nil
+}
+
 // WriteSubset writes a valid font to w that is suitable for including in PDF
 func (tt *Font) WriteSubset(w io.Writer) error {
+	if err := tt.checkEmbedding("embed"); err != nil {
+		return err
+	}
 	if tt.IsCFF {
 		return tt.WriteTable(w, "CFF ")
 	}
@@ -968,12 +1473,12 @@ func (tt *Font) WriteSubset(w io.Writer) error {
 	var fontfile bytes.Buffer
 	tt.Head.ChecksumAdjustment = 0
 
-	interestingTables := []string{"cvt ", "glyf", "head", "hhea", "hmtx", "loca", "maxp", "prep"}
+	interestingTables := []string{"cvt ", "glyf", "head", "hhea", "hmtx", "loca", "maxp", "prep", "vhea", "vmtx"}
 	tablesForPDF := []tableOffsetLength{}
 
 	// put only those tables in PDF which are present in the font file
 	for _, tblname := range interestingTables {
-		if tbl, ok := tt.tables[tblname]; ok {
+		if tbl, ok := tt.tables[tblname]; ok && !tt.omitFromSubset(tblname) {
 			tbl.name = tblname
 			tablesForPDF = append(tablesForPDF, tbl)
 		}
@@ -1045,29 +1550,327 @@ func (tt *Font) WriteSubset(w io.Writer) error {
 	checksumFontFile := calcChecksum(b)
 	if checksumAdjustmentOffset > 0 {
 		// only if we write the head table
-		binary.BigEndian.PutUint32(b[checksumAdjustmentOffset:], checksumFontFile-0xB1B0AFBA)
+		binary.BigEndian.PutUint32(b[checksumAdjustmentOffset:], 0xB1B0AFBA-checksumFontFile)
 	}
 	w.Write(b)
 
 	return nil
 }
+
+// subsetTables are the tables of a subset font file. All other tables refer
+// to glyph ids and are not valid for the subset.
+var subsetTables = map[string]bool{
+	"CFF ": true, "OS/2": true, "cmap": true, "cvt ": true, "fpgm": true, "gasp": true,
+	"glyf": true, "head": true, "hhea": true, "hmtx": true, "loca": true, "maxp": true,
+	"name": true, "post": true, "prep": true, "vhea": true, "vmtx": true, "VORG": true,
+}
+
+// writtenTables are the tables that are written from the font structures
+// when they have been read.
+var writtenTables = map[string]bool{
+	"CFF ": true, "OS/2": true, "cvt ": true, "fpgm": true, "glyf": true,
+	"head": true, "hhea": true, "hmtx": true, "loca": true, "maxp": true,
+	"name": true, "post": true, "prep": true, "vhea": true, "vmtx": true, "VORG": true,
+}
+
+// fontData returns a complete font file. The tables that have been read are
+// written from the font structures, the other tables are copied from the
+// original font. If the font has been subsetted, the tables that can't be
+// adjusted to the subset are left out.
+func (tt *Font) fontData() ([]byte, error) {
+	names := make([]string, 0, len(tt.tables))
+	for name := range tt.tables {
+		if name == "DSIG" {
+			// the signature is invalid for the changed font
+			continue
+		}
+		if tt.subsetCodepoints != nil && (!subsetTables[name] || tt.omitFromSubset(name)) {
+			continue
+		}
+		names = append(names, name)
+	}
+	if _, ok := tt.tables["name"]; !ok && len(tt.nameRecords) > 0 {
+		// added with SetName
+		names = append(names, "name")
+	}
+	// glyf before loca, since writing the glyf table calculates the offsets
+	sort.Strings(names)
+
+	tables := make([]tableOffsetLength, 0, len(names))
+	for _, name := range names {
+		var data []byte
+		var err error
+		switch {
+		case name == "cmap" && tt.ToCodepoint != nil && tt.subsetCodepoints != nil:
+			// the cmap of an unchanged font is copied, so that subtables
+			// for other platforms and symbol fonts are kept
+			var buf bytes.Buffer
+			if err = tt.writeCmap(&buf); err != nil {
+				return nil, err
+			}
+			data = buf.Bytes()
+		case name == "post" && tt.subsetCodepoints != nil:
+			// version 3 has no glyph names
+			if data, err = tt.ReadTableData(name); err != nil {
+				return nil, err
+			}
+			if len(data) < 32 {
+				return nil, fmt.Errorf("post table too short")
+			}
+			data = append([]byte{}, data[:32]...)
+			binary.BigEndian.PutUint32(data, 0x30000)
+		case tt.tablesRead[name] && writtenTables[name] && tt.TableErrors[name] == nil:
+			var buf bytes.Buffer
+			if err = tt.WriteTable(&buf, name); err != nil {
+				return nil, err
+			}
+			data = buf.Bytes()
+		default:
+			if data, err = tt.ReadTableData(name); err != nil {
+				return nil, err
+			}
+		}
+		tables = append(tables, tableOffsetLength{
+			name:      name,
+			length:    uint32(len(data)),
+			checksum:  calcChecksum(data),
+			tabledata: data,
+		})
+	}
+	sfnt := buildSfnt(tt.sfntVersion, tables)
+	setChecksumAdjustment(sfnt)
+	return sfnt, nil
+}
+
+// Write writes the complete font to w. The tables that have been read (see
+// ReadTables) are written from the font structures, so changes to them are
+// included. All other tables are copied unchanged. If the font has been
+// subsetted, only the glyphs of the subset are included and the cmap table is
+// created from ToCodepoint.
+func (tt *Font) Write(w io.Writer) error {
+	if err := tt.checkEmbedding("embed"); err != nil {
+		return err
+	}
+	sfnt, err := tt.fontData()
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(sfnt)
+	return err
+}
+
 func (tt *Font) subsetCFF(codepoints []int) error {
+	if err := tt.CFF.Subset(codepoints); err != nil {
+		return err
+	}
 	tt.SubsetID = getCharTag(codepoints)
 	tt.subsetCodepoints = codepoints
-	tt.CFF.Subset(codepoints)
+	// the glyphs after the last glyph of the subset are removed from the CFF
+	numGlyphs := len(tt.CFF.Font[tt.CFF.Fontindex].CharStrings)
+	if len(tt.advanceWidth) >= numGlyphs {
+		inSubset := make(map[int]bool, len(codepoints))
+		for _, cp := range codepoints {
+			inSubset[cp] = true
+		}
+		for i := 0; i < numGlyphs; i++ {
+			if !inSubset[i] {
+				tt.advanceWidth[i] = 0
+				tt.lsb[i] = 0
+			}
+		}
+		tt.advanceWidth = tt.advanceWidth[:numGlyphs]
+		tt.lsb = tt.lsb[:numGlyphs]
+		tt.Hhea.NumberOfHMetrics = uint16(numGlyphs)
+	}
+	oldIDs := make([]int, numGlyphs)
+	for i := range oldIDs {
+		oldIDs[i] = -1
+	}
+	for _, cp := range codepoints {
+		if cp >= 0 && cp < numGlyphs {
+			oldIDs[cp] = cp
+		}
+	}
+	tt.remapVerticalMetrics(oldIDs)
+	tt.Maxp.NumGlyphs = uint16(numGlyphs)
 	return nil
 }
 
 // GlyphAdvance returns the width of the glyph
 func (tt *Font) GlyphAdvance(idx int) (int, error) {
+	if idx < 0 || idx >= len(tt.advanceWidth) {
+		return 0, fmt.Errorf("glyph %d does not exist", idx)
+	}
 	return int(tt.advanceWidth[idx]), nil
 }
 
+// GlyphPath returns the outline of the glyph in font units. TrueType glyphs
+// have quadratic and CFF glyphs cubic curves.
+func (tt *Font) GlyphPath(gid int) (Path, error) {
+	if tt.IsCFF {
+		if tt.CFF == nil {
+			return nil, fmt.Errorf("CFF table not read")
+		}
+		path, _, err := tt.CFF.Font[tt.CFF.Fontindex].GlyphOutline(gid)
+		return path, err
+	}
+	if tt.Glyph == nil {
+		return nil, fmt.Errorf("glyf table not read")
+	}
+	return tt.glyfOutline(gid)
+}
+
+// GlyphBounds returns the exact bounding box of the glyph outline in font
+// units. Glyphs without an outline have an empty bounding box.
+func (tt *Font) GlyphBounds(gid int) (Rect, error) {
+	path, err := tt.GlyphPath(gid)
+	if err != nil {
+		return Rect{}, err
+	}
+	return path.Bounds(), nil
+}
+
+// ScaledGlyphPath returns the outline of the glyph for the given font size.
+func (tt *Font) ScaledGlyphPath(gid int, size float64) (Path, error) {
+	path, err := tt.GlyphPath(gid)
+	if err != nil {
+		return nil, err
+	}
+	return path.Scale(size / float64(tt.UnitsPerEM)), nil
+}
+
 // GetIndex returns the internal code point for this rune
 func (tt *Font) GetIndex(r rune) (int, error) {
 	return tt.ToCodepoint[r], nil
 }
 
+// remapComponents returns a copy of the glyph where the glyph ids of the
+// components of a composite glyph are replaced by the ids in mapping.
+// Simple glyphs are returned unchanged.
+func remapComponents(g Glyph, mapping map[int]int) (Glyph, error) {
+	if len(g) < 10 || int16(binary.BigEndian.Uint16(g)) >= 0 {
+		return g, nil
+	}
+	ret := make(Glyph, len(g))
+	copy(ret, g)
+	pos := 10
+	for {
+		if pos+4 > len(ret) {
+			return nil, fmt.Errorf("composite glyph too short")
+		}
+		flags := binary.BigEndian.Uint16(ret[pos:])
+		componentIndex := int(binary.BigEndian.Uint16(ret[pos+2:]))
+		newIndex, ok := mapping[componentIndex]
+		if !ok {
+			return nil, fmt.Errorf("component glyph %d not in subset", componentIndex)
+		}
+		binary.BigEndian.PutUint16(ret[pos+2:], uint16(newIndex))
+		if flags&flagMoreComponents == 0 {
+			break
+		}
+		pos += 4
+		if flags&flagArg1And2AreWords != 0 {
+			pos += 4
+		} else {
+			pos += 2
+		}
+		switch {
+		case flags&flagWeHaveAScale != 0:
+			pos += 2
+		case flags&flagWeHaveAnXAndYScale != 0:
+			pos += 4
+		case flags&flagWeHaveATwoByTwo != 0:
+			pos += 8
+		}
+	}
+	return ret, nil
+}
+
+// SubsetCompact removes all glyphs from a TrueType font except the given
+// glyphs, the glyphs used as components and the .notdef glyph. Unlike Subset
+// the glyphs are renumbered without gaps. The returned map has the new glyph
+// id for each old glyph id that is kept. Afterwards ToCodepoint, ToUni and
+// GlyphNames refer to the new glyph ids.
+func (tt *Font) SubsetCompact(codepoints []int) (map[int]int, error) {
+	if tt.IsCFF {
+		return nil, fmt.Errorf("SubsetCompact is only supported for TrueType fonts")
+	}
+	if err := tt.checkEmbedding("subset"); err != nil {
+		return nil, err
+	}
+	tt.SubsetID = getCharTag(codepoints)
+
+	keep := map[int]bool{0: true}
+	for _, cp := range codepoints {
+		if cp < 0 || cp >= len(tt.Glyph) {
+			return nil, fmt.Errorf("glyph %d not in font", cp)
+		}
+		keep[cp] = true
+		for _, c := range tt.getGlyphComponentIds(cp) {
+			keep[c] = true
+		}
+	}
+	oldIDs := make([]int, 0, len(keep))
+	for gid := range keep {
+		oldIDs = append(oldIDs, gid)
+	}
+	sort.Ints(oldIDs)
+	mapping := make(map[int]int, len(oldIDs))
+	for newID, oldID := range oldIDs {
+		mapping[oldID] = newID
+	}
+
+	glyphs := make([]Glyph, len(oldIDs))
+	advanceWidth := make([]uint16, len(oldIDs))
+	lsb := make([]int16, len(oldIDs))
+	var glyphNames []string
+	if len(tt.GlyphNames) > 0 {
+		glyphNames = make([]string, len(oldIDs))
+	}
+	subsetCodepoints := make([]int, len(oldIDs))
+	for newID, oldID := range oldIDs {
+		g, err := remapComponents(tt.Glyph[oldID], mapping)
+		if err != nil {
+			return nil, fmt.Errorf("glyph %d: %s", oldID, err)
+		}
+		glyphs[newID] = g
+		if oldID < len(tt.advanceWidth) {
+			advanceWidth[newID] = tt.advanceWidth[oldID]
+			lsb[newID] = tt.lsb[oldID]
+		}
+		if glyphNames != nil && oldID < len(tt.GlyphNames) {
+			glyphNames[newID] = tt.GlyphNames[oldID]
+		}
+		subsetCodepoints[newID] = newID
+	}
+
+	toUni := make(map[int]rune, len(oldIDs))
+	toCodepoint := make(map[rune]int, len(oldIDs))
+	for r, gid := range tt.ToCodepoint {
+		if newID, ok := mapping[gid]; ok && gid != 0 {
+			toCodepoint[r] = newID
+		}
+	}
+	for gid, r := range tt.ToUni {
+		if newID, ok := mapping[gid]; ok && gid != 0 {
+			toUni[newID] = r
+		}
+	}
+
+	tt.Glyph = glyphs
+	tt.advanceWidth = advanceWidth
+	tt.lsb = lsb
+	tt.GlyphNames = glyphNames
+	tt.ToUni = toUni
+	tt.ToCodepoint = toCodepoint
+	tt.Maxp.NumGlyphs = uint16(len(glyphs))
+	tt.Head.IndexToLocFormat = 1
+	tt.Hhea.NumberOfHMetrics = uint16(len(glyphs))
+	tt.remapVerticalMetrics(oldIDs)
+	tt.subsetCodepoints = subsetCodepoints
+	return mapping, nil
+}
+
 // subsetTrueType removes all data from the font file that is not necessary to render the given copde points.
 func (tt *Font) subsetTrueType(codepoints []int) error {
 	// the SubsetID is a random six letter string
@@ -1103,12 +1906,15 @@ func (tt *Font) subsetTrueType(codepoints []int) error {
 	// the codepoints not used in the subset (or used from one of these glyphs) are
 	// replaced by an empty glyph.
 	glyphs := make([]Glyph, maxCP)
+	oldIDs := make([]int, maxCP)
 	emptyGlyph := Glyph{}
 	for i, c := 0, 0; i < maxCP; i++ {
 		if i == codepoints[c] {
 			glyphs[i] = tt.Glyph[i]
+			oldIDs[i] = i
 			c++
 		} else {
+			oldIDs[i] = -1
 			tt.advanceWidth[i] = 0
 			tt.lsb[i] = 0
 			glyphs[i] = emptyGlyph
@@ -1120,6 +1926,7 @@ func (tt *Font) subsetTrueType(codepoints []int) error {
 	tt.Maxp.NumGlyphs = uint16(maxCP)
 	tt.Head.IndexToLocFormat = 1
 	tt.Hhea.NumberOfHMetrics = uint16(maxCP)
+	tt.remapVerticalMetrics(oldIDs)
 	tt.subsetCodepoints = codepoints
 	return nil
 
@@ -1127,12 +1934,27 @@ func (tt *Font) subsetTrueType(codepoints []int) error {
 
 // Subset removes all data from the font except the one needed for the given code points.
 func (tt *Font) Subset(codepoints []int) error {
+	if err := tt.checkEmbedding("subset"); err != nil {
+		return err
+	}
 	if tt.IsCFF {
 		return tt.subsetCFF(codepoints)
 	}
 	return tt.subsetTrueType(codepoints)
 }
 
+// Desubroutinize inlines all subroutines of a CFF based font into the
+// charstrings and removes the subroutines. The CFF table must have been read.
+func (tt *Font) Desubroutinize() error {
+	if !tt.IsCFF {
+		return fmt.Errorf("Desubroutinize is only supported for CFF fonts")
+	}
+	if tt.CFF == nil {
+		return fmt.Errorf("CFF table not read")
+	}
+	return tt.CFF.Font[tt.CFF.Fontindex].Desubroutinize()
+}
+
 // Codepoints returns the codepoints for each rune
 func (tt *Font) Codepoints(runes []rune) []int {
 	ret := make([]int, 0, len(runes))
@@ -1142,15 +1964,131 @@ func (tt *Font) Codepoints(runes []rune) []int {
 	return ret
 }
 
-// CMap returns a CMap string to be used in a PDF file
+// maxCMapBlockSize is the maximum number of entries in a bfchar or bfrange
+// block of a CMap.
+const maxCMapBlockSize = 100
+
+// GlyphCID returns the CID of the glyph in a PDF CIDFont. This is the glyph
+// id, for CID-keyed CFF fonts it is the CID from the charset.
+func (tt *Font) GlyphCID(gid int) int {
+	if tt.IsCFF && tt.CFF != nil {
+		return tt.CFF.Font[tt.CFF.Fontindex].CID(gid)
+	}
+	return gid
+}
+
+// CIDSystemInfo returns the registry, the ordering and the supplement for the
+// CIDSystemInfo dictionary of a PDF CIDFont. CID-keyed CFF fonts return
+// their ROS, all other fonts Adobe-Identity-0.
+func (tt *Font) CIDSystemInfo() (registry, ordering string, supplement int) {
+	if tt.IsCFF && tt.CFF != nil {
+		if registry, ordering, supplement, ok := tt.CFF.Font[tt.CFF.Fontindex].ROS(); ok {
+			return registry, ordering, supplement
+		}
+	}
+	return "Adobe", "Identity", 0
+}
+
+// subsetCIDs returns the glyph ids of the subset by CID. Without cidToGID the
+// CIDs are from GlyphCID, otherwise the CIDs of cidToGID that map to glyphs
+// of the subset are returned.
+func (tt *Font) subsetCIDs(cidToGID map[int]int) map[int]int {
+	cids := make(map[int]int, len(tt.subsetCodepoints))
+	if cidToGID == nil {
+		for _, gid := range tt.subsetCodepoints {
+			cids[tt.GlyphCID(gid)] = gid
+		}
+		return cids
+	}
+	inSubset := make(map[int]bool, len(tt.subsetCodepoints))
+	for _, gid := range tt.subsetCodepoints {
+		inSubset[gid] = true
+	}
+	for cid, gid := range cidToGID {
+		if inSubset[gid] {
+			cids[cid] = gid
+		}
+	}
+	return cids
+}
+
+// CMap returns a ToUnicode CMap string to be used in a PDF file. The glyphs
+// of the subset are mapped to their Unicode values.
 func (tt *Font) CMap() string {
-	var numGlyphs int
+	return tt.ToUnicodeCMap(nil)
+}
 
-	if tt.IsCFF {
-		numGlyphs = len(tt.CFF.Font[0].CharStrings)
-	} else {
-		numGlyphs = int(tt.Maxp.NumGlyphs)
+// ToUnicodeCMap returns a ToUnicode CMap string to be used in a PDF file. The
+// character codes are the CIDs of the glyphs (Identity-H encoding, see
+// GlyphCID). text has the text for CIDs that do not map to a single Unicode
+// value, for example ligatures like "ffi" or glyphs from shaping. It takes
+// precedence over the Unicode values of the font.
+func (tt *Font) ToUnicodeCMap(text map[int]string) string {
+	return tt.CIDToUnicodeCMap(text, nil)
+}
+
+// CIDToUnicodeCMap is like ToUnicodeCMap for a CIDFont with a CIDToGIDMap.
+// cidToGID maps the character codes to glyph ids of the subset.
+func (tt *Font) CIDToUnicodeCMap(text map[int]string, cidToGID map[int]int) string {
+	type cmapEntry struct {
+		cid   int
+		units []uint16
+	}
+	cids := tt.subsetCIDs(cidToGID)
+	for cid := range text {
+		if _, ok := cids[cid]; !ok {
+			cids[cid] = -1
+		}
 	}
+	var entries []cmapEntry
+	for cid, gid := range cids {
+		str, ok := text[cid]
+		if !ok {
+			r, ok := tt.ToUni[gid]
+			if !ok || r == 0 {
+				continue
+			}
+			str = string(r)
+		}
+		if str == "" || cid < 0 || cid > 0xffff {
+			continue
+		}
+		entries = append(entries, cmapEntry{cid: cid, units: utf16.Encode([]rune(str))})
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].cid < entries[j].cid })
+
+	// Consecutive glyphs with consecutive single code units become a range.
+	// The code units of a range may only differ in the last byte.
+	var chars, ranges []string
+	hex := func(units []uint16) string {
+		var b strings.Builder
+		for _, u := range units {
+			fmt.Fprintf(&b, "%04X", u)
+		}
+		return b.String()
+	}
+	for i := 0; i < len(entries); {
+		first := entries[i]
+		j := i + 1
+		if len(first.units) == 1 {
+			for j < len(entries) {
+				next := entries[j]
+				n := j - i
+				if next.cid != first.cid+n || len(next.units) != 1 || int(next.units[0]) != int(first.units[0])+n ||
+					next.cid>>8 != first.cid>>8 || next.units[0]>>8 != first.units[0]>>8 {
+					break
+				}
+				j++
+			}
+		}
+		if j-i > 1 {
+			ranges = append(ranges, fmt.Sprintf("<%04X><%04X><%s>", first.cid, entries[j-1].cid, hex(first.units)))
+		} else {
+			chars = append(chars, fmt.Sprintf("<%04X><%s>", first.cid, hex(first.units)))
+		}
+		i = j
+	}
+
 	var b strings.Builder
 	b.WriteString(`/CIDInit /ProcSet findresource begin
 12 dict begin
@@ -1158,27 +2096,114 @@ begincmap
 /CIDSystemInfo << /Registry (Adobe)/Ordering (UCS)/Supplement 0>> def
 /CMapName /Adobe-Identity-UCS def /CMapType 2 def
 1 begincodespacerange
+<0000><FFFF>
+endcodespacerange
 `)
-	fmt.Fprintf(&b, "<0001><%04X>\n", numGlyphs)
-	b.WriteString("endcodespacerange\n")
-	fmt.Fprintf(&b, "%d beginbfchar\n", len(tt.subsetCodepoints))
-	for _, cp := range tt.subsetCodepoints {
-		fmt.Fprintf(&b, "<%04X><%04X>\n", cp, tt.ToUni[cp])
-	}
-	b.WriteString(`endbfchar
-endcmap CMapName currentdict /CMap defineresource pop end end`)
+	writeBlocks := func(lines []string, name string) {
+		for len(lines) > 0 {
+			n := len(lines)
+			if n > maxCMapBlockSize {
+				n = maxCMapBlockSize
+			}
+			fmt.Fprintf(&b, "%d begin%s\n", n, name)
+			for _, line := range lines[:n] {
+				b.WriteString(line)
+				b.WriteString("\n")
+			}
+			fmt.Fprintf(&b, "end%s\n", name)
+			lines = lines[n:]
+		}
+	}
+	writeBlocks(chars, "bfchar")
+	writeBlocks(ranges, "bfrange")
+	b.WriteString(`endcmap CMapName currentdict /CMap defineresource pop end end`)
 	return b.String()
 }
 
-// Widths returns a widths string to be used in a PDF file
+// Widths returns the /W array of a CIDFont in a PDF file for the glyphs of the
+// subset. Glyphs with the default width 1000 are omitted.
 func (tt *Font) Widths() string {
-	var b strings.Builder
-	b.WriteString("[")
-	for _, cp := range tt.subsetCodepoints {
-		fmt.Fprintf(&b, "%d[%.1f]", cp, float64(tt.advanceWidth[cp])/float64(tt.UnitsPerEM)*1000)
+	return tt.WidthsWithDefault(1000)
+}
+
+// WidthsWithDefault returns the /W array of a CIDFont in a PDF file for the
+// glyphs of the subset. Glyphs with the width dw (the /DW entry of the
+// CIDFont) are omitted. The array is keyed by the CIDs of the glyphs (see
+// GlyphCID).
+func (tt *Font) WidthsWithDefault(dw float64) string {
+	return tt.CIDWidths(dw, nil)
+}
+
+// CIDWidths is like WidthsWithDefault for a CIDFont with a CIDToGIDMap.
+// cidToGID maps the CIDs to glyph ids of the subset.
+func (tt *Font) CIDWidths(dw float64, cidToGID map[int]int) string {
+	defaultWidth := formatPDFWidth(dw)
+	subsetCIDs := tt.subsetCIDs(cidToGID)
+	cids := make([]int, 0, len(subsetCIDs))
+	widths := make(map[int]string, len(subsetCIDs))
+	for cid, gid := range subsetCIDs {
+		if cid < 0 || gid < 0 || gid >= len(tt.advanceWidth) {
+			continue
+		}
+		w := formatPDFWidth(float64(tt.advanceWidth[gid]) / float64(tt.UnitsPerEM) * 1000)
+		widths[cid] = w
+		if w != defaultWidth {
+			cids = append(cids, cid)
+		}
 	}
-	b.WriteString("]")
-	return b.String()
+	sort.Ints(cids)
+	return compactCIDArray(cids, widths)
+}
+
+// formatPDFWidth formats a width in PDF units with one decimal place, integer
+// values are written without decimal places. Widths are compared in this
+// format.
+func formatPDFWidth(w float64) string {
+	return strings.TrimSuffix(strconv.FormatFloat(w, 'f', 1, 64), ".0")
+}
+
+// compactCIDArray returns a /W or /W2 array for the sorted cids. values has
+// the metrics of each CID in PDF syntax. Consecutive CIDs are written as
+// c [v1 v2 ...] and runs of CIDs with the same metrics as cfirst clast v.
+func compactCIDArray(cids []int, values map[int]string) string {
+	// minRunLength is the minimum number of glyphs with the same metrics
+	// that are written as a range.
+	const minRunLength = 3
+	var entries []string
+	for i := 0; i < len(cids); {
+		// a block of consecutive glyphs
+		j := i + 1
+		for j < len(cids) && cids[j] == cids[j-1]+1 {
+			j++
+		}
+		var list []string
+		flushList := func(start int) {
+			if len(list) > 0 {
+				entries = append(entries, fmt.Sprintf("%d [%s]", cids[start], strings.Join(list, " ")))
+				list = list[:0]
+			}
+		}
+		listStart := i
+		for k := i; k < j; {
+			l := k + 1
+			for l < j && values[cids[l]] == values[cids[k]] {
+				l++
+			}
+			if l-k >= minRunLength {
+				flushList(listStart)
+				entries = append(entries, fmt.Sprintf("%d %d %s", cids[k], cids[l-1], values[cids[k]]))
+				listStart = l
+			} else {
+				for m := k; m < l; m++ {
+					list = append(list, values[cids[m]])
+				}
+			}
+			k = l
+		}
+		flushList(listStart)
+		i = j
+	}
+	return "[" + strings.Join(entries, " ") + "]"
 }
 
 // PDFName returns the font name with the subset id.
@@ -1206,23 +2231,151 @@ func (tt *Font) CapHeight() int {
 	return ch
 }
 
-// BoundingBox returns the /FontBBox value for the PDF file
+// Flags for the font descriptor in a PDF file.
+const (
+	pdfFlagFixedPitch  = 1 << 0
+	pdfFlagSerif       = 1 << 1
+	pdfFlagSymbolic    = 1 << 2
+	pdfFlagScript      = 1 << 3
+	pdfFlagNonsymbolic = 1 << 5
+	pdfFlagItalic      = 1 << 6
+	pdfFlagForceBold   = 1 << 18
+)
+
+// PANOSE values for Latin fonts
+const (
+	panoseFamilyLatinText        = 2
+	panoseFamilyLatinHandWritten = 3
+	panoseProportionMonospaced   = 9
+	panoseWeightBold             = 8
+)
+
+// toPDFUnits converts font units to the 1000 units per em of the PDF glyph
+// space.
+func (tt *Font) toPDFUnits(v float64) float64 {
+	if tt.UnitsPerEM == 0 {
+		return v
+	}
+	return v * 1000 / float64(tt.UnitsPerEM)
+}
+
+// FontBBox returns the font bounding box (xMin, yMin, xMax, yMax) in the
+// 1000 units per em of the PDF glyph space. The bounding box is taken from the
+// CFF font or the head table.
+func (tt *Font) FontBBox() [4]int {
+	bbox := [4]float64{float64(tt.Head.XMin), float64(tt.Head.YMin), float64(tt.Head.XMax), float64(tt.Head.YMax)}
+	if tt.IsCFF && tt.CFF != nil {
+		if cffBBox := tt.CFF.Font[tt.CFF.Fontindex].FontBBox(); cffBBox != [4]int{} {
+			for i, v := range cffBBox {
+				bbox[i] = float64(v)
+			}
+		}
+	}
+	return [4]int{
+		int(math.Floor(tt.toPDFUnits(bbox[0]))), int(math.Floor(tt.toPDFUnits(bbox[1]))),
+		int(math.Ceil(tt.toPDFUnits(bbox[2]))), int(math.Ceil(tt.toPDFUnits(bbox[3]))),
+	}
+}
+
+// BoundingBox returns the /FontBBox value for the PDF file.
 func (tt *Font) BoundingBox() string {
-	return fmt.Sprintf("[%d %d %d %d]", 0, tt.Hhea.Descender, 1000, tt.Hhea.Ascender)
+	bbox := tt.FontBBox()
+	return fmt.Sprintf("[%d %d %d %d]", bbox[0], bbox[1], bbox[2], bbox[3])
+}
+
+// isStandardLatin reports whether r is in the standard Latin character set
+// (the characters of WinAnsiEncoding).
+func isStandardLatin(r rune) bool {
+	if r >= 0x20 && r <= 0x7e || r >= 0xa0 && r <= 0xff {
+		return true
+	}
+	switch r {
+	case 'Œ', 'œ', 'Š', 'š', 'Ÿ', 'Ž', 'ž', 'ƒ', 'ˆ', '˜', '–', '—', '‘', '’',
+		'‚', '“', '”', '„', '†', '‡', '•', '…', '‰', '‹', '›', '€', '™':
+		return true
+	}
+	return false
 }
 
-// Flags returns the /Flags value for the PDF file
+// Flags returns the /Flags value for the PDF file. The flags are derived from
+// the post, OS/2 and head tables and the PANOSE classification. A font is
+// non-symbolic if all its characters (or all characters of the subset) are in
+// the standard Latin character set.
 func (tt *Font) Flags() int {
-	return 4
+	flags := 0
+	panose := tt.OS2.Panose
+	latinText := panose[0] == panoseFamilyLatinText
+	if tt.Post.IsFixedPitch != 0 || latinText && panose[3] == panoseProportionMonospaced {
+		flags |= pdfFlagFixedPitch
+	}
+	if latinText {
+		// serif styles 2 to 10, 11 and above are sans serif
+		if panose[1] >= 2 && panose[1] <= 10 {
+			flags |= pdfFlagSerif
+		}
+	} else if panose[0] == 0 {
+		// no PANOSE classification, try the IBM font class
+		switch tt.OS2.SFamilyClass >> 8 {
+		case 1, 2, 3, 4, 5, 7:
+			flags |= pdfFlagSerif
+		}
+	}
+	if panose[0] == panoseFamilyLatinHandWritten {
+		flags |= pdfFlagScript
+	}
+
+	symbolic := false
+	if len(tt.subsetCodepoints) > 0 {
+		for _, cp := range tt.subsetCodepoints {
+			if r, ok := tt.ToUni[cp]; ok && !isStandardLatin(r) {
+				symbolic = true
+				break
+			}
+		}
+	} else {
+		for _, r := range tt.ToUni {
+			if !isStandardLatin(r) {
+				symbolic = true
+				break
+			}
+		}
+	}
+	if symbolic {
+		flags |= pdfFlagSymbolic
+	} else {
+		flags |= pdfFlagNonsymbolic
+	}
+
+	if tt.Post.ItalicAngle != 0 || tt.OS2.FsSelection&1 != 0 || tt.Head.MacStyle&2 != 0 {
+		flags |= pdfFlagItalic
+	}
+	forceBold := tt.OS2.FsSelection&0x20 != 0 || tt.OS2.UsWeightClass >= 700 || latinText && panose[2] >= panoseWeightBold
+	if tt.IsCFF && tt.CFF != nil && tt.CFF.Font[tt.CFF.Fontindex].ForceBold() {
+		forceBold = true
+	}
+	if forceBold {
+		flags |= pdfFlagForceBold
+	}
+	return flags
 }
 
-// ItalicAngle returns the /ItalicAngle value for the PDF file
-func (tt *Font) ItalicAngle() int {
-	return int(tt.Post.ItalicAngle)
+// ItalicAngle returns the /ItalicAngle value for the PDF file in degrees
+// counter-clockwise from the vertical.
+func (tt *Font) ItalicAngle() float64 {
+	return float64(tt.Post.ItalicAngle) / 65536
 }
 
-// StemV returns the /StemV value for the PDF file
+// StemV returns the /StemV value for the PDF file. It is the StdVW entry of
+// CFF fonts or an estimate based on the weight class of the OS/2 table.
 func (tt *Font) StemV() int {
+	if tt.IsCFF && tt.CFF != nil {
+		if stdvw := tt.CFF.Font[tt.CFF.Fontindex].StdVW(); stdvw != 0 {
+			return int(math.Round(tt.toPDFUnits(stdvw)))
+		}
+	}
+	if weight := float64(tt.OS2.UsWeightClass); weight > 0 {
+		return int(math.Round(50 + weight*weight/(65*65)))
+	}
 	return 0
 }
 
@@ -1232,12 +2385,14 @@ func (tt *Font) XHeight() int {
 	return xh
 }
 
+// calcChecksum returns the sum of the big endian uint32 values in data. If the
+// length of data is not a multiple of four, it is padded with zeros.
 func calcChecksum(data []byte) uint32 {
 	sum := uint32(0)
-	c := 0
-	for c < len(data) {
-		sum += uint32(data[c])<<3 + uint32(data[c+1])<<2 + uint32(data[c+2])<<1 + uint32(data[c+3])
-		c += 4
+	for c := 0; c < len(data); c += 4 {
+		var word [4]byte
+		copy(word[:], data[c:])
+		sum += binary.BigEndian.Uint32(word[:])
 	}
 	return sum
 }
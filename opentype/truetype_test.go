@@ -2,9 +2,17 @@ package opentype
 
 import (
 	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"encoding/xml"
+	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
+
+	"github.com/speedata/gootf/cff"
 )
 
 func TestCreateLoca(t *testing.T) {
@@ -37,6 +45,24 @@ func TestCreateLoca(t *testing.T) {
 	}
 }
 
+func TestCalcChecksum(t *testing.T) {
+	testdata := []struct {
+		data []byte
+		want uint32
+	}{
+		{[]byte{0, 0, 0, 1, 0, 0, 1, 0}, 0x101},
+		{[]byte{0x12, 0x34, 0x56, 0x78}, 0x12345678},
+		// padded with zeros
+		{[]byte{1, 2, 3, 4, 5}, 0x06020304},
+		{[]byte{0xff, 0xff, 0xff, 0xff, 0, 0, 0, 2}, 1},
+	}
+	for _, td := range testdata {
+		if got := calcChecksum(td.data); got != td.want {
+			t.Errorf("calcChecksum(%v) = %#x, want %#x", td.data, got, td.want)
+		}
+	}
+}
+
 func TestCompareTables(t *testing.T) {
 	f, err := os.Open(filepath.Join("testdata", "CrimsonPro-Regular.ttf"))
 	if err != nil {
@@ -47,7 +73,7 @@ func TestCompareTables(t *testing.T) {
 		t.Fatal(err)
 	}
 
-	tables := []string{"hhea", "head", "maxp", "loca", "fpgm", "cvt ", "prep", "glyf"}
+	tables := []string{"hhea", "head", "maxp", "hmtx", "loca", "fpgm", "cvt ", "prep", "glyf"}
 	for _, tbl := range tables {
 		btbl, err := font.ReadTableData(tbl)
 		if err != nil {
@@ -124,16 +150,16 @@ func TestSubset(t *testing.T) {
 	if got, want := font.Descender(), -220; got != want {
 		t.Errorf("font.Descender() = %d, want %d", got, want)
 	}
-	if got, want := font.BoundingBox(), "[0 -220 1000 918]"; got != want {
+	if got, want := font.BoundingBox(), "[-105 -277 1132 961]"; got != want {
 		t.Errorf("font.BoundingBox() = %s, want %s", got, want)
 	}
-	if got, want := font.Flags(), 4; got != want {
+	if got, want := font.Flags(), 32; got != want {
 		t.Errorf("font.Flags() = %d, want %d", got, want)
 	}
-	if got, want := font.ItalicAngle(), 0; got != want {
-		t.Errorf("font.ItalicAngle() = %d, want %d", got, want)
+	if got, want := font.ItalicAngle(), 0.0; got != want {
+		t.Errorf("font.ItalicAngle() = %v, want %v", got, want)
 	}
-	if got, want := font.StemV(), 0; got != want {
+	if got, want := font.StemV(), 88; got != want {
 		t.Errorf("font.StemV() = %d, want %d", got, want)
 	}
 	if got, want := font.XHeight(), 425; got != want {
@@ -148,6 +174,10 @@ func TestSubset(t *testing.T) {
 	if got, want := buf.Len(), 5800; got != want {
 		t.Errorf("len(buf) = %d, want %d", got, want)
 	}
+	// checksumAdjustment makes the checksum of the whole font 0xB1B0AFBA
+	if got, want := calcChecksum(buf.Bytes()), uint32(0xB1B0AFBA); got != want {
+		t.Errorf("calcChecksum(subset) = %#x, want %#x", got, want)
+	}
 }
 
 func TestWidths(t *testing.T) {
@@ -207,3 +237,1534 @@ func TestIndex(t *testing.T) {
 		}
 	}
 }
+
+// buildCollection creates a TrueType collection from the given font files.
+func buildCollection(fonts ...[]byte) []byte {
+	var b bytes.Buffer
+	headerLen := 12 + 4*len(fonts)
+	dirLen := 0
+	for _, f := range fonts {
+		dirLen += 12 + 16*int(binary.BigEndian.Uint16(f[4:]))
+	}
+	binary.Write(&b, binary.BigEndian, uint32(magicCollection))
+	binary.Write(&b, binary.BigEndian, []uint16{1, 0})
+	binary.Write(&b, binary.BigEndian, uint32(len(fonts)))
+	dirOffset := headerLen
+	for _, f := range fonts {
+		binary.Write(&b, binary.BigEndian, uint32(dirOffset))
+		dirOffset += 12 + 16*int(binary.BigEndian.Uint16(f[4:]))
+	}
+	var tabledata bytes.Buffer
+	dataOffset := headerLen + dirLen
+	for _, f := range fonts {
+		numTables := int(binary.BigEndian.Uint16(f[4:]))
+		b.Write(f[:12])
+		for i := 0; i < numTables; i++ {
+			entry := f[12+16*i : 28+16*i]
+			offset := binary.BigEndian.Uint32(entry[8:])
+			length := binary.BigEndian.Uint32(entry[12:])
+			b.Write(entry[:8])
+			binary.Write(&b, binary.BigEndian, uint32(dataOffset+tabledata.Len()))
+			binary.Write(&b, binary.BigEndian, length)
+			tabledata.Write(f[offset : offset+length])
+			for tabledata.Len()%4 != 0 {
+				tabledata.WriteByte(0)
+			}
+		}
+	}
+	b.Write(tabledata.Bytes())
+	return b.Bytes()
+}
+
+func TestCollection(t *testing.T) {
+	var fonts [][]byte
+	for _, fn := range []string{"s552.ttf", "CrimsonPro-Regular.ttf"} {
+		data, err := os.ReadFile(filepath.Join("testdata", fn))
+		if err != nil {
+			t.Fatal(err)
+		}
+		fonts = append(fonts, data)
+	}
+	r := bytes.NewReader(buildCollection(fonts...))
+
+	n, err := NumFaces(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := n, 2; got != want {
+		t.Errorf("NumFaces() = %d, want %d", got, want)
+	}
+
+	font, err := Open(r, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = font.ReadTables(); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := font.FontName, "CrimsonPro-Regular"; got != want {
+		t.Errorf("font.FontName = %q, want %q", got, want)
+	}
+	if idx, _ := font.GetIndex('H'); idx != 76 {
+		t.Errorf("font.GetIndex('H') = %d, want 76", idx)
+	}
+	if _, err = Open(r, 2); err == nil {
+		t.Errorf("Open(r, 2) should fail for a collection with two faces")
+	}
+
+	n, err = NumFaces(bytes.NewReader(fonts[0]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := n, 1; got != want {
+		t.Errorf("NumFaces() = %d, want %d", got, want)
+	}
+
+	// a header that claims more faces than the file can hold
+	hdr := []byte{'t', 't', 'c', 'f', 0, 1, 0, 0, 0xff, 0xff, 0xff, 0xff, 0, 0, 0, 12}
+	if _, err = NumFaces(bytes.NewReader(hdr)); err == nil {
+		t.Errorf("NumFaces() should fail for a truncated collection header")
+	}
+	if _, err = Open(bytes.NewReader(hdr), 0); err == nil {
+		t.Errorf("Open() should fail for a truncated collection header")
+	}
+}
+
+// buildWOFF creates a WOFF file from the sfnt data. Every table is compressed
+// if that makes it smaller.
+func buildWOFF(sfnt []byte) []byte {
+	numTables := int(binary.BigEndian.Uint16(sfnt[4:]))
+	var tabledata bytes.Buffer
+	var entries []woffTableEntry
+	dataOffset := 44 + 20*numTables
+	for i := 0; i < numTables; i++ {
+		entry := sfnt[12+16*i : 28+16*i]
+		offset := binary.BigEndian.Uint32(entry[8:])
+		length := binary.BigEndian.Uint32(entry[12:])
+		data := sfnt[offset : offset+length]
+		var compressed bytes.Buffer
+		zw := zlib.NewWriter(&compressed)
+		zw.Write(data)
+		zw.Close()
+		if compressed.Len() < len(data) {
+			data = compressed.Bytes()
+		}
+		e := woffTableEntry{
+			Offset:       uint32(dataOffset + tabledata.Len()),
+			CompLength:   uint32(len(data)),
+			OrigLength:   length,
+			OrigChecksum: binary.BigEndian.Uint32(entry[4:]),
+		}
+		copy(e.Tag[:], entry[:4])
+		entries = append(entries, e)
+		tabledata.Write(data)
+		for tabledata.Len()%4 != 0 {
+			tabledata.WriteByte(0)
+		}
+	}
+	hdr := woffHeader{
+		Signature:     magicWOFF,
+		Flavor:        binary.BigEndian.Uint32(sfnt),
+		Length:        uint32(dataOffset + tabledata.Len()),
+		NumTables:     uint16(numTables),
+		TotalSfntSize: uint32(len(sfnt)),
+		MajorVersion:  1,
+	}
+	var b bytes.Buffer
+	binary.Write(&b, binary.BigEndian, hdr)
+	binary.Write(&b, binary.BigEndian, entries)
+	b.Write(tabledata.Bytes())
+	return b.Bytes()
+}
+
+func TestWOFF(t *testing.T) {
+	sfnt, err := os.ReadFile(filepath.Join("testdata", "CrimsonPro-Regular.ttf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	orig, err := Open(bytes.NewReader(sfnt), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	font, err := Open(bytes.NewReader(buildWOFF(sfnt)), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = font.ReadTables(); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := font.FontName, "CrimsonPro-Regular"; got != want {
+		t.Errorf("font.FontName = %q, want %q", got, want)
+	}
+	for _, tbl := range []string{"cmap", "glyf", "head", "loca", "name", "post"} {
+		want, err := orig.ReadTableData(tbl)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := font.ReadTableData(tbl)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("table %s differs from the original table", tbl)
+		}
+	}
+
+	if err = font.Subset([]int{0, 76, 280, 340, 362, 625}); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err = font.WriteSubset(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := buf.Len(), 5800; got != want {
+		t.Errorf("len(buf) = %d, want %d", got, want)
+	}
+
+	// table entries with lengths that do not fit into the file
+	for _, field := range []int{8, 12} {
+		woff := buildWOFF(sfnt)
+		binary.BigEndian.PutUint32(woff[44+field:], 0x7fffffff)
+		if _, err = Open(bytes.NewReader(woff), 0); err == nil {
+			t.Errorf("Open() should fail for a WOFF table entry with the length %#x at %d", 0x7fffffff, field)
+		}
+	}
+}
+
+// storeBrotli returns a Brotli stream with the data in uncompressed meta-blocks.
+func storeBrotli(data []byte) []byte {
+	var b []byte
+	var bits, nbits uint
+	writeBits := func(n, v uint) {
+		bits |= v << nbits
+		nbits += n
+		for nbits >= 8 {
+			b = append(b, byte(bits))
+			bits >>= 8
+			nbits -= 8
+		}
+	}
+	flush := func() {
+		if nbits > 0 {
+			writeBits(8-nbits, 0)
+		}
+	}
+	writeBits(1, 0) // window size 16
+	for len(data) > 0 {
+		n := len(data)
+		if n > 1<<16 {
+			n = 1 << 16
+		}
+		writeBits(1, 0)          // ISLAST
+		writeBits(2, 0)          // MNIBBLES: 4
+		writeBits(16, uint(n-1)) // MLEN - 1
+		writeBits(1, 1)          // ISUNCOMPRESSED
+		flush()
+		b = append(b, data[:n]...)
+		data = data[n:]
+	}
+	writeBits(2, 3) // ISLAST, ISLASTEMPTY
+	flush()
+	return b
+}
+
+// buildWOFF2 creates a WOFF2 file from the sfnt data. The tables are not
+// transformed and the data is stored in uncompressed Brotli meta-blocks.
+func buildWOFF2(sfnt []byte) []byte {
+	numTables := int(binary.BigEndian.Uint16(sfnt[4:]))
+	var directory, tabledata bytes.Buffer
+	for i := 0; i < numTables; i++ {
+		entry := sfnt[12+16*i : 28+16*i]
+		tag := string(entry[:4])
+		offset := binary.BigEndian.Uint32(entry[8:])
+		length := binary.BigEndian.Uint32(entry[12:])
+		flags := byte(0x3f)
+		for idx, knownTag := range woff2KnownTags {
+			if knownTag == tag {
+				flags = byte(idx)
+			}
+		}
+		if tag == "glyf" || tag == "loca" {
+			// null transform
+			flags |= 0xc0
+		}
+		directory.WriteByte(flags)
+		if flags&0x3f == 0x3f {
+			directory.WriteString(tag)
+		}
+		// UIntBase128
+		var enc []byte
+		for v := length; ; v >>= 7 {
+			enc = append([]byte{byte(v&0x7f) | 0x80}, enc...)
+			if v < 0x80 {
+				break
+			}
+		}
+		enc[len(enc)-1] &= 0x7f
+		directory.Write(enc)
+		tabledata.Write(sfnt[offset : offset+length])
+	}
+	compressed := storeBrotli(tabledata.Bytes())
+	hdr := woff2Header{
+		Signature:           magicWOFF2,
+		Flavor:              binary.BigEndian.Uint32(sfnt),
+		NumTables:           uint16(numTables),
+		TotalSfntSize:       uint32(len(sfnt)),
+		TotalCompressedSize: uint32(len(compressed)),
+		MajorVersion:        1,
+	}
+	hdr.Length = uint32(binary.Size(hdr) + directory.Len() + len(compressed))
+	var b bytes.Buffer
+	binary.Write(&b, binary.BigEndian, hdr)
+	b.Write(directory.Bytes())
+	b.Write(compressed)
+	return b.Bytes()
+}
+
+func TestWOFF2(t *testing.T) {
+	sfnt, err := os.ReadFile(filepath.Join("testdata", "CrimsonPro-Regular.ttf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	orig, err := Open(bytes.NewReader(sfnt), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	font, err := Open(bytes.NewReader(buildWOFF2(sfnt)), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = font.ReadTables(); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := font.FontName, "CrimsonPro-Regular"; got != want {
+		t.Errorf("font.FontName = %q, want %q", got, want)
+	}
+	for _, tbl := range []string{"cmap", "glyf", "hmtx", "loca", "name", "post"} {
+		want, err := orig.ReadTableData(tbl)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := font.ReadTableData(tbl)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Errorf("table %s differs from the original table", tbl)
+		}
+	}
+}
+
+func TestWOFF2GlyfTransform(t *testing.T) {
+	// Two glyphs: an empty glyph and a simple glyph with the points (5,5),
+	// (105,5) (off curve) and (95,5).
+	nContours := []byte{0, 0, 0, 1}
+	nPoints := []byte{3}
+	flags := []byte{23, 0x80 | 11, 10}
+	glyphs := []byte{0x44, 100, 10, 0}
+	bboxes := []byte{0x40, 0, 0, 0, 0, 5, 0, 5, 0, 105, 0, 5}
+	var transformed bytes.Buffer
+	binary.Write(&transformed, binary.BigEndian, []uint16{0, 0, 2, 0})
+	for _, stream := range [][]byte{nContours, nPoints, flags, glyphs, nil, bboxes, nil} {
+		binary.Write(&transformed, binary.BigEndian, uint32(len(stream)))
+	}
+	for _, stream := range [][]byte{nContours, nPoints, flags, glyphs, bboxes} {
+		transformed.Write(stream)
+	}
+	glyf, loca, err := reconstructGlyfLoca(transformed.Bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := loca, []byte{0, 0, 0, 0, 0, 12}; !bytes.Equal(got, want) {
+		t.Errorf("loca = %v, want %v", got, want)
+	}
+	want := []byte{
+		0, 1, 0, 5, 0, 5, 0, 105, 0, 5, // number of contours and bbox
+		0, 2, 0, 0, // end point and instruction length
+		0x37, 0x32, 0x23, // flags
+		5, 100, 10, // x coordinates
+		5,       // y coordinates
+		0, 0, 0, // padding
+	}
+	if !bytes.Equal(glyf, want) {
+		t.Errorf("glyf = %v, want %v", glyf, want)
+	}
+}
+
+// glyphOutline returns the bounding box, the end points of the contours, the
+// instructions and the points of a simple glyph or the data of a composite
+// glyph. Equal outlines can have different encodings of the flags and
+// coordinates.
+func glyphOutline(glyph []byte) string {
+	if len(glyph) == 0 {
+		return ""
+	}
+	numContours := int(int16(binary.BigEndian.Uint16(glyph)))
+	if numContours < 0 {
+		// without the padding
+		return fmt.Sprint(bytes.TrimRight(glyph, "\x00"))
+	}
+	pos := 10
+	endPts := make([]int, numContours)
+	for i := range endPts {
+		endPts[i] = int(binary.BigEndian.Uint16(glyph[pos:]))
+		pos += 2
+	}
+	numPoints := 0
+	if numContours > 0 {
+		numPoints = endPts[numContours-1] + 1
+	}
+	insLen := int(binary.BigEndian.Uint16(glyph[pos:]))
+	instructions := glyph[pos+2 : pos+2+insLen]
+	pos += 2 + insLen
+	flags := make([]byte, 0, numPoints)
+	for len(flags) < numPoints {
+		flag := glyph[pos]
+		pos++
+		flags = append(flags, flag)
+		if flag&0x08 != 0 {
+			for n := glyph[pos]; n > 0; n-- {
+				flags = append(flags, flag)
+			}
+			pos++
+		}
+	}
+	coords := func(short, same byte) []int {
+		var v int
+		c := make([]int, numPoints)
+		for i, flag := range flags[:numPoints] {
+			switch {
+			case flag&short != 0 && flag&same != 0:
+				v += int(glyph[pos])
+				pos++
+			case flag&short != 0:
+				v -= int(glyph[pos])
+				pos++
+			case flag&same == 0:
+				v += int(int16(binary.BigEndian.Uint16(glyph[pos:])))
+				pos += 2
+			}
+			c[i] = v
+		}
+		return c
+	}
+	x := coords(0x02, 0x10)
+	y := coords(0x04, 0x20)
+	onCurve := make([]bool, numPoints)
+	for i, flag := range flags[:numPoints] {
+		onCurve[i] = flag&0x01 != 0
+	}
+	return fmt.Sprint(glyph[:10], endPts, instructions, onCurve, x, y)
+}
+
+func TestWOFF2Reference(t *testing.T) {
+	// fontawesome.ttc has two faces with the tables of FontAwesome.ttf (Font
+	// Awesome 4.7), the second face has no FFTM table. fontawesome.woff2 is
+	// the web font of Font Awesome 4.7, which was created from FontAwesome.ttf
+	// with Google's woff2_compress and has a transformed glyf table.
+	// fontawesome-collection.woff2 has the table directory and the compressed
+	// data of fontawesome.woff2 and a collection directory for the two faces.
+	ttc, err := os.ReadFile(filepath.Join("testdata", "fontawesome.ttc"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, td := range []struct {
+		filename string
+		numFaces int
+	}{
+		{"fontawesome.woff2", 1},
+		{"fontawesome-collection.woff2", 2},
+	} {
+		data, err := os.ReadFile(filepath.Join("testdata", td.filename))
+		if err != nil {
+			t.Fatal(err)
+		}
+		numFaces, err := NumFaces(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if numFaces != td.numFaces {
+			t.Errorf("%s: NumFaces() = %d, want %d", td.filename, numFaces, td.numFaces)
+		}
+		for face := 0; face < td.numFaces; face++ {
+			orig, err := Open(bytes.NewReader(ttc), face)
+			if err != nil {
+				t.Fatal(err)
+			}
+			font, err := Open(bytes.NewReader(data), face)
+			if err != nil {
+				t.Fatalf("%s: Open(r, %d): %s", td.filename, face, err)
+			}
+			if err = font.ReadTables(); err != nil {
+				t.Fatal(err)
+			}
+			if got, want := len(font.tables), len(orig.tables); got != want {
+				t.Errorf("%s face %d: %d tables, want %d", td.filename, face, got, want)
+			}
+			for name := range orig.tables {
+				want, err := orig.ReadTableData(name)
+				if err != nil {
+					t.Fatal(err)
+				}
+				got, err := font.ReadTableData(name)
+				if err != nil {
+					t.Errorf("%s face %d: %s", td.filename, face, err)
+					continue
+				}
+				switch name {
+				case "glyf", "loca":
+					// compared below
+					continue
+				case "head":
+					// the checksum adjustment and the flag for modified
+					// fonts
+					want = append([]byte{}, want...)
+					copy(want[8:12], got[8:12])
+					want[16] |= 0x08
+				}
+				if !bytes.Equal(got, want) {
+					t.Errorf("%s face %d: table %s differs from the original table", td.filename, face, name)
+				}
+			}
+			if err = orig.ReadTables(); err != nil {
+				t.Fatal(err)
+			}
+			if got, want := len(font.Glyph), len(orig.Glyph); got != want {
+				t.Fatalf("%s face %d: %d glyphs, want %d", td.filename, face, got, want)
+			}
+			for gid, g := range orig.Glyph {
+				if got, want := glyphOutline(font.Glyph[gid]), glyphOutline(g); got != want {
+					t.Errorf("%s face %d: glyph %d differs from the original glyph", td.filename, face, gid)
+				}
+			}
+		}
+	}
+}
+
+func TestWriteWebFont(t *testing.T) {
+	sfnt, err := os.ReadFile(filepath.Join("testdata", "CrimsonPro-Regular.ttf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	orig, err := Open(bytes.NewReader(sfnt), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = orig.ReadTables(); err != nil {
+		t.Fatal(err)
+	}
+	origGlyf, _ := orig.ReadTableData("glyf")
+	origLoca, _ := orig.ReadTableData("loca")
+	origTransformed, err := transformGlyf(origGlyf, origLoca, int(orig.Maxp.NumGlyphs), orig.Head.IndexToLocFormat)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	writers := map[string]func(*Font, io.Writer) error{
+		"WriteWOFF":  (*Font).WriteWOFF,
+		"WriteWOFF2": (*Font).WriteWOFF2,
+	}
+	for name, write := range writers {
+		for _, subset := range []bool{false, true} {
+			font, err := Open(bytes.NewReader(sfnt), 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err = font.ReadTables(); err != nil {
+				t.Fatal(err)
+			}
+			if subset {
+				font.Subset([]int{0, 76, 280, 340, 362, 625})
+			}
+			var buf bytes.Buffer
+			if err = write(font, &buf); err != nil {
+				t.Errorf("%s(subset %t): %s", name, subset, err)
+				continue
+			}
+			font, err = Open(bytes.NewReader(buf.Bytes()), 0)
+			if err != nil {
+				t.Errorf("%s(subset %t): Open: %s", name, subset, err)
+				continue
+			}
+			if err = font.ReadTables(); err != nil {
+				t.Fatal(err)
+			}
+			if got, want := font.FontName, "CrimsonPro-Regular"; got != want {
+				t.Errorf("%s(subset %t): font.FontName = %q, want %q", name, subset, got, want)
+			}
+			if got, _ := font.GetIndex('H'); got != 76 {
+				t.Errorf("%s(subset %t): font.GetIndex('H') = %d, want 76", name, subset, got)
+			}
+			if got, want := font.advanceWidth[76], orig.advanceWidth[76]; got != want {
+				t.Errorf("%s(subset %t): advance width of glyph 76 = %d, want %d", name, subset, got, want)
+			}
+			want := int(orig.Maxp.NumGlyphs)
+			if subset {
+				want = 626
+			}
+			if got := int(font.Maxp.NumGlyphs); got != want {
+				t.Errorf("%s(subset %t): font.Maxp.NumGlyphs = %d, want %d", name, subset, got, want)
+			}
+			if subset {
+				continue
+			}
+			glyf, _ := font.ReadTableData("glyf")
+			loca, _ := font.ReadTableData("loca")
+			transformed, err := transformGlyf(glyf, loca, int(font.Maxp.NumGlyphs), font.Head.IndexToLocFormat)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(transformed, origTransformed) {
+				t.Errorf("%s: glyph outlines differ from the original outlines", name)
+			}
+		}
+	}
+}
+
+func TestWOFFMetadata(t *testing.T) {
+	f, err := os.Open(filepath.Join("testdata", "CrimsonPro-Regular.ttf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	font, err := Open(f, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	metadata := font.woffMetadata()
+	var m struct {
+		UniqueID struct {
+			ID string `xml:"id,attr"`
+		} `xml:"uniqueid"`
+		Copyright string `xml:"copyright>text"`
+	}
+	if err = xml.Unmarshal(metadata, &m); err != nil {
+		t.Fatal(err)
+	}
+	if m.UniqueID.ID != font.names[3] {
+		t.Errorf("uniqueid = %q, want %q", m.UniqueID.ID, font.names[3])
+	}
+	if m.Copyright != font.names[0] {
+		t.Errorf("copyright = %q, want %q", m.Copyright, font.names[0])
+	}
+}
+
+func TestWriteWebFontCFF(t *testing.T) {
+	sfnt, err := os.ReadFile(filepath.Join("testdata", "customfont.otf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, write := range []func(*Font, io.Writer) error{(*Font).WriteWOFF, (*Font).WriteWOFF2} {
+		font, err := Open(bytes.NewReader(sfnt), 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = font.ReadTables(); err != nil {
+			t.Fatal(err)
+		}
+		font.Subset([]int{0, 1, 3})
+		var buf bytes.Buffer
+		if err = write(font, &buf); err != nil {
+			t.Fatal(err)
+		}
+		font, err = Open(bytes.NewReader(buf.Bytes()), 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = font.ReadTables(); err != nil {
+			t.Fatal(err)
+		}
+		if got, want := len(font.CFF.Font[0].CharStrings), 4; got != want {
+			t.Errorf("len(CharStrings) = %d, want %d", got, want)
+		}
+		if got, want := font.ToCodepoint['o'], 3; got != want {
+			t.Errorf("font.ToCodepoint['o'] = %d, want %d", got, want)
+		}
+	}
+}
+
+func TestWrite(t *testing.T) {
+	sfnt, err := os.ReadFile(filepath.Join("testdata", "CrimsonPro-Regular.ttf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	font, err := Open(bytes.NewReader(sfnt), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = font.ReadTables(); err != nil {
+		t.Fatal(err)
+	}
+	if err = font.SetName(1, "Crimson Test"); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err = font.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	out := buf.Bytes()
+	if got, want := calcChecksum(out), uint32(0xB1B0AFBA); got != want {
+		t.Errorf("font checksum = %x, want %x", got, want)
+	}
+	_, tables := sfntTables(out)
+	if got, want := len(tables), len(font.tables); got != want {
+		t.Errorf("len(tables) = %d, want %d", got, want)
+	}
+	for _, tbl := range tables {
+		if tbl.name != "head" && calcChecksum(tbl.tabledata) != tbl.checksum {
+			t.Errorf("checksum of table %s is not correct", tbl.name)
+		}
+		switch tbl.name {
+		case "OS/2", "cmap", "post", "hmtx", "glyf", "loca", "GSUB", "GPOS":
+			want, err := font.ReadTableData(tbl.name)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !bytes.Equal(tbl.tabledata, want) {
+				t.Errorf("table %s differs from the original table", tbl.name)
+			}
+		}
+	}
+
+	font2, err := Open(bytes.NewReader(out), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = font2.ReadTables(); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := font2.names[1], "Crimson Test"; got != want {
+		t.Errorf("font2.names[1] = %q, want %q", got, want)
+	}
+	if got, want := font2.FontName, "CrimsonPro-Regular"; got != want {
+		t.Errorf("font2.FontName = %q, want %q", got, want)
+	}
+	if got, want := font2.GlyphNames[76], font.GlyphNames[76]; got != want {
+		t.Errorf("font2.GlyphNames[76] = %q, want %q", got, want)
+	}
+	if font2.OS2 != font.OS2 || font2.OS2AdditionalFields != font.OS2AdditionalFields {
+		t.Errorf("OS/2 table differs from the original table")
+	}
+
+	// the cmap of a subset is created from ToCodepoint, a private use
+	// character needs an idDelta modulo 65536
+	font.ToCodepoint[0xF000] = 76
+	if err = font.Subset([]int{0, 76, 280}); err != nil {
+		t.Fatal(err)
+	}
+	buf.Reset()
+	if err = font.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	font3, err := Open(bytes.NewReader(buf.Bytes()), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = font3.ReadTables(); err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range []rune{'H', 'e', 0xF000} {
+		if got, want := font3.ToCodepoint[r], font.ToCodepoint[r]; got != want {
+			t.Errorf("font3.ToCodepoint[%U] = %d, want %d", r, got, want)
+		}
+	}
+	if got, want := len(font3.ToCodepoint), 3; got != want {
+		t.Errorf("len(font3.ToCodepoint) = %d, want %d", got, want)
+	}
+}
+
+func TestSubsetCompact(t *testing.T) {
+	f, err := os.Open(filepath.Join("testdata", "CrimsonPro-Regular.ttf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	font, err := Open(f, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = font.ReadTables(); err != nil {
+		t.Fatal(err)
+	}
+	// 281 (é) is a composite glyph of 280 (e) and 720 (acute)
+	mapping, err := font.SubsetCompact([]int{76, 281})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[int]int{0: 0, 76: 1, 280: 2, 281: 3, 720: 4}
+	if len(mapping) != len(want) {
+		t.Errorf("len(mapping) = %d, want %d", len(mapping), len(want))
+	}
+	for oldID, newID := range want {
+		if got := mapping[oldID]; got != newID {
+			t.Errorf("mapping[%d] = %d, want %d", oldID, got, newID)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err = font.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	font, err = Open(bytes.NewReader(buf.Bytes()), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = font.ReadTables(); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := font.Maxp.NumGlyphs, uint16(5); got != want {
+		t.Errorf("font.Maxp.NumGlyphs = %d, want %d", got, want)
+	}
+	data := []struct {
+		r   rune
+		idx int
+		wd  int
+	}{
+		{'H', 1, 672},
+		{'e', 2, 450},
+		{'é', 3, 450},
+	}
+	for _, d := range data {
+		idx, _ := font.GetIndex(d.r)
+		if idx != d.idx {
+			t.Errorf("font.GetIndex(%q) = %d, want %d", d.r, idx, d.idx)
+		}
+		if adv, _ := font.GlyphAdvance(d.idx); adv != d.wd {
+			t.Errorf("font.GlyphAdvance(%d) = %d, want %d", d.idx, adv, d.wd)
+		}
+	}
+	if got, want := fmt.Sprint(font.getGlyphComponentIds(3)), "[2 4]"; got != want {
+		t.Errorf("font.getGlyphComponentIds(3) = %s, want %s", got, want)
+	}
+}
+
+func TestDesubroutinize(t *testing.T) {
+	f, err := os.Open(filepath.Join("testdata", "CrimsonPro-Regular.ttf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	font, err := Open(f, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = font.Desubroutinize(); err == nil {
+		t.Errorf("Desubroutinize() on a TrueType font: no error")
+	}
+
+	sfnt, err := os.ReadFile(filepath.Join("testdata", "customfont.otf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if font, err = Open(bytes.NewReader(sfnt), 0); err != nil {
+		t.Fatal(err)
+	}
+	if err = font.ReadTables(); err != nil {
+		t.Fatal(err)
+	}
+	want := font.CFF.Font[0].CharStrings[3]
+	if err = font.Desubroutinize(); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err = font.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if font, err = Open(bytes.NewReader(buf.Bytes()), 0); err != nil {
+		t.Fatal(err)
+	}
+	if err = font.ReadTables(); err != nil {
+		t.Fatal(err)
+	}
+	if got := font.CFF.Font[0].CharStrings[3]; !bytes.Equal(got, want) {
+		t.Errorf("CharStrings[3] = %v, want %v", got, want)
+	}
+}
+
+func TestGlyfOutline(t *testing.T) {
+	tt, err := LoadFace(filepath.Join("testdata", "CrimsonPro-Regular.ttf"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = tt.ReadTables(); err != nil {
+		t.Fatal(err)
+	}
+	path, err := tt.glyfOutline(tt.ToCodepoint['o'])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := fmt.Sprint(path[:3]), "[{MoveTo [{257 -8} {0 0} {0 0}]} {QuadTo [{192 -8} {143.5 20} {0 0}]} {QuadTo [{95 48} {68 98.5} {0 0}]}]"; got != want {
+		t.Errorf("path = %s, want %s", got, want)
+	}
+
+	// a triangle and composite glyphs with a scale, a 2x2 transformation
+	// and matching points
+	var triangle, scaled, rotated, matched bytes.Buffer
+	binary.Write(&triangle, binary.BigEndian, []int16{1, 0, 0, 100, 100, 2, 0})
+	triangle.Write([]byte{glyfOnCurve, glyfOnCurve, glyfOnCurve})
+	binary.Write(&triangle, binary.BigEndian, []int16{0, 100, -50, 0, 0, 100})
+	binary.Write(&scaled, binary.BigEndian, []int16{-1, 0, 0, 0, 0,
+		flagArgsAreXYValues | flagArg1And2AreWords | flagWeHaveAScale, 0, 10, 20, 1 << 13})
+	binary.Write(&rotated, binary.BigEndian, []int16{-1, 0, 0, 0, 0,
+		flagArgsAreXYValues | flagWeHaveATwoByTwo, 0, 0, 0, 1 << 14, 0, 0})
+	binary.Write(&matched, binary.BigEndian, []int16{-1, 0, 0, 0, 0,
+		flagArgsAreXYValues | flagMoreComponents, 0, 0, 0, 0, 0x0200})
+	tt = &Font{Glyph: []Glyph{triangle.Bytes(), scaled.Bytes(), rotated.Bytes(), matched.Bytes()}}
+	testdata := []struct {
+		gid  int
+		want string
+	}{
+		{0, "[{MoveTo [{0 0} {0 0} {0 0}]} {LineTo [{100 0} {0 0} {0 0}]} {LineTo [{50 100} {0 0} {0 0}]}]"},
+		{1, "[{MoveTo [{10 20} {0 0} {0 0}]} {LineTo [{60 20} {0 0} {0 0}]} {LineTo [{35 70} {0 0} {0 0}]}]"},
+		{2, "[{MoveTo [{0 0} {0 0} {0 0}]} {LineTo [{0 100} {0 0} {0 0}]} {LineTo [{0 50} {0 0} {0 0}]}]"},
+		{3, "[{MoveTo [{0 0} {0 0} {0 0}]} {LineTo [{100 0} {0 0} {0 0}]} {LineTo [{50 100} {0 0} {0 0}]} " +
+			"{MoveTo [{50 100} {0 0} {0 0}]} {LineTo [{150 100} {0 0} {0 0}]} {LineTo [{100 200} {0 0} {0 0}]}]"},
+	}
+	for _, td := range testdata {
+		path, err := tt.glyfOutline(td.gid)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := fmt.Sprint(path); got != td.want {
+			t.Errorf("glyph %d: path = %s, want %s", td.gid, got, td.want)
+		}
+	}
+}
+
+func TestGlyphPath(t *testing.T) {
+	tt, err := LoadFace(filepath.Join("testdata", "CrimsonPro-Regular.ttf"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = tt.GlyphPath(1); err == nil {
+		t.Errorf("GlyphPath() before reading the tables: error = nil")
+	}
+	if err = tt.ReadTables(); err != nil {
+		t.Fatal(err)
+	}
+	gid := tt.ToCodepoint['o']
+	bounds, err := tt.GlyphBounds(gid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := bounds, (Rect{Min: cff.Point{X: 41, Y: -8}, Max: cff.Point{X: 467, Y: 438}}); got != want {
+		t.Errorf("GlyphBounds() = %v, want %v", got, want)
+	}
+	path, err := tt.ScaledGlyphPath(gid, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	scale := 10 / float64(tt.UnitsPerEM)
+	if got, want := path.Bounds(), (Rect{Min: cff.Point{X: 41 * scale, Y: -8 * scale}, Max: cff.Point{X: 467 * scale, Y: 438 * scale}}); got != want {
+		t.Errorf("bounds of the scaled path = %v, want %v", got, want)
+	}
+
+	tt, err = LoadFace(filepath.Join("testdata", "customfont.otf"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = tt.ReadTables(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = tt.GlyphPath(1); err != nil {
+		t.Errorf("GlyphPath() of a CFF font: %s", err)
+	}
+}
+
+func TestFontDescriptor(t *testing.T) {
+	tt, err := LoadFace(filepath.Join("testdata", "customfont.otf"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = tt.ReadTables(); err != nil {
+		t.Fatal(err)
+	}
+	// from the CFF font
+	if got, want := tt.BoundingBox(), "[20 -20 700 680]"; got != want {
+		t.Errorf("BoundingBox() = %s, want %s", got, want)
+	}
+	if got, want := tt.StemV(), 10; got != want {
+		t.Errorf("StemV() = %d, want %d", got, want)
+	}
+
+	tt = &Font{ToUni: map[int]rune{1: 'a', 2: 'α'}}
+	tt.Post.ItalicAngle = -12<<16 - 1<<15
+	tt.Post.IsFixedPitch = 1
+	tt.OS2.Panose = [10]uint8{panoseFamilyLatinText, 5, panoseWeightBold}
+	if got, want := tt.ItalicAngle(), -12.5; got != want {
+		t.Errorf("ItalicAngle() = %v, want %v", got, want)
+	}
+	if got, want := tt.Flags(), pdfFlagFixedPitch|pdfFlagSerif|pdfFlagSymbolic|pdfFlagItalic|pdfFlagForceBold; got != want {
+		t.Errorf("Flags() = %b, want %b", got, want)
+	}
+	tt.subsetCodepoints = []int{1}
+	if got, want := tt.Flags()&(pdfFlagSymbolic|pdfFlagNonsymbolic), pdfFlagNonsymbolic; got != want {
+		t.Errorf("Flags() of the subset = %b, want %b", got, want)
+	}
+}
+
+func TestToUnicodeCMap(t *testing.T) {
+	tt := &Font{
+		ToUni:            map[int]rune{1: 'a', 2: 'b', 3: 'c', 4: 'x', 0xfe: 'A', 0xff: 'B', 0x100: 'C', 10: 0x1f600},
+		subsetCodepoints: []int{1, 2, 3, 4, 10, 0xfe, 0xff, 0x100, 12},
+	}
+	cmap := tt.ToUnicodeCMap(map[int]string{5: "ffi", 2: "b"})
+	for _, want := range []string{
+		"<0000><FFFF>\nendcodespacerange\n",
+		"4 beginbfchar\n<0004><0078>\n<0005><006600660069>\n<000A><D83DDE00>\n<0100><0043>\nendbfchar\n",
+		"2 beginbfrange\n<0001><0003><0061>\n<00FE><00FF><0041>\nendbfrange\n",
+	} {
+		if !strings.Contains(cmap, want) {
+			t.Errorf("CMap does not contain %q:\n%s", want, cmap)
+		}
+	}
+
+	// blocks have at most 100 entries
+	tt = &Font{ToUni: map[int]rune{}}
+	for i := 0; i < 250; i++ {
+		tt.ToUni[2*i] = rune('A' + 2*i)
+		tt.subsetCodepoints = append(tt.subsetCodepoints, 2*i)
+	}
+	cmap = tt.CMap()
+	for _, want := range []string{"100 beginbfchar", "50 beginbfchar"} {
+		if got := strings.Count(cmap, want); got == 0 {
+			t.Errorf("CMap does not contain %q", want)
+		}
+	}
+	if got, want := strings.Count(cmap, "beginbfchar"), 3; got != want {
+		t.Errorf("number of bfchar blocks = %d, want %d", got, want)
+	}
+}
+
+func TestCompactWidths(t *testing.T) {
+	tt := &Font{
+		UnitsPerEM:       2000,
+		advanceWidth:     []uint16{1000, 1200, 1200, 1200, 1400, 2000, 0, 501, 600, 0, 2000, 800, 800},
+		subsetCodepoints: []int{0, 1, 2, 3, 4, 5, 7, 8, 10, 11, 12, 1},
+	}
+	if got, want := tt.Widths(), "[0 [500] 1 3 600 4 [700] 7 [250.5 300] 11 [400 400]]"; got != want {
+		t.Errorf("Widths() = %s, want %s", got, want)
+	}
+	if got, want := tt.WidthsWithDefault(600), "[0 [500] 4 [700 1000] 7 [250.5 300] 10 [1000 400 400]]"; got != want {
+		t.Errorf("WidthsWithDefault(600) = %s, want %s", got, want)
+	}
+}
+
+// addTables returns the font file filename with the additional tables.
+func addTables(t *testing.T, filename string, extra map[string][]byte) []byte {
+	tt, err := LoadFace(filepath.Join("testdata", filename), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tables []tableOffsetLength
+	for name := range tt.tables {
+		if _, ok := extra[name]; ok {
+			continue
+		}
+		data, err := tt.ReadTableData(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tables = append(tables, tableOffsetLength{name: name, tabledata: data, checksum: calcChecksum(data)})
+	}
+	for name, data := range extra {
+		tables = append(tables, tableOffsetLength{name: name, tabledata: data, checksum: calcChecksum(data)})
+	}
+	return buildSfnt(tt.sfntVersion, tables)
+}
+
+func TestVerticalMetrics(t *testing.T) {
+	var vhea, vmtx bytes.Buffer
+	binary.Write(&vhea, binary.BigEndian, uint32(0x00011000))
+	binary.Write(&vhea, binary.BigEndian, []int16{880, -120, 0, 1024, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 3})
+	binary.Write(&vmtx, binary.BigEndian, []int16{1000, 100, 1024, 50, 1024, 60})
+	// top side bearings of the other glyphs
+	vmtx.Write(make([]byte, 2*(825-3)))
+	sfnt := addTables(t, "CrimsonPro-Regular.ttf", map[string][]byte{"vhea": vhea.Bytes(), "vmtx": vmtx.Bytes()})
+	tt, err := Open(bytes.NewReader(sfnt), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = tt.ReadTables(); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := tt.Vhea.VertTypoAscender, int16(880); got != want {
+		t.Errorf("Vhea.VertTypoAscender = %d, want %d", got, want)
+	}
+	yMax := func(gid int) int {
+		return int(int16(binary.BigEndian.Uint16(tt.Glyph[gid][8:])))
+	}
+	for _, td := range []struct{ gid, advance, tsb int }{{0, 1000, 100}, {1, 1024, 50}, {100, 1024, 0}} {
+		advance, err := tt.GlyphVerticalAdvance(td.gid)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if advance != td.advance {
+			t.Errorf("GlyphVerticalAdvance(%d) = %d, want %d", td.gid, advance, td.advance)
+		}
+		origin, err := tt.GlyphVerticalOrigin(td.gid)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := td.tsb + yMax(td.gid); origin != want {
+			t.Errorf("GlyphVerticalOrigin(%d) = %d, want %d", td.gid, origin, want)
+		}
+	}
+
+	if err = tt.Subset([]int{0, 1, 2}); err != nil {
+		t.Fatal(err)
+	}
+	// the vertical tables are part of the subset
+	var buf bytes.Buffer
+	if err = tt.WriteSubset(&buf); err != nil {
+		t.Fatal(err)
+	}
+	subset, err := Open(bytes.NewReader(buf.Bytes()), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tbl := range []string{"maxp", "vhea", "vmtx"} {
+		if err = subset.readTable(tbl); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got, want := subset.Vhea.NumOfLongVerMetrics, tt.Maxp.NumGlyphs; got != want {
+		t.Errorf("NumOfLongVerMetrics of the subset = %d, want %d", got, want)
+	}
+	if got, _ := subset.GlyphVerticalAdvance(1); got != 1024 {
+		t.Errorf("GlyphVerticalAdvance(1) of the subset = %d, want 1024", got)
+	}
+
+	// VORG in CFF fonts
+	var vorgData bytes.Buffer
+	binary.Write(&vorgData, binary.BigEndian, []int16{1, 0, 880, 2, 1, 900, 3, 700})
+	sfnt = addTables(t, "customfont.otf", map[string][]byte{"VORG": vorgData.Bytes()})
+	if tt, err = Open(bytes.NewReader(sfnt), 0); err != nil {
+		t.Fatal(err)
+	}
+	if err = tt.ReadTables(); err != nil {
+		t.Fatal(err)
+	}
+	if err = tt.Subset([]int{0, 1, 2}); err != nil {
+		t.Fatal(err)
+	}
+	buf.Reset()
+	if err = tt.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if tt, err = Open(bytes.NewReader(buf.Bytes()), 0); err != nil {
+		t.Fatal(err)
+	}
+	if err = tt.ReadTables(); err != nil {
+		t.Fatal(err)
+	}
+	for gid, want := range []int{880, 900, 880} {
+		if got, _ := tt.GlyphVerticalOrigin(gid); got != want {
+			t.Errorf("GlyphVerticalOrigin(%d) = %d, want %d", gid, got, want)
+		}
+	}
+	if got, want := len(tt.vorg.vertOriginY), 1; got != want {
+		t.Errorf("VORG entries after subsetting = %d, want %d", got, want)
+	}
+}
+
+func TestVerticalTableErrors(t *testing.T) {
+	// more long metrics than glyphs
+	var vhea bytes.Buffer
+	binary.Write(&vhea, binary.BigEndian, uint32(0x00011000))
+	binary.Write(&vhea, binary.BigEndian, []int16{880, -120, 0, 1024, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 900})
+	sfnt := addTables(t, "CrimsonPro-Regular.ttf", map[string][]byte{"vhea": vhea.Bytes(), "vmtx": make([]byte, 4*900)})
+	tt, err := Open(bytes.NewReader(sfnt), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = tt.ReadTables(); err != nil {
+		t.Fatalf("ReadTables() = %s, want nil for a corrupt vmtx table", err)
+	}
+	if tt.TableErrors["vmtx"] == nil {
+		t.Errorf(`TableErrors["vmtx"] = nil, want an error`)
+	}
+	if got, want := len(tt.TableErrors), 1; got != want {
+		t.Errorf("len(TableErrors) = %d, want %d", got, want)
+	}
+	want := int(tt.Hhea.Ascender) - int(tt.Hhea.Descender)
+	if got, err := tt.GlyphVerticalAdvance(1); err != nil || got != want {
+		t.Errorf("GlyphVerticalAdvance(1) = %d, %v, want %d", got, err, want)
+	}
+	if err = tt.Subset([]int{0, 1, 2}); err != nil {
+		t.Fatal(err)
+	}
+	for name, write := range map[string]func(*Font, io.Writer) error{"WriteSubset": (*Font).WriteSubset, "Write": (*Font).Write} {
+		var buf bytes.Buffer
+		if err = write(tt, &buf); err != nil {
+			t.Fatalf("%s() = %s", name, err)
+		}
+		subset, err := Open(bytes.NewReader(buf.Bytes()), 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, tbl := range []string{"vhea", "vmtx"} {
+			if _, ok := subset.tables[tbl]; ok {
+				t.Errorf("%s(): the subset has a %s table", name, tbl)
+			}
+		}
+	}
+
+	// a VORG table with an unknown version
+	sfnt = addTables(t, "customfont.otf", map[string][]byte{"VORG": {0, 2, 0, 0, 3, 112, 0, 0}})
+	if tt, err = Open(bytes.NewReader(sfnt), 0); err != nil {
+		t.Fatal(err)
+	}
+	if err = tt.ReadTables(); err != nil {
+		t.Fatalf("ReadTables() = %s, want nil for a corrupt VORG table", err)
+	}
+	if tt.TableErrors["VORG"] == nil || tt.vorg != nil {
+		t.Errorf(`TableErrors["VORG"] = %v, want an error`, tt.TableErrors["VORG"])
+	}
+	if err = tt.Subset([]int{0, 1, 2}); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err = tt.Write(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if tt, err = Open(bytes.NewReader(buf.Bytes()), 0); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := tt.tables["VORG"]; ok {
+		t.Errorf("Write(): the subset has a VORG table")
+	}
+}
+
+func TestWidths2(t *testing.T) {
+	tt := &Font{
+		UnitsPerEM:       1000,
+		advanceWidth:     []uint16{600, 600, 600, 600, 600, 600},
+		advanceHeight:    []uint16{1000, 1000, 1000, 1000, 500, 1000},
+		tsb:              make([]int16, 6),
+		vorg:             &vorg{defaultVertOriginY: 880, vertOriginY: map[int]int16{3: 900}},
+		subsetCodepoints: []int{0, 1, 2, 3, 4, 5},
+	}
+	w2, dw2 := tt.Widths2()
+	if got, want := w2, "[3 [-1000 300 900 -500 300 880]]"; got != want {
+		t.Errorf("Widths2() w2 = %s, want %s", got, want)
+	}
+	if got, want := dw2, "[880 -1000]"; got != want {
+		t.Errorf("Widths2() dw2 = %s, want %s", got, want)
+	}
+}
+
+func TestEmbeddingPermissions(t *testing.T) {
+	data := []struct {
+		fsType uint16
+		want   string
+	}{
+		{0x0000, "installable"},
+		{0x0001, "installable"},
+		{0x0002, "restricted"},
+		{0x0003, "restricted"},
+		{0x0004, "preview & print"},
+		{0x0008, "editable"},
+		{0x000c, "editable"},
+		{0x0304, "preview & print, no subsetting, bitmap only"},
+	}
+	tt := &Font{}
+	for _, d := range data {
+		tt.OS2.FsType = d.fsType
+		if got := tt.EmbeddingPermissions().String(); got != d.want {
+			t.Errorf("EmbeddingPermissions() of 0x%04X = %q, want %q", d.fsType, got, d.want)
+		}
+	}
+
+	f, err := os.Open(filepath.Join("testdata", "CrimsonPro-Regular.ttf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	font, err := Open(f, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = font.ReadTables(); err != nil {
+		t.Fatal(err)
+	}
+	// the policy is not enforced by default
+	font.OS2.FsType = 0x0100
+	if _, err = font.SubsetCompact([]int{0, 1}); err != nil {
+		t.Errorf("SubsetCompact() without a policy: %s", err)
+	}
+	font.EmbeddingPolicy = EmbeddingEnforce
+	err = font.Subset([]int{0, 1})
+	ee, ok := err.(*EmbeddingError)
+	if !ok {
+		t.Fatalf("Subset() error = %v, want an *EmbeddingError", err)
+	}
+	if got, want := ee.Error(), "font CrimsonPro-Regular must not be subset (fsType 0x0100: installable, no subsetting)"; got != want {
+		t.Errorf("Subset() error = %q, want %q", got, want)
+	}
+	var buf bytes.Buffer
+	if _, ok = font.WriteSubset(&buf).(*EmbeddingError); !ok {
+		t.Errorf("WriteSubset() of a subset font with no subsetting should fail")
+	}
+	font.OS2.FsType = 0x0004
+	if err = font.WriteSubset(&buf); err != nil {
+		t.Errorf("WriteSubset() of a preview & print font: %s", err)
+	}
+	font.OS2.FsType = 0x0002
+	err = font.WriteSubset(&buf)
+	if ee, ok = err.(*EmbeddingError); !ok || ee.Operation != "embed" || !ee.Permissions.Restricted {
+		t.Errorf("WriteSubset() of a restricted font: error = %v", err)
+	}
+	writers := map[string]func(*Font, io.Writer) error{
+		"Write":      (*Font).Write,
+		"WriteWOFF":  (*Font).WriteWOFF,
+		"WriteWOFF2": (*Font).WriteWOFF2,
+	}
+	for name, write := range writers {
+		for _, fsType := range []uint16{0x0002, 0x0200} {
+			font.OS2.FsType = fsType
+			err = write(font, &buf)
+			if ee, ok = err.(*EmbeddingError); !ok || ee.Operation != "embed" {
+				t.Errorf("%s() with fsType 0x%04X: error = %v", name, fsType, err)
+			}
+		}
+	}
+}
+
+func TestGSUB(t *testing.T) {
+	tt, err := LoadFace(filepath.Join("testdata", "CrimsonPro-Regular.ttf"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = tt.ReadTables(); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := strings.Join(tt.GSUB.FeatureTags(), " "), "aalt case ccmp dlig dnom frac liga lnum locl numr onum ordn pnum sinf subs sups tnum"; got != want {
+		t.Errorf("FeatureTags() = %s, want %s", got, want)
+	}
+	if got, want := fmt.Sprint(tt.GSUB.LookupIndexes("latn", "TRK", []string{"liga", "onum", "smcp"})), "[39 42]"; got != want {
+		t.Errorf("LookupIndexes() = %s, want %s", got, want)
+	}
+	liga, ok := tt.GSUB.Lookups[42].Subtables[0].(*LigatureSubst)
+	if !ok {
+		t.Fatalf("lookup 42 is a %T, want *LigatureSubst", tt.GSUB.Lookups[42].Subtables[0])
+	}
+	// f i -> fi, f l -> fl
+	if got, want := fmt.Sprint(liga.Ligatures[tt.ToCodepoint['f']]), "[{478 [317]} {481 [340]}]"; got != want {
+		t.Errorf("ligatures of f = %s, want %s", got, want)
+	}
+	if _, ok = tt.GSUB.Lookups[2].Subtables[0].(*ChainedSequenceContext); !ok {
+		t.Errorf("lookup 2 is a %T, want *ChainedSequenceContext", tt.GSUB.Lookups[2].Subtables[0])
+	}
+
+	// an extension lookup with a single substitution and a multiple
+	// substitution
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.BigEndian, []uint16{
+		1, 0, 10, 30, 46, // header
+		1, 0x4446, 0x4c54, 8, 4, 0, 0, 0xffff, 1, 0, // script list
+		1, 0x7465, 0x7374, 8, 0, 2, 0, 1, // feature list
+		2, 6, 36, // lookup list
+		GSUBExtension, 0, 1, 8, 1, GSUBSingle, 0, 8, 1, 6, 10, 1, 2, 3, 5,
+		GSUBMultiple, 0, 1, 8, 1, 8, 1, 14, 1, 1, 7, 2, 8, 9,
+	})
+	gsub, err := parseLayoutTable(buf.Bytes(), GSUBExtension, parseGSUBSubtable)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := fmt.Sprint(gsub.LookupIndexes("latn", "", []string{"test"})), "[0 1]"; got != want {
+		t.Errorf("LookupIndexes() = %s, want %s", got, want)
+	}
+	if got, want := gsub.Lookups[0].Type, GSUBSingle; got != want {
+		t.Errorf("type of the extension lookup = %d, want %d", got, want)
+	}
+	if got, want := fmt.Sprint(gsub.Lookups[0].Subtables[0].(*SingleSubst).Substitutes), "map[3:13 5:15]"; got != want {
+		t.Errorf("single substitutes = %s, want %s", got, want)
+	}
+	if got, want := fmt.Sprint(gsub.Lookups[1].Subtables[0].(*MultipleSubst).Sequences), "map[7:[8 9]]"; got != want {
+		t.Errorf("multiple substitution sequences = %s, want %s", got, want)
+	}
+	if _, err = parseLayoutTable(buf.Bytes()[:100], GSUBExtension, parseGSUBSubtable); err == nil {
+		t.Errorf("parseLayoutTable() of a truncated table should fail")
+	}
+}
+
+// TestGSUBSubtables parses subtables from their binary form. Glyph 10 is the
+// covered glyph, offsets are relative to the start of the subtable or of the
+// rule set.
+func TestGSUBSubtables(t *testing.T) {
+	testdata := []struct {
+		name       string
+		lookupType int
+		data       []uint16
+		want       string
+	}{
+		{"alternate", GSUBAlternate,
+			[]uint16{1, 14, 1, 8, 2, 20, 21, 1, 1, 10},
+			"&{Alternates:map[10:[20 21]]}"},
+		{"context format 1", GSUBContext,
+			[]uint16{1, 22, 1, 8, 1, 4, 2, 1, 11, 0, 3, 1, 1, 10},
+			"&{Format:1 Coverage:map[10:0] RuleSets:[[{Input:[11] Lookups:[{SequenceIndex:0 LookupIndex:3}]}]] ClassDef:map[] InputCoverages:[] Lookups:[]}"},
+		{"context format 2", GSUBContext,
+			[]uint16{2, 26, 32, 2, 0, 12, 1, 4, 2, 1, 2, 1, 4, 1, 1, 10, 1, 10, 2, 1, 2},
+			"&{Format:2 Coverage:map[10:0] RuleSets:[[] [{Input:[2] Lookups:[{SequenceIndex:1 LookupIndex:4}]}]] ClassDef:map[10:1 11:2] InputCoverages:[] Lookups:[]}"},
+		{"context format 3", GSUBContext,
+			[]uint16{3, 2, 1, 14, 20, 0, 5, 1, 1, 10, 2, 1, 11, 13, 0},
+			"&{Format:3 Coverage:map[] RuleSets:[] ClassDef:map[] InputCoverages:[map[10:0] map[11:0 12:1 13:2]] Lookups:[{SequenceIndex:0 LookupIndex:5}]}"},
+		{"chained context format 1", GSUBChainedContext,
+			[]uint16{1, 30, 1, 8, 1, 4, 1, 9, 2, 11, 1, 12, 1, 1, 6, 1, 1, 10},
+			"&{Format:1 Coverage:map[10:0] RuleSets:[[{Backtrack:[9] Input:[11] Lookahead:[12] Lookups:[{SequenceIndex:1 LookupIndex:6}]}]] BacktrackClassDef:map[] InputClassDef:map[] LookaheadClassDef:map[] BacktrackCoverages:[] InputCoverages:[] LookaheadCoverages:[] Lookups:[]}"},
+		{"chained context format 2", GSUBChainedContext,
+			[]uint16{2, 34, 40, 48, 0, 2, 0, 16, 1, 4, 1, 3, 1, 0, 1, 0, 7, 1, 1, 10, 1, 9, 1, 3, 1, 10, 1, 1},
+			"&{Format:2 Coverage:map[10:0] RuleSets:[[] [{Backtrack:[3] Input:[] Lookahead:[] Lookups:[{SequenceIndex:0 LookupIndex:7}]}]] BacktrackClassDef:map[9:3] InputClassDef:map[10:1] LookaheadClassDef:map[] BacktrackCoverages:[] InputCoverages:[] LookaheadCoverages:[] Lookups:[]}"},
+		{"reverse chaining", GSUBReverseChainedContext,
+			[]uint16{1, 18, 1, 26, 1, 32, 2, 30, 31, 1, 2, 10, 11, 1, 1, 9, 1, 1, 12},
+			"&{Coverage:map[10:0 11:1] BacktrackCoverages:[map[9:0]] LookaheadCoverages:[map[12:0]] Substitutes:map[10:30 11:31]}"},
+	}
+	for _, td := range testdata {
+		var buf bytes.Buffer
+		binary.Write(&buf, binary.BigEndian, td.data)
+		p := &layoutParser{data: buf.Bytes()}
+		st := parseGSUBSubtable(p, td.lookupType, 0)
+		if p.err != nil {
+			t.Errorf("%s: %s", td.name, p.err)
+			continue
+		}
+		if got := fmt.Sprintf("%+v", st); got != td.want {
+			t.Errorf("%s: subtable = %s, want %s", td.name, got, td.want)
+		}
+		// the subtable without its last word is corrupt
+		p = &layoutParser{data: buf.Bytes()[:buf.Len()-2]}
+		if parseGSUBSubtable(p, td.lookupType, 0); p.err == nil {
+			t.Errorf("%s: no error for a truncated subtable", td.name)
+		}
+	}
+}
+
+func TestGPOS(t *testing.T) {
+	tt, err := LoadFace(filepath.Join("testdata", "CrimsonPro-Regular.ttf"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = tt.ReadTables(); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := strings.Join(tt.GPOS.FeatureTags(), " "), "kern mark mkmk"; got != want {
+		t.Errorf("FeatureTags() = %s, want %s", got, want)
+	}
+	kern := tt.GPOS.Lookups[0]
+	if got, want := kern.Flag, uint16(LookupIgnoreMarks); got != want {
+		t.Errorf("flag of the kern lookup = %x, want %x", got, want)
+	}
+	// the second subtable has the class based kerning
+	pp := kern.Subtables[1].(*PairPos)
+	pv, ok := pp.Lookup(tt.ToCodepoint['T'], tt.ToCodepoint['o'])
+	if got, want := pv.First.XAdvance, -40; !ok || got != want {
+		t.Errorf("kerning of T o = %d (%t), want %d", got, ok, want)
+	}
+	if got, want := fmt.Sprint(pp.ValueFormat1, pp.ValueFormat2), "4 0"; got != want {
+		t.Errorf("value formats of the kern subtable = %s, want %s", got, want)
+	}
+	mb := tt.GPOS.Lookups[1].Subtables[0].(*MarkBasePos)
+	mark := mb.Marks[tt.ToCodepoint[0x301]]
+	if got, want := fmt.Sprint(mark.Anchor.X, mark.Anchor.Y, *mb.Bases[tt.ToCodepoint['o']][mark.Class]), "300 430 {254 430 -1 <nil> <nil>}"; got != want {
+		t.Errorf("anchors of o and acute = %s, want %s", got, want)
+	}
+	if _, ok = tt.GPOS.Lookups[2].Subtables[0].(*MarkLigPos); !ok {
+		t.Errorf("lookup 2 is a %T, want *MarkLigPos", tt.GPOS.Lookups[2].Subtables[0])
+	}
+
+	// value record with an x advance and an x advance device table of
+	// format 1 and a device table of format 3
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.BigEndian, []uint16{0xfff6, 4, 11, 15, 1, 0x7240, 9, 10, 3, 0xfd04})
+	p := &layoutParser{data: buf.Bytes()}
+	vr, next := p.valueRecord(0, 0, 0x0044)
+	if got, want := fmt.Sprint(vr.XAdvance, vr.XAdvDevice.Deltas, vr.XAdvDevice.Delta(14), next), "-10 [1 -1 0 -2 1] -2 4"; got != want {
+		t.Errorf("valueRecord() = %s, want %s", got, want)
+	}
+	if got, want := fmt.Sprint(p.device(12).Deltas), "[-3 4]"; got != want {
+		t.Errorf("device() = %s, want %s", got, want)
+	}
+	if p.err != nil {
+		t.Error(p.err)
+	}
+}
+
+func TestLayoutTableErrors(t *testing.T) {
+	// a GSUB table with a script list outside of the table and a kern table
+	// with a truncated subtable
+	sfnt := addTables(t, "CrimsonPro-Regular.ttf", map[string][]byte{
+		"GSUB": {0, 1, 0, 0, 0x10, 0, 0, 10, 0, 10},
+		"kern": {0, 0, 0, 1, 0, 0, 0, 50, 0, 1},
+	})
+	tt, err := Open(bytes.NewReader(sfnt), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = tt.ReadTables(); err != nil {
+		t.Fatalf("ReadTables() = %s, want nil for corrupt layout tables", err)
+	}
+	if tt.GSUB != nil || tt.kern != nil {
+		t.Errorf("the corrupt tables GSUB and kern are not nil")
+	}
+	if tt.GPOS == nil || tt.GDEF == nil {
+		t.Errorf("the tables GPOS and GDEF are nil")
+	}
+	for _, tbl := range []string{"GSUB", "kern"} {
+		if tt.TableErrors[tbl] == nil {
+			t.Errorf("TableErrors[%q] = nil, want an error", tbl)
+		}
+	}
+	if got, want := len(tt.TableErrors), 2; got != want {
+		t.Errorf("len(TableErrors) = %d, want %d", got, want)
+	}
+	if err = tt.Subset([]int{0, 76}); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err = tt.WriteSubset(&buf); err != nil {
+		t.Errorf("WriteSubset() = %s", err)
+	}
+}
+
+func TestKern(t *testing.T) {
+	// Microsoft kern table, the second subtable overrides the first one
+	var ms bytes.Buffer
+	binary.Write(&ms, binary.BigEndian, []int16{
+		0, 2,
+		0, 26, 0x0001, 2, 0, 0, 0, 3, 4, -50, 3, 5, -20,
+		0, 20, 0x0009, 1, 0, 0, 0, 3, 5, -30,
+	})
+	sfnt := addTables(t, "CrimsonPro-Regular.ttf", map[string][]byte{"kern": ms.Bytes()})
+	tt, err := Open(bytes.NewReader(sfnt), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = tt.ReadTables(); err != nil {
+		t.Fatal(err)
+	}
+	for _, d := range [][3]int{{3, 4, -50}, {3, 5, -30}, {4, 3, 0}} {
+		if got, want := tt.Kern(d[0], d[1]), d[2]; got != want {
+			t.Errorf("Kern(%d, %d) = %d, want %d", d[0], d[1], got, want)
+		}
+	}
+
+	// Apple kern table with a format 2 subtable
+	var apple bytes.Buffer
+	binary.Write(&apple, binary.BigEndian, []int16{
+		1, 0, 0, 1,
+		0, 40, 0x0002, 0, 4, 16, 24, 32,
+		10, 2, 32, 36, // left classes
+		20, 2, 0, 2, // right classes
+		0, -15, -25, 0,
+	})
+	if tt.kern, err = parseKern(apple.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	for _, d := range [][3]int{{10, 21, -15}, {11, 20, -25}, {10, 20, 0}, {12, 20, 0}} {
+		if got, want := tt.Kern(d[0], d[1]), d[2]; got != want {
+			t.Errorf("Kern(%d, %d) = %d, want %d", d[0], d[1], got, want)
+		}
+	}
+	if _, err = parseKern(apple.Bytes()[:30]); err == nil {
+		t.Errorf("parseKern() of a truncated table should fail")
+	}
+}
@@ -33,20 +33,40 @@ type tableOffsetLength struct {
 	tabledata []byte
 }
 
+// nameRecord is a record of the name table with the undecoded string.
+type nameRecord struct {
+	platformID uint16
+	encodingID uint16
+	languageID uint16
+	nameID     uint16
+	data       []byte
+}
+
 // Glyph is a TrueType glyph. Since we are not interested in the glyph details,
 // only the whole data is stored here
 type Glyph []byte
 
+// Path is a glyph outline. TrueType and CFF outlines share this type, see
+// the cff package for the segment types.
+type Path = cff.Path
+
+// Rect is a rectangle in font units, for example the bounding box of a glyph.
+type Rect = cff.Rect
+
 // Font represents the font file for a TrueType font
 type Font struct {
 	r                   io.ReadSeeker
 	IsCFF               bool
+	IsCollection        bool // true if the font is a face in a TrueType or OpenType collection
 	fontindex           int
+	faceOffset          int64 // start of the table directory
 	sfntVersion         uint32
 	tables              map[string]tableOffsetLength
 	tablesRead          map[string]bool // list of tables that have been read
 	GlyphNames          []string
 	names               map[int]string
+	nameRecords         []nameRecord
+	nameLangTags        [][]byte
 	FontName            string // PostScript name for the font. Set after names table has been read or within a CFF font
 	glyphOffsets        []uint32
 	advanceWidth        []uint16
@@ -54,18 +74,30 @@ type Font struct {
 	fpgm                []byte
 	cvt                 []byte
 	prep                []byte
+	postData            []byte // version 2.5 and 4 data of the post table
 	UnitsPerEM          uint16
 	ToUni               map[int]rune // glyph id to unicode value
 	ToCodepoint         map[rune]int
+	cmapVariations      []byte // format 14 cmap subtable
 	subsetCodepoints    []int
 	Hhea                Hhea
+	Vhea                Vhea
+	advanceHeight       []uint16 // from vmtx, one entry per glyph
+	tsb                 []int16  // top side bearings from vmtx
+	vorg                *vorg
+	kern                []kernSubtable
 	Head                Head
 	Maxp                Maxp
 	Post                Post
 	OS2                 OS2
 	OS2AdditionalFields OS2AdditionalFields
 	Glyph               []Glyph
+	GSUB                *LayoutTable     // nil if the font has no GSUB table, glyph ids are not changed by SubsetCompact
+	GPOS                *LayoutTable     // nil if the font has no GPOS table, glyph ids are not changed by SubsetCompact
+	GDEF                *GDEF            // nil if the font has no GDEF table, glyph ids are not changed by SubsetCompact
+	TableErrors         map[string]error // errors of the optional tables vhea, vmtx, VORG, GDEF, GSUB, GPOS and kern, these tables are left out
 	SubsetID            string
+	EmbeddingPolicy     EmbeddingPolicy // checked by Subset, SubsetCompact, WriteSubset, Write, WriteWOFF and WriteWOFF2
 	CFF                 *cff.CFF
 }
 
@@ -87,6 +119,23 @@ type Hhea struct {
 	NumberOfHMetrics    uint16
 }
 
+// Vhea Vertical Header Table.
+type Vhea struct {
+	Version              uint32 // 0x00010000 or 0x00011000
+	VertTypoAscender     int16
+	VertTypoDescender    int16
+	VertTypoLineGap      int16
+	AdvanceHeightMax     uint16
+	MinTopSideBearing    int16
+	MinBottomSideBearing int16
+	YMaxExtent           int16
+	CaretSlopeRise       int16
+	CaretSlopeRun        int16
+	CaretOffset          int16
+	MetricDataFormat     int16
+	NumOfLongVerMetrics  uint16
+}
+
 // Head Font header
 type Head struct {
 	MajorVersion       uint16 // 1
@@ -98,10 +147,10 @@ type Head struct {
 	UnitsPerEm         uint16
 	Created            uint64
 	Modified           uint64
-	XMin               uint16
-	YMin               uint16
-	XMax               uint16
-	YMax               uint16
+	XMin               int16
+	YMin               int16
+	XMax               int16
+	YMax               int16
 	MacStyle           uint16
 	LowestRecPPEM      uint16
 	FontDirectionHint  int16
@@ -0,0 +1,275 @@
+package opentype
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+)
+
+// vorg has the vertical origins of the VORG table of CFF fonts.
+type vorg struct {
+	defaultVertOriginY int16
+	vertOriginY        map[int]int16
+}
+
+// verticalTables are read by ReadTables if the font has them. Errors in these
+// tables do not stop reading the font, see Font.TableErrors.
+var verticalTables = []string{"vhea", "vmtx", "VORG"}
+
+func (tt *Font) readVhea(tbl tableOffsetLength) error {
+	vhea := Vhea{}
+	var reserved int16
+	tt.read(&vhea.Version)
+	tt.read(&vhea.VertTypoAscender)
+	tt.read(&vhea.VertTypoDescender)
+	tt.read(&vhea.VertTypoLineGap)
+	tt.read(&vhea.AdvanceHeightMax)
+	tt.read(&vhea.MinTopSideBearing)
+	tt.read(&vhea.MinBottomSideBearing)
+	tt.read(&vhea.YMaxExtent)
+	tt.read(&vhea.CaretSlopeRise)
+	tt.read(&vhea.CaretSlopeRun)
+	tt.read(&vhea.CaretOffset)
+	for i := 0; i < 4; i++ {
+		tt.read(&reserved)
+	}
+	tt.read(&vhea.MetricDataFormat)
+	tt.read(&vhea.NumOfLongVerMetrics)
+	tt.Vhea = vhea
+	return nil
+}
+
+func (tt *Font) writeVhea(w io.Writer) error {
+	tbl := tt.Vhea
+	var reserved int16
+	tt.write(w, tbl.Version)
+	tt.write(w, tbl.VertTypoAscender)
+	tt.write(w, tbl.VertTypoDescender)
+	tt.write(w, tbl.VertTypoLineGap)
+	tt.write(w, tbl.AdvanceHeightMax)
+	tt.write(w, tbl.MinTopSideBearing)
+	tt.write(w, tbl.MinBottomSideBearing)
+	tt.write(w, tbl.YMaxExtent)
+	tt.write(w, tbl.CaretSlopeRise)
+	tt.write(w, tbl.CaretSlopeRun)
+	tt.write(w, tbl.CaretOffset)
+	for i := 0; i < 4; i++ {
+		tt.write(w, reserved)
+	}
+	tt.write(w, tbl.MetricDataFormat)
+	tt.write(w, tbl.NumOfLongVerMetrics)
+	return nil
+}
+
+// readVmtx reads the vertical metrics. The vhea and maxp tables must be read
+// before.
+func (tt *Font) readVmtx(tbl tableOffsetLength) error {
+	numMetrics := int(tt.Vhea.NumOfLongVerMetrics)
+	numGlyphs := int(tt.Maxp.NumGlyphs)
+	if numMetrics == 0 || numMetrics > numGlyphs {
+		return fmt.Errorf("vmtx: invalid number of metrics %d", numMetrics)
+	}
+	tt.advanceHeight = make([]uint16, numGlyphs)
+	tt.tsb = make([]int16, numGlyphs)
+	for i := 0; i < numMetrics; i++ {
+		tt.read(&tt.advanceHeight[i])
+		tt.read(&tt.tsb[i])
+	}
+	// the remaining glyphs have the same advance height as the last one
+	for i := numMetrics; i < numGlyphs; i++ {
+		tt.read(&tt.tsb[i])
+		tt.advanceHeight[i] = tt.advanceHeight[numMetrics-1]
+	}
+	return nil
+}
+
+func (tt *Font) writeVmtx(w io.Writer) error {
+	l := int(tt.Vhea.NumOfLongVerMetrics)
+	for i := 0; i < l; i++ {
+		tt.write(w, tt.advanceHeight[i])
+		tt.write(w, tt.tsb[i])
+	}
+	for i := l; i < len(tt.tsb); i++ {
+		tt.write(w, tt.tsb[i])
+	}
+	return nil
+}
+
+func (tt *Font) readVORG(tbl tableOffsetLength) error {
+	var majorVersion, minorVersion, numVertOriginYMetrics uint16
+	v := &vorg{}
+	tt.read(&majorVersion)
+	tt.read(&minorVersion)
+	if majorVersion != 1 {
+		return fmt.Errorf("VORG: unknown version %d.%d", majorVersion, minorVersion)
+	}
+	tt.read(&v.defaultVertOriginY)
+	tt.read(&numVertOriginYMetrics)
+	v.vertOriginY = make(map[int]int16, numVertOriginYMetrics)
+	for i := 0; i < int(numVertOriginYMetrics); i++ {
+		var glyphIndex uint16
+		var vertOriginY int16
+		tt.read(&glyphIndex)
+		tt.read(&vertOriginY)
+		v.vertOriginY[int(glyphIndex)] = vertOriginY
+	}
+	tt.vorg = v
+	return nil
+}
+
+func (tt *Font) writeVORG(w io.Writer) error {
+	gids := make([]int, 0, len(tt.vorg.vertOriginY))
+	for gid := range tt.vorg.vertOriginY {
+		gids = append(gids, gid)
+	}
+	sort.Ints(gids)
+	tt.write(w, uint16(1))
+	tt.write(w, uint16(0))
+	tt.write(w, tt.vorg.defaultVertOriginY)
+	tt.write(w, uint16(len(gids)))
+	for _, gid := range gids {
+		tt.write(w, uint16(gid))
+		tt.write(w, tt.vorg.vertOriginY[gid])
+	}
+	return nil
+}
+
+// remapVerticalMetrics changes the vertical metrics for a subset. oldIDs has
+// the old glyph id for each glyph of the subset or -1 if the glyph is removed.
+func (tt *Font) remapVerticalMetrics(oldIDs []int) {
+	if tt.advanceHeight != nil {
+		advanceHeight := make([]uint16, len(oldIDs))
+		tsb := make([]int16, len(oldIDs))
+		for newID, oldID := range oldIDs {
+			if oldID >= 0 && oldID < len(tt.advanceHeight) {
+				advanceHeight[newID] = tt.advanceHeight[oldID]
+				tsb[newID] = tt.tsb[oldID]
+			}
+		}
+		tt.advanceHeight = advanceHeight
+		tt.tsb = tsb
+		tt.Vhea.NumOfLongVerMetrics = uint16(len(oldIDs))
+	}
+	if tt.vorg != nil {
+		vertOriginY := make(map[int]int16)
+		for newID, oldID := range oldIDs {
+			if y, ok := tt.vorg.vertOriginY[oldID]; ok && oldID >= 0 {
+				vertOriginY[newID] = y
+			}
+		}
+		tt.vorg.vertOriginY = vertOriginY
+	}
+}
+
+// GlyphVerticalAdvance returns the vertical advance of the glyph in font
+// units. Without vertical metrics the advance is the distance between the
+// ascender and the descender.
+func (tt *Font) GlyphVerticalAdvance(gid int) (int, error) {
+	if tt.advanceHeight == nil {
+		return int(tt.Hhea.Ascender) - int(tt.Hhea.Descender), nil
+	}
+	if gid < 0 || gid >= len(tt.advanceHeight) {
+		return 0, fmt.Errorf("glyph %d does not exist", gid)
+	}
+	return int(tt.advanceHeight[gid]), nil
+}
+
+// GlyphVerticalOrigin returns the y coordinate of the vertical origin of the
+// glyph in font units. The origin is taken from the VORG table or calculated
+// from the top side bearing and the glyph bounding box. Without vertical
+// metrics the origin is at the ascender.
+func (tt *Font) GlyphVerticalOrigin(gid int) (int, error) {
+	if tt.vorg != nil {
+		if y, ok := tt.vorg.vertOriginY[gid]; ok {
+			return int(y), nil
+		}
+		return int(tt.vorg.defaultVertOriginY), nil
+	}
+	if tt.tsb == nil {
+		return int(tt.Hhea.Ascender), nil
+	}
+	if gid < 0 || gid >= len(tt.tsb) {
+		return 0, fmt.Errorf("glyph %d does not exist", gid)
+	}
+	var yMax int
+	if !tt.IsCFF && gid < len(tt.Glyph) {
+		g := tt.Glyph[gid]
+		if len(g) < 10 {
+			return int(tt.Hhea.Ascender), nil
+		}
+		yMax = int(int16(g[8])<<8 | int16(g[9]))
+	} else {
+		path, err := tt.GlyphPath(gid)
+		if err != nil {
+			return 0, err
+		}
+		if len(path) == 0 {
+			return int(tt.Hhea.Ascender), nil
+		}
+		yMax = int(math.Ceil(path.Bounds().Max.Y))
+	}
+	return int(tt.tsb[gid]) + yMax, nil
+}
+
+// Widths2 returns the /W2 and the /DW2 arrays of a CIDFont in a PDF file for
+// the glyphs of the subset in vertical writing. The position vector of each
+// glyph is half the horizontal advance and the vertical origin. /DW2 has the
+// most common vertical origin and advance, glyphs with these values are not
+// in /W2. The arrays are keyed by the CIDs of the glyphs (see GlyphCID).
+func (tt *Font) Widths2() (string, string) {
+	return tt.CIDWidths2(nil)
+}
+
+// CIDWidths2 is like Widths2 for a CIDFont with a CIDToGIDMap. cidToGID maps
+// the CIDs to glyph ids of the subset.
+func (tt *Font) CIDWidths2(cidToGID map[int]int) (string, string) {
+	toPDF := func(v int) string {
+		return formatPDFWidth(float64(v) / float64(tt.UnitsPerEM) * 1000)
+	}
+	type metrics struct {
+		vy, w1y string
+	}
+	subsetCIDs := tt.subsetCIDs(cidToGID)
+	cids := make([]int, 0, len(subsetCIDs))
+	glyphMetrics := make(map[int]metrics, len(subsetCIDs))
+	count := make(map[metrics]int)
+	for cid, gid := range subsetCIDs {
+		if cid < 0 || gid < 0 || gid >= len(tt.advanceWidth) {
+			continue
+		}
+		advance, err := tt.GlyphVerticalAdvance(gid)
+		if err != nil {
+			continue
+		}
+		origin, err := tt.GlyphVerticalOrigin(gid)
+		if err != nil {
+			continue
+		}
+		m := metrics{vy: toPDF(origin), w1y: toPDF(-advance)}
+		glyphMetrics[cid] = m
+		count[m]++
+		cids = append(cids, cid)
+	}
+	sort.Ints(cids)
+
+	dw2 := metrics{vy: "880", w1y: "-1000"}
+	maxCount := 0
+	for _, cid := range cids {
+		if m := glyphMetrics[cid]; count[m] > maxCount {
+			dw2, maxCount = m, count[m]
+		}
+	}
+	values := make(map[int]string, len(cids))
+	var w2CIDs []int
+	for _, cid := range cids {
+		m := glyphMetrics[cid]
+		if m == dw2 {
+			continue
+		}
+		vx := formatPDFWidth(float64(tt.advanceWidth[subsetCIDs[cid]]) / float64(tt.UnitsPerEM) * 500)
+		values[cid] = m.w1y + " " + vx + " " + m.vy
+		w2CIDs = append(w2CIDs, cid)
+	}
+	return compactCIDArray(w2CIDs, values), "[" + dw2.vy + " " + dw2.w1y + "]"
+}
@@ -0,0 +1,292 @@
+package opentype
+
+import (
+	"bytes"
+	"compress/zlib"
+	"encoding/binary"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strings"
+)
+
+const magicWOFF = 0x774F4646 // wOFF
+
+// woffHeader is the file header of a WOFF 1.0 file.
+//
+// See https://www.w3.org/TR/WOFF/#WOFFHeader
+type woffHeader struct {
+	Signature      uint32
+	Flavor         uint32
+	Length         uint32
+	NumTables      uint16
+	Reserved       uint16
+	TotalSfntSize  uint32
+	MajorVersion   uint16
+	MinorVersion   uint16
+	MetaOffset     uint32
+	MetaLength     uint32
+	MetaOrigLength uint32
+	PrivOffset     uint32
+	PrivLength     uint32
+}
+
+// woffTableEntry is an entry of the WOFF table directory.
+type woffTableEntry struct {
+	Tag          [4]byte
+	Offset       uint32
+	CompLength   uint32
+	OrigLength   uint32
+	OrigChecksum uint32
+}
+
+// decodeWOFF reads a WOFF 1.0 file from r and returns the uncompressed sfnt
+// data. All tables are decompressed, so the result can be read like an
+// ordinary TrueType or OpenType file.
+func decodeWOFF(r io.ReadSeeker) ([]byte, error) {
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	hdr := woffHeader{}
+	if err := binary.Read(r, binary.BigEndian, &hdr); err != nil {
+		return nil, err
+	}
+	if hdr.Signature != magicWOFF {
+		return nil, fmt.Errorf("not a WOFF file")
+	}
+	size, err := r.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+	if _, err = r.Seek(44, io.SeekStart); err != nil {
+		return nil, err
+	}
+	entries := make([]woffTableEntry, hdr.NumTables)
+	if err := binary.Read(r, binary.BigEndian, entries); err != nil {
+		return nil, err
+	}
+
+	tables := make([]tableOffsetLength, 0, len(entries))
+	sfntSize := uint64(12 + 16*len(entries))
+	for _, e := range entries {
+		// the original lengths must fit into the size of the sfnt file
+		sfntSize += (uint64(e.OrigLength) + 3) &^ 3
+		if sfntSize > uint64(hdr.TotalSfntSize) {
+			return nil, fmt.Errorf("WOFF table %s: tables larger than the sfnt size %d", string(e.Tag[:]), hdr.TotalSfntSize)
+		}
+		if int64(e.Offset)+int64(e.CompLength) > size {
+			return nil, fmt.Errorf("WOFF table %s: table data outside of the file", string(e.Tag[:]))
+		}
+		if _, err := r.Seek(int64(e.Offset), io.SeekStart); err != nil {
+			return nil, err
+		}
+		data := make([]byte, e.CompLength)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, err
+		}
+		switch {
+		case e.CompLength < e.OrigLength:
+			zr, err := zlib.NewReader(bytes.NewReader(data))
+			if err != nil {
+				return nil, err
+			}
+			// read one byte more than expected to detect larger tables
+			if data, err = io.ReadAll(io.LimitReader(zr, int64(e.OrigLength)+1)); err != nil {
+				return nil, err
+			}
+			if err = zr.Close(); err != nil {
+				return nil, err
+			}
+		case e.CompLength > e.OrigLength:
+			return nil, fmt.Errorf("WOFF table %s: compressed length larger than original length", string(e.Tag[:]))
+		}
+		if uint32(len(data)) != e.OrigLength {
+			return nil, fmt.Errorf("WOFF table %s: decompressed length %d, want %d", string(e.Tag[:]), len(data), e.OrigLength)
+		}
+		tables = append(tables, tableOffsetLength{
+			name:      string(e.Tag[:]),
+			length:    e.OrigLength,
+			checksum:  e.OrigChecksum,
+			tabledata: data,
+		})
+	}
+	return buildSfnt(hdr.Flavor, tables), nil
+}
+
+// buildSfnt returns the sfnt file with the given tables. The table data is
+// written unchanged, the checksums are taken from the table entries. Tables
+// are sorted by tag and padded to four bytes.
+func buildSfnt(sfntVersion uint32, tables []tableOffsetLength) []byte {
+	sort.Slice(tables, func(i, j int) bool { return tables[i].name < tables[j].name })
+	var b bytes.Buffer
+	numTables := len(tables)
+	entrySelector := 0
+	if numTables > 0 {
+		entrySelector = int(math.Floor(math.Log2(float64(numTables))))
+	}
+	searchRange := (1 << entrySelector) * 16
+	binary.Write(&b, binary.BigEndian, sfntVersion)
+	binary.Write(&b, binary.BigEndian, uint16(numTables))
+	binary.Write(&b, binary.BigEndian, uint16(searchRange))
+	binary.Write(&b, binary.BigEndian, uint16(entrySelector))
+	binary.Write(&b, binary.BigEndian, uint16(numTables*16-searchRange))
+
+	offset := uint32(12 + 16*numTables)
+	for _, tbl := range tables {
+		b.WriteString(tbl.name)
+		binary.Write(&b, binary.BigEndian, tbl.checksum)
+		binary.Write(&b, binary.BigEndian, offset)
+		binary.Write(&b, binary.BigEndian, uint32(len(tbl.tabledata)))
+		offset += (uint32(len(tbl.tabledata)) + 3) &^ 3
+	}
+	for _, tbl := range tables {
+		b.Write(tbl.tabledata)
+		for i := len(tbl.tabledata); i&3 != 0; i++ {
+			b.WriteByte(0)
+		}
+	}
+	return b.Bytes()
+}
+
+// sfntTables returns the sfnt version and the tables of the sfnt data. The
+// table data refers to sfnt.
+func sfntTables(sfnt []byte) (uint32, []tableOffsetLength) {
+	numTables := int(binary.BigEndian.Uint16(sfnt[4:]))
+	tables := make([]tableOffsetLength, numTables)
+	for i := range tables {
+		entry := sfnt[12+16*i:]
+		tbl := tableOffsetLength{
+			name:     string(entry[:4]),
+			checksum: binary.BigEndian.Uint32(entry[4:]),
+			offset:   binary.BigEndian.Uint32(entry[8:]),
+			length:   binary.BigEndian.Uint32(entry[12:]),
+		}
+		tbl.tabledata = sfnt[tbl.offset : tbl.offset+tbl.length]
+		tables[i] = tbl
+	}
+	return binary.BigEndian.Uint32(sfnt), tables
+}
+
+// woffMetadata returns the extended metadata XML for WOFF and WOFF2 files
+// built from the name table. It returns nil if the font has none of the
+// names used in the metadata.
+//
+// See https://www.w3.org/TR/WOFF/#Metadata
+func (tt *Font) woffMetadata() []byte {
+	if _, ok := tt.tables["name"]; ok && !tt.tablesRead["name"] {
+		if err := tt.readTable("name"); err != nil {
+			return nil
+		}
+	}
+	name := func(id int) string {
+		var b strings.Builder
+		xml.EscapeText(&b, []byte(strings.ToValidUTF8(tt.names[id], "")))
+		return b.String()
+	}
+	attr := func(key string, id int) string {
+		if tt.names[id] == "" {
+			return ""
+		}
+		return fmt.Sprintf(` %s="%s"`, key, name(id))
+	}
+	text := func(element string, id int, attributes string) string {
+		return fmt.Sprintf("\t<%s%s>\n\t\t<text>%s</text>\n\t</%s>\n", element, attributes, name(id), element)
+	}
+	var elements []string
+	if tt.names[3] != "" {
+		elements = append(elements, fmt.Sprintf("\t<uniqueid%s/>\n", attr("id", 3)))
+	}
+	if tt.names[8] != "" {
+		elements = append(elements, fmt.Sprintf("\t<vendor%s%s/>\n", attr("name", 8), attr("url", 11)))
+	}
+	if tt.names[9] != "" {
+		elements = append(elements, fmt.Sprintf("\t<credits>\n\t\t<credit%s%s role=\"Designer\"/>\n\t</credits>\n", attr("name", 9), attr("url", 12)))
+	}
+	if tt.names[10] != "" {
+		elements = append(elements, text("description", 10, ""))
+	}
+	if tt.names[13] != "" {
+		elements = append(elements, text("license", 13, attr("url", 14)))
+	}
+	if tt.names[0] != "" {
+		elements = append(elements, text("copyright", 0, ""))
+	}
+	if tt.names[7] != "" {
+		elements = append(elements, text("trademark", 7, ""))
+	}
+	if len(elements) == 0 {
+		return nil
+	}
+	return []byte("<?xml version=\"1.0\" encoding=\"UTF-8\"?>\n<metadata version=\"1.0\">\n" + strings.Join(elements, "") + "</metadata>\n")
+}
+
+// encodeWOFF returns a WOFF 1.0 file for the sfnt data. The tables are
+// compressed if that makes them smaller. The metadata is optional.
+func encodeWOFF(sfnt []byte, metadata []byte) []byte {
+	flavor, tables := sfntTables(sfnt)
+	sort.Slice(tables, func(i, j int) bool { return tables[i].name < tables[j].name })
+	hdr := woffHeader{
+		Signature:    magicWOFF,
+		Flavor:       flavor,
+		NumTables:    uint16(len(tables)),
+		MajorVersion: 1,
+	}
+	hdr.TotalSfntSize = uint32(12 + 16*len(tables))
+	entries := make([]woffTableEntry, len(tables))
+	var tabledata bytes.Buffer
+	dataOffset := binary.Size(hdr) + binary.Size(entries)
+	for i, tbl := range tables {
+		data := tbl.tabledata
+		var compressed bytes.Buffer
+		zw, _ := zlib.NewWriterLevel(&compressed, zlib.BestCompression)
+		zw.Write(data)
+		zw.Close()
+		if compressed.Len() < len(data) {
+			data = compressed.Bytes()
+		}
+		copy(entries[i].Tag[:], tbl.name)
+		entries[i].Offset = uint32(dataOffset + tabledata.Len())
+		entries[i].CompLength = uint32(len(data))
+		entries[i].OrigLength = tbl.length
+		entries[i].OrigChecksum = tbl.checksum
+		hdr.TotalSfntSize += (tbl.length + 3) &^ 3
+		tabledata.Write(data)
+		for tabledata.Len()%4 != 0 {
+			tabledata.WriteByte(0)
+		}
+	}
+	if metadata != nil {
+		var compressed bytes.Buffer
+		zw, _ := zlib.NewWriterLevel(&compressed, zlib.BestCompression)
+		zw.Write(metadata)
+		zw.Close()
+		hdr.MetaOffset = uint32(dataOffset + tabledata.Len())
+		hdr.MetaLength = uint32(compressed.Len())
+		hdr.MetaOrigLength = uint32(len(metadata))
+		tabledata.Write(compressed.Bytes())
+	}
+	hdr.Length = uint32(dataOffset + tabledata.Len())
+
+	var b bytes.Buffer
+	binary.Write(&b, binary.BigEndian, hdr)
+	binary.Write(&b, binary.BigEndian, entries)
+	b.Write(tabledata.Bytes())
+	return b.Bytes()
+}
+
+// WriteWOFF writes the font as a WOFF 1.0 file to w. If the font has been
+// subsetted, only the glyphs of the subset are included. The extended
+// metadata is created from the name table.
+func (tt *Font) WriteWOFF(w io.Writer) error {
+	if err := tt.checkEmbedding("embed"); err != nil {
+		return err
+	}
+	sfnt, err := tt.fontData()
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(encodeWOFF(sfnt, tt.woffMetadata()))
+	return err
+}
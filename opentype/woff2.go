@@ -0,0 +1,1216 @@
+package opentype
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+
+	"github.com/speedata/gootf/internal/brotli"
+)
+
+const magicWOFF2 = 0x774F4632 // wOF2
+
+// woff2KnownTags are the table tags that can be encoded in the flags of a
+// WOFF2 table directory entry.
+//
+// See https://www.w3.org/TR/WOFF2/#table_dir_format
+var woff2KnownTags = [63]string{
+	"cmap", "head", "hhea", "hmtx", "maxp", "name", "OS/2", "post", "cvt ",
+	"fpgm", "glyf", "loca", "prep", "CFF ", "VORG", "EBDT", "EBLC", "gasp",
+	"hdmx", "kern", "LTSH", "PCLT", "VDMX", "vhea", "vmtx", "BASE", "GDEF",
+	"GPOS", "GSUB", "EBSC", "JSTF", "MATH", "CBDT", "CBLC", "COLR", "CPAL",
+	"SVG ", "sbix", "acnt", "avar", "bdat", "bloc", "bsln", "cvar", "fdsc",
+	"feat", "fmtx", "fvar", "gvar", "hsty", "just", "lcar", "mort", "morx",
+	"opbd", "prop", "trak", "Zapf", "Silf", "Glat", "Gloc", "Feat", "Sill",
+}
+
+var errWOFF2Corrupt = errors.New("corrupt WOFF2 data")
+
+// woff2Header is the file header of a WOFF2 file.
+type woff2Header struct {
+	Signature           uint32
+	Flavor              uint32
+	Length              uint32
+	NumTables           uint16
+	Reserved            uint16
+	TotalSfntSize       uint32
+	TotalCompressedSize uint32
+	MajorVersion        uint16
+	MinorVersion        uint16
+	MetaOffset          uint32
+	MetaLength          uint32
+	MetaOrigLength      uint32
+	PrivOffset          uint32
+	PrivLength          uint32
+}
+
+// woff2Table is an entry of the WOFF2 table directory.
+type woff2Table struct {
+	tag             string
+	origLength      uint32
+	transformLength uint32
+	transformed     bool
+	data            []byte // data from the decompressed stream
+	sfntData        []byte // data of the reconstructed table
+}
+
+// woff2Font is a font in a WOFF2 collection.
+type woff2Font struct {
+	flavor uint32
+	tables []int // indexes into the table directory
+}
+
+// woff2Buffer reads the data types used in WOFF2 files. After an error all
+// subsequent reads return zero and the first error is kept in err.
+type woff2Buffer struct {
+	data []byte
+	pos  int
+	err  error
+}
+
+func (b *woff2Buffer) bytes(n int) []byte {
+	if b.err != nil {
+		return nil
+	}
+	if n < 0 || b.pos+n > len(b.data) {
+		b.err = errWOFF2Corrupt
+		return nil
+	}
+	ret := b.data[b.pos : b.pos+n]
+	b.pos += n
+	return ret
+}
+
+func (b *woff2Buffer) uint8() uint8 {
+	if d := b.bytes(1); d != nil {
+		return d[0]
+	}
+	return 0
+}
+
+func (b *woff2Buffer) uint16() uint16 {
+	if d := b.bytes(2); d != nil {
+		return binary.BigEndian.Uint16(d)
+	}
+	return 0
+}
+
+func (b *woff2Buffer) int16() int16 {
+	return int16(b.uint16())
+}
+
+func (b *woff2Buffer) uint32() uint32 {
+	if d := b.bytes(4); d != nil {
+		return binary.BigEndian.Uint32(d)
+	}
+	return 0
+}
+
+// uintBase128 reads a variable length number with up to five bytes.
+func (b *woff2Buffer) uintBase128() uint32 {
+	var accum uint32
+	for i := 0; i < 5; i++ {
+		c := b.uint8()
+		if b.err != nil {
+			return 0
+		}
+		// no leading zeros
+		if i == 0 && c == 0x80 {
+			b.err = errWOFF2Corrupt
+			return 0
+		}
+		// the next shift would overflow
+		if accum&0xFE000000 != 0 {
+			b.err = errWOFF2Corrupt
+			return 0
+		}
+		accum = accum<<7 | uint32(c&0x7F)
+		if c&0x80 == 0 {
+			return accum
+		}
+	}
+	b.err = errWOFF2Corrupt
+	return 0
+}
+
+// uint255 reads a variable length number in the range 0-65535.
+func (b *woff2Buffer) uint255() uint16 {
+	const (
+		oneMoreByteCode1 = 255
+		oneMoreByteCode2 = 254
+		wordCode         = 253
+		lowestUCode      = 253
+	)
+	switch c := b.uint8(); c {
+	case wordCode:
+		return b.uint16()
+	case oneMoreByteCode1:
+		return uint16(b.uint8()) + lowestUCode
+	case oneMoreByteCode2:
+		return uint16(b.uint8()) + lowestUCode*2
+	default:
+		return uint16(c)
+	}
+}
+
+// decodeWOFF2 reads a WOFF2 file from r and returns the sfnt data. The table
+// data is decompressed and the transformed tables (glyf, loca and hmtx) are
+// reconstructed. A WOFF2 collection is returned as a TrueType collection.
+func decodeWOFF2(r io.ReadSeeker) ([]byte, error) {
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	filedata, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	hdr := woff2Header{}
+	if err = binary.Read(bytes.NewReader(filedata), binary.BigEndian, &hdr); err != nil {
+		return nil, err
+	}
+	if hdr.Signature != magicWOFF2 {
+		return nil, fmt.Errorf("not a WOFF2 file")
+	}
+	buf := &woff2Buffer{data: filedata, pos: binary.Size(hdr)}
+
+	tables := make([]*woff2Table, hdr.NumTables)
+	for i := range tables {
+		tbl := &woff2Table{}
+		flags := buf.uint8()
+		if tagIdx := flags & 0x3f; tagIdx == 0x3f {
+			tbl.tag = string(buf.bytes(4))
+		} else {
+			tbl.tag = woff2KnownTags[tagIdx]
+		}
+		transformVersion := flags >> 6
+		tbl.origLength = buf.uintBase128()
+		if tbl.tag == "glyf" || tbl.tag == "loca" {
+			tbl.transformed = transformVersion == 0
+		} else {
+			tbl.transformed = transformVersion != 0
+		}
+		tbl.transformLength = tbl.origLength
+		if tbl.transformed {
+			tbl.transformLength = buf.uintBase128()
+			if tbl.tag == "loca" && tbl.transformLength != 0 {
+				return nil, errWOFF2Corrupt
+			}
+		}
+		tables[i] = tbl
+	}
+
+	var fonts []woff2Font
+	if hdr.Flavor == magicCollection {
+		version := buf.uint32()
+		if version != 0x00010000 && version != 0x00020000 {
+			return nil, fmt.Errorf("unsupported WOFF2 collection version %x", version)
+		}
+		numFonts := int(buf.uint255())
+		for i := 0; i < numFonts; i++ {
+			numTables := int(buf.uint255())
+			fnt := woff2Font{flavor: buf.uint32()}
+			for j := 0; j < numTables; j++ {
+				idx := int(buf.uint255())
+				if idx >= len(tables) {
+					return nil, errWOFF2Corrupt
+				}
+				fnt.tables = append(fnt.tables, idx)
+			}
+			fonts = append(fonts, fnt)
+		}
+	} else {
+		fnt := woff2Font{flavor: hdr.Flavor}
+		for i := range tables {
+			fnt.tables = append(fnt.tables, i)
+		}
+		fonts = append(fonts, fnt)
+	}
+	compressed := buf.bytes(int(hdr.TotalCompressedSize))
+	if buf.err != nil {
+		return nil, buf.err
+	}
+
+	stream, err := brotli.Decode(compressed)
+	if err != nil {
+		return nil, err
+	}
+	pos := uint32(0)
+	for _, tbl := range tables {
+		if pos+tbl.transformLength > uint32(len(stream)) {
+			return nil, errWOFF2Corrupt
+		}
+		tbl.data = stream[pos : pos+tbl.transformLength]
+		if !tbl.transformed {
+			tbl.sfntData = tbl.data
+		}
+		pos += tbl.transformLength
+	}
+
+	for _, fnt := range fonts {
+		if err = fnt.reconstructTables(tables); err != nil {
+			return nil, err
+		}
+	}
+	for _, tbl := range tables {
+		if tbl.sfntData == nil && tbl.origLength > 0 {
+			return nil, fmt.Errorf("WOFF2: cannot reconstruct table %s", tbl.tag)
+		}
+	}
+
+	if hdr.Flavor == magicCollection {
+		return buildWOFF2Collection(fonts, tables), nil
+	}
+	sfntTables := make([]tableOffsetLength, 0, len(tables))
+	for _, tbl := range tables {
+		sfntTables = append(sfntTables, tableOffsetLength{
+			name:      tbl.tag,
+			length:    uint32(len(tbl.sfntData)),
+			checksum:  calcChecksum(tbl.sfntData),
+			tabledata: tbl.sfntData,
+		})
+	}
+	sfnt := buildSfnt(hdr.Flavor, sfntTables)
+	setChecksumAdjustment(sfnt)
+	return sfnt, nil
+}
+
+// setChecksumAdjustment sets the checksum adjustment field of the head table
+// in the sfnt data.
+func setChecksumAdjustment(sfnt []byte) {
+	numTables := int(binary.BigEndian.Uint16(sfnt[4:]))
+	for i := 0; i < numTables; i++ {
+		entry := sfnt[12+16*i:]
+		if string(entry[:4]) != "head" {
+			continue
+		}
+		offset := binary.BigEndian.Uint32(entry[8:])
+		length := binary.BigEndian.Uint32(entry[12:])
+		if length < 12 {
+			return
+		}
+		head := sfnt[offset : offset+length]
+		binary.BigEndian.PutUint32(head[8:], 0)
+		binary.BigEndian.PutUint32(entry[4:], calcChecksum(head))
+		binary.BigEndian.PutUint32(head[8:], 0xB1B0AFBA-calcChecksum(sfnt))
+	}
+}
+
+// reconstructTables restores the transformed tables of the font.
+func (fnt woff2Font) reconstructTables(tables []*woff2Table) error {
+	find := func(tag string) *woff2Table {
+		for _, idx := range fnt.tables {
+			if tables[idx].tag == tag {
+				return tables[idx]
+			}
+		}
+		return nil
+	}
+	glyf, loca := find("glyf"), find("loca")
+	var xMins []int16
+	if glyf != nil && glyf.transformed {
+		if loca == nil || !loca.transformed {
+			return errWOFF2Corrupt
+		}
+		if glyf.sfntData == nil {
+			var err error
+			if glyf.sfntData, loca.sfntData, err = reconstructGlyfLoca(glyf.data); err != nil {
+				return err
+			}
+			if uint32(len(loca.sfntData)) != loca.origLength {
+				return errWOFF2Corrupt
+			}
+		}
+	}
+	if hmtx := find("hmtx"); hmtx != nil && hmtx.transformed && hmtx.sfntData == nil {
+		hhea, maxp := find("hhea"), find("maxp")
+		if glyf == nil || loca == nil || hhea == nil || maxp == nil || len(hhea.sfntData) < 36 || len(maxp.sfntData) < 6 {
+			return errWOFF2Corrupt
+		}
+		numHMetrics := int(binary.BigEndian.Uint16(hhea.sfntData[34:]))
+		numGlyphs := int(binary.BigEndian.Uint16(maxp.sfntData[4:]))
+		var err error
+		if xMins, err = glyphXMins(glyf.sfntData, loca.sfntData, numGlyphs); err != nil {
+			return err
+		}
+		if hmtx.sfntData, err = reconstructHmtx(hmtx.data, numGlyphs, numHMetrics, xMins); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Flags of simple glyphs.
+const (
+	glyfOnCurve      = 1 << 0
+	glyfXShort       = 1 << 1
+	glyfYShort       = 1 << 2
+	glyfRepeat       = 1 << 3
+	glyfThisXIsSame  = 1 << 4
+	glyfThisYIsSame  = 1 << 5
+	glyfOverlapSimpl = 1 << 6
+)
+
+type woff2Point struct {
+	x, y    int
+	onCurve bool
+}
+
+// tripletDecode decodes the coordinates of n points from the flags and the
+// glyph stream.
+func tripletDecode(flags []byte, glyphStream *woff2Buffer) []woff2Point {
+	withSign := func(flag byte, baseval int) int {
+		if flag&1 != 0 {
+			return baseval
+		}
+		return -baseval
+	}
+	points := make([]woff2Point, len(flags))
+	x, y := 0, 0
+	for i, flag := range flags {
+		onCurve := flag>>7 == 0
+		flag &= 0x7f
+		var dx, dy int
+		switch {
+		case flag < 10:
+			b0 := int(glyphStream.uint8())
+			dy = withSign(flag, int(flag&14)<<7+b0)
+		case flag < 20:
+			b0 := int(glyphStream.uint8())
+			dx = withSign(flag, int((flag-10)&14)<<7+b0)
+		case flag < 84:
+			b0 := int(flag - 20)
+			b1 := int(glyphStream.uint8())
+			dx = withSign(flag, 1+(b0&0x30)+b1>>4)
+			dy = withSign(flag>>1, 1+(b0&0x0c)<<2+b1&0x0f)
+		case flag < 120:
+			b0 := int(flag - 84)
+			d := glyphStream.bytes(2)
+			if d == nil {
+				return nil
+			}
+			dx = withSign(flag, 1+(b0/12)<<8+int(d[0]))
+			dy = withSign(flag>>1, 1+((b0%12)>>2)<<8+int(d[1]))
+		case flag < 124:
+			d := glyphStream.bytes(3)
+			if d == nil {
+				return nil
+			}
+			dx = withSign(flag, int(d[0])<<4+int(d[1])>>4)
+			dy = withSign(flag>>1, int(d[1]&0x0f)<<8+int(d[2]))
+		default:
+			d := glyphStream.bytes(4)
+			if d == nil {
+				return nil
+			}
+			dx = withSign(flag, int(d[0])<<8+int(d[1]))
+			dy = withSign(flag>>1, int(d[2])<<8+int(d[3]))
+		}
+		x += dx
+		y += dy
+		points[i] = woff2Point{x: x, y: y, onCurve: onCurve}
+	}
+	return points
+}
+
+// encodeSimpleGlyph writes the contours as a TrueType simple glyph.
+func encodeSimpleGlyph(w *bytes.Buffer, points []woff2Point, endPts []uint16, bbox [4]int16, instructions []byte, overlap bool) {
+	binary.Write(w, binary.BigEndian, int16(len(endPts)))
+	binary.Write(w, binary.BigEndian, bbox)
+	binary.Write(w, binary.BigEndian, endPts)
+	binary.Write(w, binary.BigEndian, uint16(len(instructions)))
+	w.Write(instructions)
+
+	flags := make([]byte, 0, len(points))
+	var xs, ys bytes.Buffer
+	lastX, lastY := 0, 0
+	for i, pt := range points {
+		flag := byte(0)
+		if pt.onCurve {
+			flag |= glyfOnCurve
+		}
+		if i == 0 && overlap {
+			flag |= glyfOverlapSimpl
+		}
+		dx, dy := pt.x-lastX, pt.y-lastY
+		switch {
+		case dx == 0:
+			flag |= glyfThisXIsSame
+		case dx > -256 && dx < 256:
+			flag |= glyfXShort
+			if dx > 0 {
+				flag |= glyfThisXIsSame
+			} else {
+				dx = -dx
+			}
+			xs.WriteByte(byte(dx))
+		default:
+			binary.Write(&xs, binary.BigEndian, int16(dx))
+		}
+		switch {
+		case dy == 0:
+			flag |= glyfThisYIsSame
+		case dy > -256 && dy < 256:
+			flag |= glyfYShort
+			if dy > 0 {
+				flag |= glyfThisYIsSame
+			} else {
+				dy = -dy
+			}
+			ys.WriteByte(byte(dy))
+		default:
+			binary.Write(&ys, binary.BigEndian, int16(dy))
+		}
+		lastX, lastY = pt.x, pt.y
+		flags = append(flags, flag)
+	}
+	// compress runs of identical flags with the repeat flag
+	for i := 0; i < len(flags); {
+		run := 1
+		for i+run < len(flags) && flags[i+run] == flags[i] && run < 256 {
+			run++
+		}
+		if run > 1 {
+			w.WriteByte(flags[i] | glyfRepeat)
+			w.WriteByte(byte(run - 1))
+		} else {
+			w.WriteByte(flags[i])
+		}
+		i += run
+	}
+	w.Write(xs.Bytes())
+	w.Write(ys.Bytes())
+}
+
+// reconstructGlyfLoca restores the glyf and loca tables from the transformed
+// glyf table.
+//
+// See https://www.w3.org/TR/WOFF2/#glyf_table_format
+func reconstructGlyfLoca(data []byte) ([]byte, []byte, error) {
+	hdr := &woff2Buffer{data: data}
+	hdr.uint16() // reserved
+	optionFlags := hdr.uint16()
+	numGlyphs := int(hdr.uint16())
+	indexFormat := hdr.uint16()
+	var streamSizes [7]uint32
+	for i := range streamSizes {
+		streamSizes[i] = hdr.uint32()
+	}
+	var streams [7]*woff2Buffer
+	for i, size := range streamSizes {
+		streams[i] = &woff2Buffer{data: hdr.bytes(int(size))}
+	}
+	var overlapBitmap []byte
+	if optionFlags&1 != 0 {
+		overlapBitmap = hdr.bytes((numGlyphs + 7) >> 3)
+	}
+	if hdr.err != nil {
+		return nil, nil, hdr.err
+	}
+	nContourStream, nPointsStream, flagStream, glyphStream := streams[0], streams[1], streams[2], streams[3]
+	compositeStream, bboxStream, instructionStream := streams[4], streams[5], streams[6]
+	bboxBitmap := bboxStream.bytes(4 * ((numGlyphs + 31) >> 5))
+
+	var glyf bytes.Buffer
+	offsets := make([]uint32, 0, numGlyphs+1)
+	for i := 0; i < numGlyphs; i++ {
+		offsets = append(offsets, uint32(glyf.Len()))
+		nContours := nContourStream.int16()
+		hasBbox := bboxBitmap != nil && bboxBitmap[i>>3]&(0x80>>uint(i&7)) != 0
+		var bbox [4]int16
+		if hasBbox {
+			for j := range bbox {
+				bbox[j] = bboxStream.int16()
+			}
+		}
+		switch {
+		case nContours == 0:
+			if hasBbox {
+				return nil, nil, errWOFF2Corrupt
+			}
+		case nContours == -1:
+			// composite glyph
+			if !hasBbox {
+				return nil, nil, errWOFF2Corrupt
+			}
+			start := compositeStream.pos
+			haveInstructions := false
+			for {
+				flags := compositeStream.uint16()
+				compositeStream.uint16() // glyph index
+				argSize := 2
+				if flags&flagArg1And2AreWords != 0 {
+					argSize = 4
+				}
+				switch {
+				case flags&flagWeHaveAScale != 0:
+					argSize += 2
+				case flags&flagWeHaveAnXAndYScale != 0:
+					argSize += 4
+				case flags&flagWeHaveATwoByTwo != 0:
+					argSize += 8
+				}
+				compositeStream.bytes(argSize)
+				if flags&flagWeHaveInstructions != 0 {
+					haveInstructions = true
+				}
+				if flags&flagMoreComponents == 0 || compositeStream.err != nil {
+					break
+				}
+			}
+			if compositeStream.err != nil {
+				return nil, nil, compositeStream.err
+			}
+			binary.Write(&glyf, binary.BigEndian, nContours)
+			binary.Write(&glyf, binary.BigEndian, bbox)
+			glyf.Write(compositeStream.data[start:compositeStream.pos])
+			if haveInstructions {
+				instructionLength := glyphStream.uint255()
+				binary.Write(&glyf, binary.BigEndian, instructionLength)
+				glyf.Write(instructionStream.bytes(int(instructionLength)))
+			}
+		case nContours > 0:
+			endPts := make([]uint16, nContours)
+			nPoints := 0
+			for j := range endPts {
+				nPoints += int(nPointsStream.uint255())
+				if nPoints > 0xffff {
+					return nil, nil, errWOFF2Corrupt
+				}
+				endPts[j] = uint16(nPoints - 1)
+			}
+			flags := flagStream.bytes(nPoints)
+			if flags == nil {
+				return nil, nil, errWOFF2Corrupt
+			}
+			points := tripletDecode(flags, glyphStream)
+			if glyphStream.err != nil {
+				return nil, nil, glyphStream.err
+			}
+			instructionLength := glyphStream.uint255()
+			instructions := instructionStream.bytes(int(instructionLength))
+			if !hasBbox && len(points) > 0 {
+				xMin, yMin, xMax, yMax := points[0].x, points[0].y, points[0].x, points[0].y
+				for _, pt := range points[1:] {
+					xMin, xMax = minInt(xMin, pt.x), maxInt(xMax, pt.x)
+					yMin, yMax = minInt(yMin, pt.y), maxInt(yMax, pt.y)
+				}
+				bbox = [4]int16{int16(xMin), int16(yMin), int16(xMax), int16(yMax)}
+			}
+			overlap := overlapBitmap != nil && overlapBitmap[i>>3]&(0x80>>uint(i&7)) != 0
+			encodeSimpleGlyph(&glyf, points, endPts, bbox, instructions, overlap)
+		default:
+			return nil, nil, errWOFF2Corrupt
+		}
+		for glyf.Len()%4 != 0 {
+			glyf.WriteByte(0)
+		}
+	}
+	offsets = append(offsets, uint32(glyf.Len()))
+	for _, s := range streams {
+		if s.err != nil {
+			return nil, nil, s.err
+		}
+	}
+
+	var loca bytes.Buffer
+	for _, off := range offsets {
+		if indexFormat == 0 {
+			binary.Write(&loca, binary.BigEndian, uint16(off/2))
+		} else {
+			binary.Write(&loca, binary.BigEndian, off)
+		}
+	}
+	return glyf.Bytes(), loca.Bytes(), nil
+}
+
+// glyphXMins returns the xMin values of all glyphs. Empty glyphs have a xMin
+// of 0.
+func glyphXMins(glyf, loca []byte, numGlyphs int) ([]int16, error) {
+	xMins := make([]int16, numGlyphs)
+	longOffsets := len(loca) == 4*(numGlyphs+1)
+	if !longOffsets && len(loca) != 2*(numGlyphs+1) {
+		return nil, errWOFF2Corrupt
+	}
+	offset := func(i int) uint32 {
+		if longOffsets {
+			return binary.BigEndian.Uint32(loca[4*i:])
+		}
+		return uint32(binary.BigEndian.Uint16(loca[2*i:])) * 2
+	}
+	for i := range xMins {
+		start, end := offset(i), offset(i+1)
+		if end > uint32(len(glyf)) || start > end {
+			return nil, errWOFF2Corrupt
+		}
+		if end-start >= 10 {
+			xMins[i] = int16(binary.BigEndian.Uint16(glyf[start+2:]))
+		}
+	}
+	return xMins, nil
+}
+
+// reconstructHmtx restores the hmtx table from the transformed hmtx table.
+// Omitted left side bearings are taken from the xMin values of the glyphs.
+func reconstructHmtx(data []byte, numGlyphs, numHMetrics int, xMins []int16) ([]byte, error) {
+	buf := &woff2Buffer{data: data}
+	flags := buf.uint8()
+	if numHMetrics < 1 || numHMetrics > numGlyphs || flags&0xfc != 0 {
+		return nil, errWOFF2Corrupt
+	}
+	advanceWidths := make([]uint16, numHMetrics)
+	for i := range advanceWidths {
+		advanceWidths[i] = buf.uint16()
+	}
+	lsbs := make([]int16, numGlyphs)
+	for i := range lsbs {
+		if i < numHMetrics && flags&1 == 0 || i >= numHMetrics && flags&2 == 0 {
+			lsbs[i] = buf.int16()
+		} else {
+			lsbs[i] = xMins[i]
+		}
+	}
+	if buf.err != nil {
+		return nil, buf.err
+	}
+	var hmtx bytes.Buffer
+	for i, lsb := range lsbs {
+		if i < numHMetrics {
+			binary.Write(&hmtx, binary.BigEndian, advanceWidths[i])
+		}
+		binary.Write(&hmtx, binary.BigEndian, lsb)
+	}
+	return hmtx.Bytes(), nil
+}
+
+// buildWOFF2Collection creates a TrueType collection from the reconstructed
+// tables. Tables that are used in more than one font are written only once.
+func buildWOFF2Collection(fonts []woff2Font, tables []*woff2Table) []byte {
+	headerLen := 12 + 4*len(fonts)
+	dirLen := 0
+	for _, fnt := range fonts {
+		dirLen += 12 + 16*len(fnt.tables)
+	}
+	tableOffsets := make([]uint32, len(tables))
+	offset := uint32(headerLen + dirLen)
+	for i, tbl := range tables {
+		tableOffsets[i] = offset
+		offset += (uint32(len(tbl.sfntData)) + 3) &^ 3
+	}
+
+	var b bytes.Buffer
+	binary.Write(&b, binary.BigEndian, uint32(magicCollection))
+	binary.Write(&b, binary.BigEndian, uint32(0x00010000))
+	binary.Write(&b, binary.BigEndian, uint32(len(fonts)))
+	dirOffset := headerLen
+	for _, fnt := range fonts {
+		binary.Write(&b, binary.BigEndian, uint32(dirOffset))
+		dirOffset += 12 + 16*len(fnt.tables)
+	}
+	for _, fnt := range fonts {
+		idx := append([]int{}, fnt.tables...)
+		sort.Slice(idx, func(i, j int) bool { return tables[idx[i]].tag < tables[idx[j]].tag })
+		entrySelector := 0
+		for 2<<entrySelector <= len(idx) {
+			entrySelector++
+		}
+		searchRange := (1 << entrySelector) * 16
+		binary.Write(&b, binary.BigEndian, fnt.flavor)
+		binary.Write(&b, binary.BigEndian, []uint16{uint16(len(idx)), uint16(searchRange), uint16(entrySelector), uint16(len(idx)*16 - searchRange)})
+		for _, i := range idx {
+			b.WriteString(tables[i].tag)
+			binary.Write(&b, binary.BigEndian, calcChecksum(tables[i].sfntData))
+			binary.Write(&b, binary.BigEndian, tableOffsets[i])
+			binary.Write(&b, binary.BigEndian, uint32(len(tables[i].sfntData)))
+		}
+	}
+	for _, tbl := range tables {
+		b.Write(tbl.sfntData)
+		for i := len(tbl.sfntData); i&3 != 0; i++ {
+			b.WriteByte(0)
+		}
+	}
+	return b.Bytes()
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func maxInt(a, b int) int {
+	if a > b {
+		return a
+	}
+	return b
+}
+
+// appendUIntBase128 appends v as a variable length number to b.
+func appendUIntBase128(b []byte, v uint32) []byte {
+	n := 1
+	for v>>(7*uint(n)) != 0 {
+		n++
+	}
+	for i := n - 1; i >= 0; i-- {
+		c := byte(v>>(7*uint(i))) & 0x7f
+		if i > 0 {
+			c |= 0x80
+		}
+		b = append(b, c)
+	}
+	return b
+}
+
+// writeUint255 writes v as a variable length number in the range 0-65535.
+func writeUint255(w *bytes.Buffer, v int) {
+	switch {
+	case v < 253:
+		w.WriteByte(byte(v))
+	case v < 506:
+		w.WriteByte(255)
+		w.WriteByte(byte(v - 253))
+	case v < 762:
+		w.WriteByte(254)
+		w.WriteByte(byte(v - 506))
+	default:
+		w.WriteByte(253)
+		binary.Write(w, binary.BigEndian, uint16(v))
+	}
+}
+
+// writeTriplet writes the flag and the coordinate bytes for a point with the
+// relative coordinates dx and dy.
+func writeTriplet(flagStream, glyphStream *bytes.Buffer, onCurve bool, dx, dy int) {
+	absX, absY := dx, dy
+	if absX < 0 {
+		absX = -absX
+	}
+	if absY < 0 {
+		absY = -absY
+	}
+	flag := 0
+	if !onCurve {
+		flag = 128
+	}
+	xSign, ySign := 1, 1
+	if dx < 0 {
+		xSign = 0
+	}
+	if dy < 0 {
+		ySign = 0
+	}
+	xySigns := xSign + 2*ySign
+	switch {
+	case dx == 0 && absY < 1280:
+		flagStream.WriteByte(byte(flag + (absY&0xf00)>>7 + ySign))
+		glyphStream.WriteByte(byte(absY))
+	case dy == 0 && absX < 1280:
+		flagStream.WriteByte(byte(flag + 10 + (absX&0xf00)>>7 + xSign))
+		glyphStream.WriteByte(byte(absX))
+	case absX < 65 && absY < 65:
+		flagStream.WriteByte(byte(flag + 20 + (absX-1)&0x30 + ((absY-1)&0x30)>>2 + xySigns))
+		glyphStream.WriteByte(byte((absX-1)&0xf<<4 | (absY-1)&0xf))
+	case absX < 769 && absY < 769:
+		flagStream.WriteByte(byte(flag + 84 + 12*(((absX-1)&0x300)>>8) + ((absY-1)&0x300)>>6 + xySigns))
+		glyphStream.WriteByte(byte(absX - 1))
+		glyphStream.WriteByte(byte(absY - 1))
+	case absX < 4096 && absY < 4096:
+		flagStream.WriteByte(byte(flag + 120 + xySigns))
+		glyphStream.WriteByte(byte(absX >> 4))
+		glyphStream.WriteByte(byte(absX&0xf<<4 | absY>>8))
+		glyphStream.WriteByte(byte(absY))
+	default:
+		flagStream.WriteByte(byte(flag + 124 + xySigns))
+		binary.Write(glyphStream, binary.BigEndian, []uint16{uint16(absX), uint16(absY)})
+	}
+}
+
+// locaOffsets returns the glyph offsets from the loca table.
+func locaOffsets(loca []byte, numGlyphs int, indexFormat int16) ([]uint32, error) {
+	offsets := make([]uint32, numGlyphs+1)
+	if indexFormat == 0 && len(loca) < 2*len(offsets) || indexFormat != 0 && len(loca) < 4*len(offsets) {
+		return nil, fmt.Errorf("loca table too short")
+	}
+	for i := range offsets {
+		if indexFormat == 0 {
+			offsets[i] = uint32(binary.BigEndian.Uint16(loca[2*i:])) * 2
+		} else {
+			offsets[i] = binary.BigEndian.Uint32(loca[4*i:])
+		}
+	}
+	return offsets, nil
+}
+
+// transformGlyf returns the transformed glyf table that replaces the glyf and
+// the loca table in a WOFF2 file.
+//
+// See https://www.w3.org/TR/WOFF2/#glyf_table_format
+func transformGlyf(glyf, loca []byte, numGlyphs int, indexFormat int16) ([]byte, error) {
+	offsets, err := locaOffsets(loca, numGlyphs, indexFormat)
+	if err != nil {
+		return nil, err
+	}
+	var nContourStream, nPointsStream, flagStream, glyphStream, compositeStream, bboxStream, instructionStream bytes.Buffer
+	bboxBitmap := make([]byte, 4*((numGlyphs+31)>>5))
+	overlapBitmap := make([]byte, (numGlyphs+7)>>3)
+	hasOverlap := false
+	for i := 0; i < numGlyphs; i++ {
+		start, end := offsets[i], offsets[i+1]
+		if start > end || end > uint32(len(glyf)) {
+			return nil, fmt.Errorf("invalid glyph offsets for glyph %d", i)
+		}
+		g := &woff2Buffer{data: glyf[start:end]}
+		var nContours int16
+		if end-start > 0 {
+			nContours = g.int16()
+		}
+		if nContours == 0 {
+			binary.Write(&nContourStream, binary.BigEndian, int16(0))
+			continue
+		}
+		var bbox [4]int16
+		for j := range bbox {
+			bbox[j] = g.int16()
+		}
+		if nContours < 0 {
+			binary.Write(&nContourStream, binary.BigEndian, int16(-1))
+			bboxBitmap[i>>3] |= 0x80 >> uint(i&7)
+			binary.Write(&bboxStream, binary.BigEndian, bbox)
+			compositeStart := g.pos
+			haveInstructions := false
+			for {
+				flags := g.uint16()
+				g.uint16() // glyph index
+				argSize := 2
+				if flags&flagArg1And2AreWords != 0 {
+					argSize = 4
+				}
+				switch {
+				case flags&flagWeHaveAScale != 0:
+					argSize += 2
+				case flags&flagWeHaveAnXAndYScale != 0:
+					argSize += 4
+				case flags&flagWeHaveATwoByTwo != 0:
+					argSize += 8
+				}
+				g.bytes(argSize)
+				if flags&flagWeHaveInstructions != 0 {
+					haveInstructions = true
+				}
+				if flags&flagMoreComponents == 0 || g.err != nil {
+					break
+				}
+			}
+			if g.err == nil {
+				compositeStream.Write(g.data[compositeStart:g.pos])
+			}
+			if haveInstructions {
+				instructionLength := int(g.uint16())
+				writeUint255(&glyphStream, instructionLength)
+				instructionStream.Write(g.bytes(instructionLength))
+			}
+			if g.err != nil {
+				return nil, fmt.Errorf("glyph %d: %s", i, g.err)
+			}
+			continue
+		}
+
+		// simple glyph
+		endPts := make([]uint16, nContours)
+		for j := range endPts {
+			endPts[j] = g.uint16()
+		}
+		instructionLength := int(g.uint16())
+		instructions := g.bytes(instructionLength)
+		nPoints := int(endPts[len(endPts)-1]) + 1
+		flags := make([]byte, 0, nPoints)
+		for len(flags) < nPoints && g.err == nil {
+			flag := g.uint8()
+			flags = append(flags, flag)
+			if flag&glyfRepeat != 0 {
+				for n := g.uint8(); n > 0; n-- {
+					flags = append(flags, flag)
+				}
+			}
+		}
+		if len(flags) != nPoints {
+			return nil, fmt.Errorf("glyph %d: invalid flags", i)
+		}
+		points := make([]woff2Point, nPoints)
+		x, y := 0, 0
+		for j, flag := range flags {
+			switch {
+			case flag&glyfXShort != 0:
+				if flag&glyfThisXIsSame != 0 {
+					x += int(g.uint8())
+				} else {
+					x -= int(g.uint8())
+				}
+			case flag&glyfThisXIsSame == 0:
+				x += int(g.int16())
+			}
+			points[j].x = x
+			points[j].onCurve = flag&glyfOnCurve != 0
+		}
+		for j, flag := range flags {
+			switch {
+			case flag&glyfYShort != 0:
+				if flag&glyfThisYIsSame != 0 {
+					y += int(g.uint8())
+				} else {
+					y -= int(g.uint8())
+				}
+			case flag&glyfThisYIsSame == 0:
+				y += int(g.int16())
+			}
+			points[j].y = y
+		}
+		if g.err != nil {
+			return nil, fmt.Errorf("glyph %d: %s", i, g.err)
+		}
+
+		binary.Write(&nContourStream, binary.BigEndian, nContours)
+		prev := -1
+		for _, e := range endPts {
+			if int(e) < prev {
+				return nil, fmt.Errorf("glyph %d: invalid contour end points", i)
+			}
+			writeUint255(&nPointsStream, int(e)-prev)
+			prev = int(e)
+		}
+		lastX, lastY := 0, 0
+		for _, pt := range points {
+			writeTriplet(&flagStream, &glyphStream, pt.onCurve, pt.x-lastX, pt.y-lastY)
+			lastX, lastY = pt.x, pt.y
+		}
+		writeUint255(&glyphStream, instructionLength)
+		instructionStream.Write(instructions)
+
+		xMin, yMin, xMax, yMax := points[0].x, points[0].y, points[0].x, points[0].y
+		for _, pt := range points[1:] {
+			xMin, xMax = minInt(xMin, pt.x), maxInt(xMax, pt.x)
+			yMin, yMax = minInt(yMin, pt.y), maxInt(yMax, pt.y)
+		}
+		if bbox != [4]int16{int16(xMin), int16(yMin), int16(xMax), int16(yMax)} {
+			bboxBitmap[i>>3] |= 0x80 >> uint(i&7)
+			binary.Write(&bboxStream, binary.BigEndian, bbox)
+		}
+		if flags[0]&glyfOverlapSimpl != 0 {
+			overlapBitmap[i>>3] |= 0x80 >> uint(i&7)
+			hasOverlap = true
+		}
+	}
+
+	var b bytes.Buffer
+	optionFlags := uint16(0)
+	if hasOverlap {
+		optionFlags = 1
+	}
+	binary.Write(&b, binary.BigEndian, []uint16{0, optionFlags, uint16(numGlyphs), uint16(indexFormat)})
+	bboxData := append(bboxBitmap, bboxStream.Bytes()...)
+	streams := [][]byte{nContourStream.Bytes(), nPointsStream.Bytes(), flagStream.Bytes(), glyphStream.Bytes(), compositeStream.Bytes(), bboxData, instructionStream.Bytes()}
+	for _, s := range streams {
+		binary.Write(&b, binary.BigEndian, uint32(len(s)))
+	}
+	for _, s := range streams {
+		b.Write(s)
+	}
+	if hasOverlap {
+		b.Write(overlapBitmap)
+	}
+	return b.Bytes(), nil
+}
+
+// transformHmtx returns the transformed hmtx table if the left side bearings
+// of the proportional or the monospaced glyphs are the same as the xMin
+// values of the glyphs. Otherwise it returns nil.
+//
+// See https://www.w3.org/TR/WOFF2/#hmtx_table_format
+func transformHmtx(hmtx []byte, numGlyphs, numHMetrics int, xMins []int16) []byte {
+	if numHMetrics < 1 || numHMetrics > numGlyphs || len(hmtx) < 2*numGlyphs+2*numHMetrics {
+		return nil
+	}
+	lsb := func(i int) int16 {
+		if i < numHMetrics {
+			return int16(binary.BigEndian.Uint16(hmtx[4*i+2:]))
+		}
+		return int16(binary.BigEndian.Uint16(hmtx[4*numHMetrics+2*(i-numHMetrics):]))
+	}
+	proportional, monospaced := true, true
+	for i := 0; i < numGlyphs; i++ {
+		if lsb(i) != xMins[i] {
+			if i < numHMetrics {
+				proportional = false
+			} else {
+				monospaced = false
+			}
+		}
+	}
+	flags := byte(0)
+	if proportional {
+		flags |= 1
+	}
+	if monospaced && numHMetrics < numGlyphs {
+		flags |= 2
+	}
+	if flags == 0 {
+		return nil
+	}
+	var b bytes.Buffer
+	b.WriteByte(flags)
+	for i := 0; i < numHMetrics; i++ {
+		b.Write(hmtx[4*i : 4*i+2])
+	}
+	for i := 0; i < numGlyphs; i++ {
+		if i < numHMetrics && !proportional || i >= numHMetrics && flags&2 == 0 {
+			binary.Write(&b, binary.BigEndian, lsb(i))
+		}
+	}
+	return b.Bytes()
+}
+
+// encodeWOFF2 returns a WOFF2 file for the sfnt data. The glyf, loca and hmtx
+// tables are transformed if possible. The metadata is optional.
+func encodeWOFF2(sfnt []byte, metadata []byte) ([]byte, error) {
+	flavor, sfntTbls := sfntTables(sfnt)
+	sort.Slice(sfntTbls, func(i, j int) bool { return sfntTbls[i].name < sfntTbls[j].name })
+	tables := make([]*woff2Table, 0, len(sfntTbls))
+	find := func(tag string) *woff2Table {
+		for _, tbl := range tables {
+			if tbl.tag == tag {
+				return tbl
+			}
+		}
+		return nil
+	}
+	for _, t := range sfntTbls {
+		tables = append(tables, &woff2Table{tag: t.name, origLength: t.length, data: t.tabledata, sfntData: t.tabledata})
+	}
+
+	glyf, loca, head, maxp := find("glyf"), find("loca"), find("head"), find("maxp")
+	if glyf != nil && loca != nil && head != nil && maxp != nil && len(head.sfntData) >= 54 && len(maxp.sfntData) >= 6 {
+		indexFormat := int16(binary.BigEndian.Uint16(head.sfntData[50:]))
+		numGlyphs := int(binary.BigEndian.Uint16(maxp.sfntData[4:]))
+		transformed, err := transformGlyf(glyf.sfntData, loca.sfntData, numGlyphs, indexFormat)
+		if err != nil {
+			return nil, err
+		}
+		glyf.data, glyf.transformed = transformed, true
+		loca.data, loca.transformed = nil, true
+		// bit 11: the font has been subjected to a lossless transformation
+		headData := append([]byte{}, head.sfntData...)
+		binary.BigEndian.PutUint16(headData[16:], binary.BigEndian.Uint16(headData[16:])|1<<11)
+		head.data = headData
+
+		hhea, hmtx := find("hhea"), find("hmtx")
+		if hhea != nil && hmtx != nil && len(hhea.sfntData) >= 36 {
+			numHMetrics := int(binary.BigEndian.Uint16(hhea.sfntData[34:]))
+			xMins, err := glyphXMins(glyf.sfntData, loca.sfntData, numGlyphs)
+			if err == nil {
+				if data := transformHmtx(hmtx.sfntData, numGlyphs, numHMetrics, xMins); data != nil {
+					hmtx.data, hmtx.transformed = data, true
+				}
+			}
+		}
+	}
+	// loca must follow glyf
+	if glyf != nil && loca != nil {
+		sort.SliceStable(tables, func(i, j int) bool {
+			ti, tj := tables[i].tag, tables[j].tag
+			if ti == "loca" {
+				ti = "glyf\x00"
+			}
+			if tj == "loca" {
+				tj = "glyf\x00"
+			}
+			return ti < tj
+		})
+	}
+
+	var directory []byte
+	var stream []byte
+	for _, tbl := range tables {
+		flags := byte(0x3f)
+		for idx, knownTag := range woff2KnownTags {
+			if knownTag == tbl.tag {
+				flags = byte(idx)
+				break
+			}
+		}
+		switch {
+		case tbl.tag == "glyf" || tbl.tag == "loca":
+			if !tbl.transformed {
+				// null transform
+				flags |= 3 << 6
+			}
+		case tbl.transformed:
+			flags |= 1 << 6
+		}
+		directory = append(directory, flags)
+		if flags&0x3f == 0x3f {
+			directory = append(directory, tbl.tag...)
+		}
+		directory = appendUIntBase128(directory, tbl.origLength)
+		if tbl.transformed {
+			directory = appendUIntBase128(directory, uint32(len(tbl.data)))
+		}
+		stream = append(stream, tbl.data...)
+	}
+	compressed := brotli.Encode(stream)
+
+	hdr := woff2Header{
+		Signature:           magicWOFF2,
+		Flavor:              flavor,
+		NumTables:           uint16(len(tables)),
+		TotalSfntSize:       uint32(len(sfnt)),
+		TotalCompressedSize: uint32(len(compressed)),
+		MajorVersion:        1,
+	}
+	var b bytes.Buffer
+	b.Write(make([]byte, binary.Size(hdr)))
+	b.Write(directory)
+	b.Write(compressed)
+	for b.Len()%4 != 0 {
+		b.WriteByte(0)
+	}
+	if metadata != nil {
+		compressedMetadata := brotli.Encode(metadata)
+		hdr.MetaOffset = uint32(b.Len())
+		hdr.MetaLength = uint32(len(compressedMetadata))
+		hdr.MetaOrigLength = uint32(len(metadata))
+		b.Write(compressedMetadata)
+		for b.Len()%4 != 0 {
+			b.WriteByte(0)
+		}
+	}
+	hdr.Length = uint32(b.Len())
+	ret := b.Bytes()
+	var hdrBuf bytes.Buffer
+	binary.Write(&hdrBuf, binary.BigEndian, hdr)
+	copy(ret, hdrBuf.Bytes())
+	return ret, nil
+}
+
+// WriteWOFF2 writes the font as a WOFF2 file to w. If the font has been
+// subsetted, only the glyphs of the subset are included. The glyf, loca and
+// hmtx tables are transformed and the extended metadata is created from the
+// name table.
+func (tt *Font) WriteWOFF2(w io.Writer) error {
+	if err := tt.checkEmbedding("embed"); err != nil {
+		return err
+	}
+	sfnt, err := tt.fontData()
+	if err != nil {
+		return err
+	}
+	woff2, err := encodeWOFF2(sfnt, tt.woffMetadata())
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(woff2)
+	return err
+}
@@ -0,0 +1,183 @@
+package pdf
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/speedata/gootf/opentype"
+)
+
+// Font has the objects to embed a subset font as a composite (Type0) font
+// with the Identity-H or Identity-V encoding. All fields are indirect objects.
+type Font struct {
+	Type0          *Dict
+	CIDFont        *Dict
+	FontDescriptor *Dict
+	FontFile       *Stream
+	ToUnicode      *Stream
+	// CIDToGIDMap is nil for CFF fonts and if CIDs are glyph ids.
+	CIDToGIDMap *Stream
+}
+
+// Options change the generated font objects.
+type Options struct {
+	// CIDToGID maps CIDs to glyph ids of TrueType fonts. With the mapping
+	// returned by SubsetCompact the CIDs are the glyph ids of the original
+	// font. The /W array and the ToUnicode CMap are keyed by CID. Without a
+	// mapping the CIDs are the glyph ids. CFF fonts ignore the mapping, the
+	// CIDs of CID-keyed CFF fonts are taken from the charset (see
+	// opentype.Font.GlyphCID).
+	CIDToGID map[int]int
+	// Text has the text of CIDs for the ToUnicode CMap that do not map to a
+	// single Unicode value, for example ligatures.
+	Text map[int]string
+	// DefaultWidth is the /DW entry of the CIDFont. Glyphs with this width
+	// are not in the /W array. The default is 1000.
+	DefaultWidth float64
+	// Vertical uses the Identity-V encoding for vertical writing and adds
+	// the vertical metrics (/W2 and /DW2) to the CIDFont.
+	Vertical bool
+	// OpenType embeds CFF based fonts as a complete OpenType file instead of
+	// the bare CFF data.
+	OpenType bool
+}
+
+// Objects returns the indirect objects of the font, the Type0 font first.
+func (f *Font) Objects() []Object {
+	objs := []Object{f.Type0, f.CIDFont, f.FontDescriptor, f.FontFile, f.ToUnicode}
+	if f.CIDToGIDMap != nil {
+		objs = append(objs, f.CIDToGIDMap)
+	}
+	return objs
+}
+
+// NewFont returns the PDF objects for the font tt. The font must be subset
+// before. opts can be nil.
+func NewFont(tt *opentype.Font, opts *Options) (*Font, error) {
+	if opts == nil {
+		opts = &Options{}
+	}
+	if tt.SubsetID == "" {
+		return nil, fmt.Errorf("the font must be subset before creating the PDF objects")
+	}
+	if tt.UnitsPerEM == 0 {
+		return nil, fmt.Errorf("the font has no units per em value")
+	}
+	fontName := Name(strings.TrimPrefix(tt.PDFName(), "/"))
+	toPDFUnits := func(v int) int {
+		return int(math.Round(float64(v) * 1000 / float64(tt.UnitsPerEM)))
+	}
+
+	var data bytes.Buffer
+	f := &Font{}
+	fontFileKey := Name("FontFile2")
+	f.FontFile = &Stream{Dict: Dict{}}
+	switch {
+	case !tt.IsCFF:
+		if err := tt.WriteSubset(&data); err != nil {
+			return nil, err
+		}
+		f.FontFile.Dict["Length1"] = data.Len()
+	case opts.OpenType:
+		if err := tt.Write(&data); err != nil {
+			return nil, err
+		}
+		fontFileKey = "FontFile3"
+		f.FontFile.Dict["Subtype"] = Name("OpenType")
+	default:
+		if err := tt.WriteSubset(&data); err != nil {
+			return nil, err
+		}
+		fontFileKey = "FontFile3"
+		f.FontFile.Dict["Subtype"] = Name("CIDFontType0C")
+	}
+	f.FontFile.Data = data.Bytes()
+
+	bbox := tt.FontBBox()
+	f.FontDescriptor = &Dict{
+		"Type":        Name("FontDescriptor"),
+		"FontName":    fontName,
+		"Flags":       tt.Flags(),
+		"FontBBox":    Array{bbox[0], bbox[1], bbox[2], bbox[3]},
+		"ItalicAngle": tt.ItalicAngle(),
+		"Ascent":      toPDFUnits(tt.Ascender()),
+		"Descent":     toPDFUnits(tt.Descender()),
+		"CapHeight":   toPDFUnits(tt.CapHeight()),
+		"StemV":       tt.StemV(),
+		fontFileKey:   f.FontFile,
+	}
+	if xh := tt.XHeight(); xh != 0 {
+		(*f.FontDescriptor)["XHeight"] = toPDFUnits(xh)
+	}
+
+	cidToGID := opts.CIDToGID
+	if tt.IsCFF {
+		cidToGID = nil
+	}
+	registry, ordering, supplement := tt.CIDSystemInfo()
+	f.CIDFont = &Dict{
+		"Type":     Name("Font"),
+		"Subtype":  Name("CIDFontType2"),
+		"BaseFont": fontName,
+		"CIDSystemInfo": Dict{
+			"Registry":   String(registry),
+			"Ordering":   String(ordering),
+			"Supplement": supplement,
+		},
+		"FontDescriptor": f.FontDescriptor,
+	}
+	dw := opts.DefaultWidth
+	if dw == 0 {
+		dw = 1000
+	} else if dw != 1000 {
+		(*f.CIDFont)["DW"] = dw
+	}
+	(*f.CIDFont)["W"] = Raw(tt.CIDWidths(dw, cidToGID))
+	encoding := Name("Identity-H")
+	if opts.Vertical {
+		encoding = "Identity-V"
+		w2, dw2 := tt.CIDWidths2(cidToGID)
+		(*f.CIDFont)["W2"] = Raw(w2)
+		(*f.CIDFont)["DW2"] = Raw(dw2)
+	}
+	if tt.IsCFF {
+		(*f.CIDFont)["Subtype"] = Name("CIDFontType0")
+	} else if cidToGID != nil {
+		f.CIDToGIDMap = &Stream{Dict: Dict{}, Data: cidToGIDMap(cidToGID)}
+		(*f.CIDFont)["CIDToGIDMap"] = f.CIDToGIDMap
+	} else {
+		(*f.CIDFont)["CIDToGIDMap"] = Name("Identity")
+	}
+
+	f.ToUnicode = &Stream{Dict: Dict{}, Data: []byte(tt.CIDToUnicodeCMap(opts.Text, cidToGID))}
+	f.Type0 = &Dict{
+		"Type":            Name("Font"),
+		"Subtype":         Name("Type0"),
+		"BaseFont":        fontName,
+		"Encoding":        encoding,
+		"DescendantFonts": Array{f.CIDFont},
+		"ToUnicode":       f.ToUnicode,
+	}
+	return f, nil
+}
+
+// cidToGIDMap returns the data of a CIDToGIDMap stream. The glyph id of each
+// CID is stored as a two byte big endian number, missing CIDs map to glyph 0.
+func cidToGIDMap(mapping map[int]int) []byte {
+	maxCID := -1
+	for cid := range mapping {
+		if cid > maxCID {
+			maxCID = cid
+		}
+	}
+	data := make([]byte, 2*(maxCID+1))
+	for cid, gid := range mapping {
+		if cid >= 0 {
+			data[2*cid] = byte(gid >> 8)
+			data[2*cid+1] = byte(gid)
+		}
+	}
+	return data
+}
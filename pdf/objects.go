@@ -0,0 +1,138 @@
+// Package pdf creates the PDF objects to embed an OpenType or TrueType font
+// in a PDF file. The objects are independent of a PDF writer, they can be
+// serialized with Serialize or converted to the object types of a PDF library.
+package pdf
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Object is a PDF object. It is one of nil, bool, int, float64, Name, String,
+// Raw, Array, Dict or an indirect object. Indirect objects are represented by
+// the types *Dict and *Stream, a PDF writer must write them as separate
+// objects and refer to them with object references.
+type Object interface{}
+
+// Name is a PDF name without the leading slash.
+type Name string
+
+// String is a PDF literal string.
+type String string
+
+// Raw is an object in PDF syntax that is written unchanged.
+type Raw string
+
+// Array is a PDF array.
+type Array []Object
+
+// Dict is a PDF dictionary.
+type Dict map[Name]Object
+
+// Stream is a PDF stream. The /Length entry is added when the stream is
+// serialized.
+type Stream struct {
+	Dict Dict
+	Data []byte
+}
+
+// Serialize writes obj in PDF syntax to w. objectNumber returns the object
+// number of an indirect object (a *Dict or a *Stream) inside of obj. If obj
+// itself is an indirect object, its contents are written.
+func Serialize(w io.Writer, obj Object, objectNumber func(Object) int) error {
+	var b strings.Builder
+	switch t := obj.(type) {
+	case *Dict:
+		if err := serialize(&b, *t, objectNumber); err != nil {
+			return err
+		}
+	case *Stream:
+		dict := Dict{}
+		for k, v := range t.Dict {
+			dict[k] = v
+		}
+		dict["Length"] = len(t.Data)
+		if err := serialize(&b, dict, objectNumber); err != nil {
+			return err
+		}
+		b.WriteString("\nstream\n")
+		b.Write(t.Data)
+		b.WriteString("\nendstream")
+	default:
+		if err := serialize(&b, obj, objectNumber); err != nil {
+			return err
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func serialize(b *strings.Builder, obj Object, objectNumber func(Object) int) error {
+	switch t := obj.(type) {
+	case nil:
+		b.WriteString("null")
+	case bool:
+		b.WriteString(strconv.FormatBool(t))
+	case int:
+		b.WriteString(strconv.Itoa(t))
+	case float64:
+		b.WriteString(strconv.FormatFloat(t, 'f', -1, 64))
+	case Name:
+		b.WriteString("/")
+		for _, c := range []byte(t) {
+			if c < '!' || c > '~' || strings.IndexByte("()<>[]{}/%#", c) >= 0 {
+				fmt.Fprintf(b, "#%02X", c)
+			} else {
+				b.WriteByte(c)
+			}
+		}
+	case String:
+		b.WriteString("(")
+		for _, c := range []byte(t) {
+			if c == '(' || c == ')' || c == '\\' {
+				b.WriteByte('\\')
+			}
+			b.WriteByte(c)
+		}
+		b.WriteString(")")
+	case Raw:
+		b.WriteString(string(t))
+	case Array:
+		b.WriteString("[")
+		for i, elt := range t {
+			if i > 0 {
+				b.WriteString(" ")
+			}
+			if err := serialize(b, elt, objectNumber); err != nil {
+				return err
+			}
+		}
+		b.WriteString("]")
+	case Dict:
+		keys := make([]string, 0, len(t))
+		for k := range t {
+			keys = append(keys, string(k))
+		}
+		sort.Strings(keys)
+		b.WriteString("<<")
+		for i, k := range keys {
+			if i > 0 {
+				b.WriteString(" ")
+			}
+			serialize(b, Name(k), objectNumber)
+			b.WriteString(" ")
+			if err := serialize(b, t[Name(k)], objectNumber); err != nil {
+				return err
+			}
+		}
+		b.WriteString(">>")
+	case *Dict, *Stream:
+		fmt.Fprintf(b, "%d 0 R", objectNumber(t))
+	default:
+		return fmt.Errorf("unknown PDF object type %T", obj)
+	}
+	return nil
+}
@@ -0,0 +1,226 @@
+package pdf
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+
+	"github.com/speedata/gootf/opentype"
+)
+
+func loadSubset(t *testing.T, filename string, codepoints []int) *opentype.Font {
+	tt, err := opentype.LoadFace(filepath.Join("..", "opentype", "testdata", filename), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = tt.ReadTables(); err != nil {
+		t.Fatal(err)
+	}
+	if err = tt.Subset(codepoints); err != nil {
+		t.Fatal(err)
+	}
+	return tt
+}
+
+func TestSerialize(t *testing.T) {
+	stream := &Stream{Dict: Dict{"Subtype": Name("Test")}, Data: []byte("abc")}
+	testdata := []struct {
+		obj  Object
+		want string
+	}{
+		{Array{nil, true, 1, -2.5, Name("A B/C"), String("a(b)\\")}, `[null true 1 -2.5 /A#20B#2FC (a\(b\)\\)]`},
+		{Dict{"B": stream, "A": Raw("[1[2]]")}, "<</A [1[2]] /B 7 0 R>>"},
+		{stream, "<</Length 3 /Subtype /Test>>\nstream\nabc\nendstream"},
+	}
+	for _, td := range testdata {
+		var b bytes.Buffer
+		err := Serialize(&b, td.obj, func(Object) int { return 7 })
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := b.String(); got != td.want {
+			t.Errorf("Serialize() = %q, want %q", got, td.want)
+		}
+	}
+}
+
+func TestNewFont(t *testing.T) {
+	tt, err := opentype.LoadFace(filepath.Join("..", "opentype", "testdata", "CrimsonPro-Regular.ttf"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = NewFont(tt, nil); err == nil {
+		t.Errorf("NewFont() without a subset: error = nil")
+	}
+
+	tt = loadSubset(t, "CrimsonPro-Regular.ttf", []int{0, 1, 2})
+	f, err := NewFont(tt, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	objs := f.Objects()
+	objectNumber := func(obj Object) int {
+		for i, o := range objs {
+			if o == obj {
+				return i + 1
+			}
+		}
+		return 0
+	}
+	var b bytes.Buffer
+	if err = Serialize(&b, f.Type0, objectNumber); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := b.String(), "<</BaseFont /CCGIEE-CrimsonPro-Regular /DescendantFonts [2 0 R] /Encoding /Identity-H /Subtype /Type0 /ToUnicode 5 0 R /Type /Font>>"; got != want {
+		t.Errorf("Type0 = %s, want %s", got, want)
+	}
+	b.Reset()
+	if err = Serialize(&b, f.FontDescriptor, objectNumber); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := b.String(), "<</Ascent 896 /CapHeight 573 /Descent -215 /Flags 32 /FontBBox [-105 -277 1132 961] /FontFile2 4 0 R /FontName /CCGIEE-CrimsonPro-Regular /ItalicAngle 0 /StemV 88 /Type /FontDescriptor /XHeight 415>>"; got != want {
+		t.Errorf("FontDescriptor = %s, want %s", got, want)
+	}
+	cidFont := *f.CIDFont
+	if got, want := cidFont["W"], Raw("[0 [500 568.4 568.4] 773 [0]]"); got != want {
+		t.Errorf("CIDFont /W = %v, want %v", got, want)
+	}
+	if got, want := cidFont["Subtype"], Name("CIDFontType2"); got != want {
+		t.Errorf("CIDFont /Subtype = %v, want %v", got, want)
+	}
+	if got, want := cidFont["CIDToGIDMap"], Name("Identity"); got != want {
+		t.Errorf("CIDFont /CIDToGIDMap = %v, want %v", got, want)
+	}
+	if got, want := f.FontFile.Dict["Length1"], len(f.FontFile.Data); got != want {
+		t.Errorf("FontFile2 /Length1 = %v, want %v", got, want)
+	}
+
+	f, err = NewFont(tt, &Options{CIDToGID: map[int]int{1: 2, 3: 1}, Text: map[int]string{1: "ffi"}, DefaultWidth: 500})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := f.CIDToGIDMap.Data, []byte{0, 0, 0, 2, 0, 0, 0, 1}; !bytes.Equal(got, want) {
+		t.Errorf("CIDToGIDMap = %v, want %v", got, want)
+	}
+	if got, want := (*f.CIDFont)["DW"], 500.0; got != want {
+		t.Errorf("CIDFont /DW = %v, want %v", got, want)
+	}
+	if want := []byte("<0001><006600660069>"); !bytes.Contains(f.ToUnicode.Data, want) {
+		t.Errorf("ToUnicode does not contain %s", want)
+	}
+	if got, want := len(f.Objects()), 6; got != want {
+		t.Errorf("len(Objects()) = %d, want %d", got, want)
+	}
+
+	f, err = NewFont(tt, &Options{Vertical: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := (*f.Type0)["Encoding"], Name("Identity-V"); got != want {
+		t.Errorf("Type0 /Encoding = %v, want %v", got, want)
+	}
+	for _, key := range []Name{"W2", "DW2"} {
+		if _, ok := (*f.CIDFont)[key]; !ok {
+			t.Errorf("CIDFont has no /%s", key)
+		}
+	}
+
+	// CFF
+	for _, openType := range []bool{false, true} {
+		tt = loadSubset(t, "customfont.otf", []int{0, 1, 2})
+		f, err = NewFont(tt, &Options{OpenType: openType})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := (*f.CIDFont)["Subtype"], Name("CIDFontType0"); got != want {
+			t.Errorf("CIDFont /Subtype = %v, want %v", got, want)
+		}
+		if _, ok := (*f.CIDFont)["CIDToGIDMap"]; ok {
+			t.Errorf("CIDFont of a CFF font has a /CIDToGIDMap")
+		}
+		if got, want := (*f.FontDescriptor)["FontFile3"], Object(f.FontFile); got != want {
+			t.Errorf("FontDescriptor /FontFile3 = %v, want the font file", got)
+		}
+		subtype, magic := Name("CIDFontType0C"), []byte{1, 0}
+		if openType {
+			subtype, magic = Name("OpenType"), []byte("OTTO")
+		}
+		if got := f.FontFile.Dict["Subtype"]; got != subtype {
+			t.Errorf("FontFile3 /Subtype = %v, want %v", got, subtype)
+		}
+		if !bytes.HasPrefix(f.FontFile.Data, magic) {
+			t.Errorf("font file %v starts with % X, want % X", subtype, f.FontFile.Data[:4], magic)
+		}
+	}
+}
+
+func TestNewFontEmbedding(t *testing.T) {
+	// restricted and bitmap only fonts must not be embedded in any format
+	for _, fsType := range []uint16{0x0002, 0x0204} {
+		for _, openType := range []bool{false, true} {
+			tt := loadSubset(t, "customfont.otf", []int{0, 1, 2})
+			tt.EmbeddingPolicy = opentype.EmbeddingEnforce
+			tt.OS2.FsType = fsType
+			_, err := NewFont(tt, &Options{OpenType: openType})
+			if _, ok := err.(*opentype.EmbeddingError); !ok {
+				t.Errorf("NewFont() with fsType 0x%04X and OpenType %t: error = %v, want an *opentype.EmbeddingError", fsType, openType, err)
+			}
+		}
+	}
+}
+
+func TestNewFontCIDs(t *testing.T) {
+	// the CIDs are the glyph ids of the original font, /W and ToUnicode are
+	// keyed by CID
+	tt, err := opentype.LoadFace(filepath.Join("..", "opentype", "testdata", "CrimsonPro-Regular.ttf"), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = tt.ReadTables(); err != nil {
+		t.Fatal(err)
+	}
+	// H and é, which is composed of e and acute
+	mapping, err := tt.SubsetCompact([]int{76, 281})
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := NewFont(tt, &Options{CIDToGID: mapping})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := (*f.CIDFont)["W"], Raw("[0 [500] 76 [656.2] 280 [439.5 439.5] 720 [0]]"); got != want {
+		t.Errorf("CIDFont /W = %v, want %v", got, want)
+	}
+	if want := []byte("4 beginbfchar\n<004C><0048>\n<0118><0065>\n<0119><00E9>\n<02D0><0301>\nendbfchar"); !bytes.Contains(f.ToUnicode.Data, want) {
+		t.Errorf("ToUnicode does not contain %q:\n%s", want, f.ToUnicode.Data)
+	}
+	if got, want := f.CIDToGIDMap.Data[2*281:2*281+2], []byte{0, 3}; !bytes.Equal(got, want) {
+		t.Errorf("CIDToGIDMap of CID 281 = %v, want %v", got, want)
+	}
+
+	// a CID-keyed CFF font with CID = 1000 + glyph id and the ROS
+	// Adobe-Japan1-6
+	for _, openType := range []bool{false, true} {
+		tt = loadSubset(t, "customfont-cid.otf", []int{0, 3, 7})
+		f, err = NewFont(tt, &Options{OpenType: openType, CIDToGID: map[int]int{5: 3}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got, want := (*f.CIDFont)["W"], Raw("[0 [0] 1003 [0] 1007 [680]]"); got != want {
+			t.Errorf("CIDFont /W = %v, want %v", got, want)
+		}
+		if want := []byte("2 beginbfchar\n<03EB><006F>\n<03EF><007E>\nendbfchar"); !bytes.Contains(f.ToUnicode.Data, want) {
+			t.Errorf("ToUnicode does not contain %q:\n%s", want, f.ToUnicode.Data)
+		}
+		var b bytes.Buffer
+		if err = Serialize(&b, (*f.CIDFont)["CIDSystemInfo"], nil); err != nil {
+			t.Fatal(err)
+		}
+		if got, want := b.String(), "<</Ordering (Japan1) /Registry (Adobe) /Supplement 6>>"; got != want {
+			t.Errorf("CIDSystemInfo = %s, want %s", got, want)
+		}
+		if f.CIDToGIDMap != nil {
+			t.Errorf("CIDFont of a CFF font has a /CIDToGIDMap")
+		}
+	}
+}
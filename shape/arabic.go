@@ -0,0 +1,174 @@
+package shape
+
+import (
+	"sort"
+	"unicode"
+)
+
+// Joining types of characters
+const (
+	joinNone        = iota // U
+	joinRight              // R, joins with the preceding character
+	joinLeft               // L, joins with the following character
+	joinDual               // D, joins on both sides
+	joinCausing            // C, causes joining on both sides
+	joinTransparent        // T, does not interrupt joining
+)
+
+// joiningRanges has the joining types of the Arabic and Syriac letters from
+// ArabicShaping.txt of Unicode 15.0, sorted by code point. Characters that are
+// not in the table are transparent if they are non spacing or enclosing marks
+// or format characters, otherwise they do not join.
+var joiningRanges = []struct {
+	lo, hi rune
+	jt     int
+}{
+	{0x0600, 0x0605, joinNone},
+	{0x0620, 0x0620, joinDual},
+	{0x0621, 0x0621, joinNone},
+	{0x0622, 0x0625, joinRight},
+	{0x0626, 0x0626, joinDual},
+	{0x0627, 0x0627, joinRight},
+	{0x0628, 0x0628, joinDual},
+	{0x0629, 0x0629, joinRight},
+	{0x062a, 0x062e, joinDual},
+	{0x062f, 0x0632, joinRight},
+	{0x0633, 0x063f, joinDual},
+	{0x0640, 0x0640, joinCausing},
+	{0x0641, 0x0647, joinDual},
+	{0x0648, 0x0648, joinRight},
+	{0x0649, 0x064a, joinDual},
+	{0x066e, 0x066f, joinDual},
+	{0x0671, 0x0673, joinRight},
+	{0x0674, 0x0674, joinNone},
+	{0x0675, 0x0677, joinRight},
+	{0x0678, 0x0687, joinDual},
+	{0x0688, 0x0699, joinRight},
+	{0x069a, 0x06bf, joinDual},
+	{0x06c0, 0x06c0, joinRight},
+	{0x06c1, 0x06c2, joinDual},
+	{0x06c3, 0x06cb, joinRight},
+	{0x06cc, 0x06cc, joinDual},
+	{0x06cd, 0x06cd, joinRight},
+	{0x06ce, 0x06ce, joinDual},
+	{0x06cf, 0x06cf, joinRight},
+	{0x06d0, 0x06d1, joinDual},
+	{0x06d2, 0x06d3, joinRight},
+	{0x06d5, 0x06d5, joinRight},
+	{0x06dd, 0x06dd, joinNone},
+	{0x06ee, 0x06ef, joinRight},
+	{0x06fa, 0x06fc, joinDual},
+	{0x06ff, 0x06ff, joinDual},
+	{0x0710, 0x0710, joinRight},
+	{0x0712, 0x0714, joinDual},
+	{0x0715, 0x0719, joinRight},
+	{0x071a, 0x071d, joinDual},
+	{0x071e, 0x071e, joinRight},
+	{0x071f, 0x0727, joinDual},
+	{0x0728, 0x0728, joinRight},
+	{0x0729, 0x0729, joinDual},
+	{0x072a, 0x072a, joinRight},
+	{0x072b, 0x072b, joinDual},
+	{0x072c, 0x072c, joinRight},
+	{0x072d, 0x072e, joinDual},
+	{0x072f, 0x072f, joinRight},
+	{0x074d, 0x074d, joinRight},
+	{0x074e, 0x0758, joinDual},
+	{0x0759, 0x075b, joinRight},
+	{0x075c, 0x076a, joinDual},
+	{0x076b, 0x076c, joinRight},
+	{0x076d, 0x0770, joinDual},
+	{0x0771, 0x0771, joinRight},
+	{0x0772, 0x0772, joinDual},
+	{0x0773, 0x0774, joinRight},
+	{0x0775, 0x0777, joinDual},
+	{0x0778, 0x0779, joinRight},
+	{0x077a, 0x077f, joinDual},
+	{0x0860, 0x0860, joinDual},
+	{0x0861, 0x0861, joinNone},
+	{0x0862, 0x0865, joinDual},
+	{0x0866, 0x0866, joinNone},
+	{0x0867, 0x0867, joinRight},
+	{0x0868, 0x0868, joinDual},
+	{0x0869, 0x086a, joinRight},
+	{0x0870, 0x0882, joinRight},
+	{0x0883, 0x0885, joinCausing},
+	{0x0886, 0x0886, joinDual},
+	{0x0887, 0x0888, joinNone},
+	{0x0889, 0x088d, joinDual},
+	{0x088e, 0x088e, joinRight},
+	{0x0890, 0x0891, joinNone},
+	{0x08a0, 0x08a9, joinDual},
+	{0x08aa, 0x08ac, joinRight},
+	{0x08ad, 0x08ad, joinNone},
+	{0x08ae, 0x08ae, joinRight},
+	{0x08af, 0x08b0, joinDual},
+	{0x08b1, 0x08b2, joinRight},
+	{0x08b3, 0x08b8, joinDual},
+	{0x08b9, 0x08b9, joinRight},
+	{0x08ba, 0x08c8, joinDual},
+	{0x08e2, 0x08e2, joinNone},
+	{0x200c, 0x200c, joinNone},
+	{0x200d, 0x200d, joinCausing},
+}
+
+// arabicFeatures are the features for the positional forms of joining
+// scripts with the glyph masks that the joining sets.
+var arabicFeatures = map[string]uint32{
+	"isol": maskIsol,
+	"fina": maskFina,
+	"medi": maskMedi,
+	"init": maskInit,
+}
+
+func joiningType(r rune) int {
+	i := sort.Search(len(joiningRanges), func(i int) bool { return joiningRanges[i].hi >= r })
+	if i < len(joiningRanges) && joiningRanges[i].lo <= r {
+		return joiningRanges[i].jt
+	}
+	if unicode.In(r, unicode.Mn, unicode.Me, unicode.Cf) {
+		return joinTransparent
+	}
+	return joinNone
+}
+
+// setArabicForms adds the masks of the positional forms to the glyphs. Two
+// characters join if the first one joins with the following character and
+// the second one with the preceding character, transparent characters in
+// between are skipped.
+func (s *shaper) setArabicForms() {
+	joinsPrev := make([]bool, len(s.glyphs))
+	joinsNext := make([]bool, len(s.glyphs))
+	types := make([]int, len(s.glyphs))
+	prev := -1
+	for i, g := range s.glyphs {
+		jt := joiningType(g.r)
+		types[i] = jt
+		if jt == joinTransparent {
+			continue
+		}
+		if prev >= 0 {
+			pt := types[prev]
+			if (pt == joinDual || pt == joinLeft || pt == joinCausing) && (jt == joinDual || jt == joinRight || jt == joinCausing) {
+				joinsNext[prev] = true
+				joinsPrev[i] = true
+			}
+		}
+		prev = i
+	}
+	for i := range s.glyphs {
+		if types[i] != joinDual && types[i] != joinRight && types[i] != joinLeft {
+			continue
+		}
+		switch {
+		case joinsPrev[i] && joinsNext[i]:
+			s.glyphs[i].mask |= maskMedi
+		case joinsPrev[i]:
+			s.glyphs[i].mask |= maskFina
+		case joinsNext[i]:
+			s.glyphs[i].mask |= maskInit
+		default:
+			s.glyphs[i].mask |= maskIsol
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package shape
+
+import "unicode"
+
+// rtlScripts are the scripts that are written from right to left.
+var rtlScripts = map[string]bool{
+	"adlm": true,
+	"arab": true,
+	"hebr": true,
+	"mand": true,
+	"nko ": true,
+	"samr": true,
+	"syrc": true,
+	"thaa": true,
+}
+
+// joiningScripts are the scripts that get the positional forms.
+var joiningScripts = map[string]bool{
+	"arab": true,
+	"syrc": true,
+}
+
+// mirrored has the mirrored characters for right to left text.
+var mirrored = map[rune]rune{
+	'(': ')', ')': '(',
+	'<': '>', '>': '<',
+	'[': ']', ']': '[',
+	'{': '}', '}': '{',
+	'«': '»', '»': '«',
+	'‹': '›', '›': '‹',
+}
+
+// Simplified bidi classes of the characters in a right to left run
+const (
+	bidiNeutral   = iota
+	bidiLeft      // strong left to right characters
+	bidiRight     // strong right to left characters
+	bidiNumber    // digits
+	bidiSeparator // separators inside of numbers
+)
+
+func isRTLChar(r rune) bool {
+	return r >= 0x0590 && r <= 0x08ff || r >= 0xfb1d && r <= 0xfdff || r >= 0xfe70 && r <= 0xfeff || r >= 0x10800 && r <= 0x10fff || r >= 0x1e800 && r <= 0x1efff
+}
+
+// ltrSegments returns for each character of a right to left run whether it
+// is displayed from left to right. This is a simplified version of the
+// rules of the Unicode bidi algorithm: numbers are left to right, a single
+// separator between digits belongs to the number (W4), numbers after left to
+// right text belong to the text (W7) and neutral characters between left to
+// right characters are left to right (N1). Non spacing marks get the class
+// of the previous character.
+func ltrSegments(runes []rune) []bool {
+	classes := make([]int, len(runes))
+	for i, r := range runes {
+		switch {
+		case unicode.Is(unicode.Mn, r) && i > 0:
+			classes[i] = classes[i-1]
+		case unicode.IsDigit(r):
+			classes[i] = bidiNumber
+		case isRTLChar(r):
+			classes[i] = bidiRight
+		case unicode.IsLetter(r):
+			classes[i] = bidiLeft
+		case r == ',' || r == '.' || r == ':' || r == '/' || r == '+' || r == '-':
+			classes[i] = bidiSeparator
+		default:
+			classes[i] = bidiNeutral
+		}
+	}
+	for i := 1; i < len(runes)-1; i++ {
+		if classes[i] == bidiSeparator && classes[i-1] == bidiNumber && classes[i+1] == bidiNumber {
+			classes[i] = bidiNumber
+		}
+	}
+	strong := bidiRight
+	for i, c := range classes {
+		switch c {
+		case bidiLeft, bidiRight:
+			strong = c
+		case bidiNumber:
+			if strong == bidiLeft {
+				classes[i] = bidiLeft
+			}
+		}
+	}
+	ltr := make([]bool, len(runes))
+	lastLeft := -1
+	for i, c := range classes {
+		switch c {
+		case bidiLeft:
+			for k := lastLeft + 1; k < i && lastLeft >= 0; k++ {
+				ltr[k] = true
+			}
+			ltr[i] = true
+			lastLeft = i
+		case bidiNumber:
+			ltr[i] = true
+			lastLeft = -1
+		case bidiRight:
+			lastLeft = -1
+		}
+	}
+	return ltr
+}
+
+// reorder brings the glyphs of a right to left run into the visual order.
+// The order of the glyphs in left to right segments is kept.
+func (s *shaper) reorder() {
+	g := s.glyphs
+	for i, j := 0, len(g)-1; i < j; i, j = i+1, j-1 {
+		g[i], g[j] = g[j], g[i]
+	}
+	for start := 0; start < len(g); {
+		if !g[start].ltr {
+			start++
+			continue
+		}
+		end := start
+		for end < len(g) && g[end].ltr {
+			end++
+		}
+		for i, j := start, end-1; i < j; i, j = i+1, j-1 {
+			g[i], g[j] = g[j], g[i]
+		}
+		start = end
+	}
+}
@@ -0,0 +1,263 @@
+package shape
+
+import "github.com/speedata/gootf/opentype"
+
+// applyGPOSLookup applies a positioning lookup to the glyphs.
+func (s *shaper) applyGPOSLookup(pl plannedLookup) {
+	for i := 0; i < len(s.glyphs); {
+		if s.applies(pl, i) {
+			if next := s.position(pl.lookup, i); next > i {
+				i = next
+				continue
+			}
+		}
+		i++
+	}
+}
+
+// nestedGPOS applies the GPOS lookup with the index at position pos.
+func (s *shaper) nestedGPOS(lookupIndex, pos int) {
+	if lookupIndex < len(s.font.GPOS.Lookups) {
+		s.position(&s.font.GPOS.Lookups[lookupIndex], pos)
+	}
+}
+
+// position applies the first matching subtable of the lookup at position i
+// and returns the position to continue with or -1 if no subtable matches.
+func (s *shaper) position(l *opentype.Lookup, i int) int {
+	gid := s.glyphs[i].gid
+	for _, st := range l.Subtables {
+		switch t := st.(type) {
+		case *opentype.SinglePos:
+			if vr, ok := t.Values[gid]; ok {
+				s.adjust(i, vr)
+				return i + 1
+			}
+		case *opentype.PairPos:
+			j := s.next(i, l)
+			if j < 0 {
+				return -1
+			}
+			if pv, ok := t.Lookup(gid, s.glyphs[j].gid); ok {
+				s.adjust(i, pv.First)
+				if t.ValueFormat2 == 0 {
+					return j
+				}
+				// the second glyph is not the first glyph of the next pair
+				s.adjust(j, pv.Second)
+				return j + 1
+			}
+		case *opentype.CursivePos:
+			exit := t.EntryExits[gid].Exit
+			if exit == nil {
+				continue
+			}
+			j := s.next(i, l)
+			if j < 0 {
+				return -1
+			}
+			entry := t.EntryExits[s.glyphs[j].gid].Entry
+			if entry == nil {
+				continue
+			}
+			s.connectCursive(i, j, exit, entry, l.Flag&opentype.LookupRightToLeft != 0)
+			return j
+		case *opentype.MarkBasePos:
+			mark, ok := t.Marks[gid]
+			if !ok {
+				continue
+			}
+			k := s.prevBase(i)
+			if k < 0 {
+				continue
+			}
+			if a := anchorAt(t.Bases[s.glyphs[k].gid], mark.Class); a != nil {
+				s.attachMark(i, k, a, &mark.Anchor)
+				return i + 1
+			}
+		case *opentype.MarkLigPos:
+			mark, ok := t.Marks[gid]
+			if !ok {
+				continue
+			}
+			k := s.prevBase(i)
+			if k < 0 {
+				continue
+			}
+			components := t.Ligatures[s.glyphs[k].gid]
+			if len(components) == 0 {
+				continue
+			}
+			comp := len(components) - 1
+			if g := s.glyphs[i]; g.ligID == s.glyphs[k].ligID && g.ligComp > 0 && g.ligComp <= len(components) {
+				comp = g.ligComp - 1
+			}
+			if a := anchorAt(components[comp], mark.Class); a != nil {
+				s.attachMark(i, k, a, &mark.Anchor)
+				return i + 1
+			}
+		case *opentype.MarkMarkPos:
+			mark, ok := t.Marks[gid]
+			if !ok {
+				continue
+			}
+			k := s.prev(i, l)
+			if k < 0 || s.glyphs[k].class != opentype.GlyphClassMark || !s.sameComponent(i, k) {
+				continue
+			}
+			if a := anchorAt(t.BaseMarks[s.glyphs[k].gid], mark.Class); a != nil {
+				s.attachMark(i, k, a, &mark.Anchor)
+				return i + 1
+			}
+		case *opentype.SequenceContext, *opentype.ChainedSequenceContext:
+			if next := s.applyContext(st, l, i, s.nestedGPOS); next >= 0 {
+				return next
+			}
+		}
+	}
+	return -1
+}
+
+func anchorAt(anchors []*opentype.Anchor, class int) *opentype.Anchor {
+	if class < len(anchors) {
+		return anchors[class]
+	}
+	return nil
+}
+
+// adjust adds the values of the value record to the glyph at position i.
+func (s *shaper) adjust(i int, vr opentype.ValueRecord) {
+	g := &s.glyphs[i]
+	g.xOff += vr.XPlacement
+	g.yOff += vr.YPlacement
+	g.xAdv += vr.XAdvance
+	g.yAdv += vr.YAdvance
+}
+
+// prevBase returns the position of the glyph before i that is not a mark or
+// -1.
+func (s *shaper) prevBase(i int) int {
+	for i--; i >= 0; i-- {
+		if s.glyphs[i].class != opentype.GlyphClassMark {
+			return i
+		}
+	}
+	return -1
+}
+
+// sameComponent reports whether the marks at the positions i and k belong to
+// the same ligature component, so that mark i can attach to mark k.
+func (s *shaper) sameComponent(i, k int) bool {
+	g1, g2 := s.glyphs[i], s.glyphs[k]
+	if g1.ligID == g2.ligID {
+		return g1.ligID == 0 || g1.ligComp == g2.ligComp
+	}
+	// one of the marks is attached to a ligature as a whole
+	return (g1.ligID > 0 && g1.ligComp == 0) || (g2.ligID > 0 && g2.ligComp == 0)
+}
+
+// attachMark attaches the mark at position i to the glyph at position k. The
+// offset is relative to the attached glyph until finishPositions.
+func (s *shaper) attachMark(i, k int, base, mark *opentype.Anchor) {
+	g := &s.glyphs[i]
+	g.xOff = base.X - mark.X
+	g.yOff = base.Y - mark.Y
+	g.attachTo, g.attachType = k, attachMark
+}
+
+// connectCursive connects the exit anchor of the glyph at position i with the
+// entry anchor of the glyph at position j. With rightToLeft (the lookup flag)
+// the glyph i is attached to j, otherwise j is attached to i.
+func (s *shaper) connectCursive(i, j int, exit, entry *opentype.Anchor, rightToLeft bool) {
+	gi, gj := &s.glyphs[i], &s.glyphs[j]
+	if s.forward(i) {
+		gi.xAdv = exit.X + gi.xOff
+		d := entry.X + gj.xOff
+		gj.xAdv -= d
+		gj.xOff -= d
+	} else {
+		d := exit.X + gi.xOff
+		gi.xAdv -= d
+		gi.xOff -= d
+		gj.xAdv = entry.X + gj.xOff
+	}
+	if rightToLeft {
+		gi.yOff = entry.Y - exit.Y
+		gi.attachTo, gi.attachType = j, attachCursive
+	} else {
+		gj.yOff = exit.Y - entry.Y
+		gj.attachTo, gj.attachType = i, attachCursive
+	}
+}
+
+// legacyKern applies the kern table to neighboring glyphs that are not marks.
+func (s *shaper) legacyKern() {
+	for i := 0; i < len(s.glyphs); i++ {
+		if s.glyphs[i].class == opentype.GlyphClassMark {
+			continue
+		}
+		j := i + 1
+		for j < len(s.glyphs) && s.glyphs[j].class == opentype.GlyphClassMark {
+			j++
+		}
+		if j == len(s.glyphs) {
+			return
+		}
+		s.glyphs[i].xAdv += s.font.Kern(s.glyphs[i].gid, s.glyphs[j].gid)
+	}
+}
+
+// finishPositions sets the advance of marks to zero and makes the offsets of
+// attached glyphs relative to their own position. The glyphs are still in
+// logical order.
+func (s *shaper) finishPositions() {
+	for i := range s.glyphs {
+		if g := &s.glyphs[i]; g.class == opentype.GlyphClassMark {
+			g.xAdv, g.yAdv = 0, 0
+		}
+	}
+	for i := range s.glyphs {
+		s.resolveAttachment(i)
+	}
+}
+
+func (s *shaper) resolveAttachment(i int) {
+	g := &s.glyphs[i]
+	k := g.attachTo
+	if k < 0 {
+		return
+	}
+	// resolve the glyph this one is attached to first
+	g.attachTo = -1
+	s.resolveAttachment(k)
+	g.yOff += s.glyphs[k].yOff
+	if g.attachType != attachMark {
+		return
+	}
+	g.xOff += s.glyphs[k].xOff
+	// the advances between the glyphs in visual order
+	switch {
+	case s.forward(i) && k < i:
+		for m := k; m < i; m++ {
+			g.xOff -= s.glyphs[m].xAdv
+		}
+	case s.forward(i):
+		for m := i; m < k; m++ {
+			g.xOff += s.glyphs[m].xAdv
+		}
+	case k < i:
+		for m := k + 1; m <= i; m++ {
+			g.xOff += s.glyphs[m].xAdv
+		}
+	default:
+		for m := i + 1; m <= k; m++ {
+			g.xOff -= s.glyphs[m].xAdv
+		}
+	}
+}
+
+// forward reports whether the glyph at position i is displayed from left to
+// right.
+func (s *shaper) forward(i int) bool {
+	return !s.rtl || s.glyphs[i].ltr
+}
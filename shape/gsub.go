@@ -0,0 +1,131 @@
+package shape
+
+import "github.com/speedata/gootf/opentype"
+
+// applyGSUBLookup applies a substitution lookup to the glyphs. Reverse
+// chaining substitutions are applied from the end of the text.
+func (s *shaper) applyGSUBLookup(pl plannedLookup) {
+	if pl.lookup.Type == opentype.GSUBReverseChainedContext {
+		for i := len(s.glyphs) - 1; i >= 0; i-- {
+			if s.applies(pl, i) {
+				s.substitute(pl.lookup, i)
+			}
+		}
+		return
+	}
+	for i := 0; i < len(s.glyphs); {
+		if s.applies(pl, i) {
+			if next := s.substitute(pl.lookup, i); next >= 0 {
+				i = next
+				continue
+			}
+		}
+		i++
+	}
+}
+
+// nestedGSUB applies the GSUB lookup with the index at position pos.
+func (s *shaper) nestedGSUB(lookupIndex, pos int) {
+	if lookupIndex < len(s.font.GSUB.Lookups) {
+		s.substitute(&s.font.GSUB.Lookups[lookupIndex], pos)
+	}
+}
+
+// substitute applies the first matching subtable of the lookup at position i
+// and returns the position after the substituted glyphs or -1 if no subtable
+// matches.
+func (s *shaper) substitute(l *opentype.Lookup, i int) int {
+	gid := s.glyphs[i].gid
+	for _, st := range l.Subtables {
+		switch t := st.(type) {
+		case *opentype.SingleSubst:
+			if sub, ok := t.Substitutes[gid]; ok {
+				s.setGlyph(i, sub)
+				return i + 1
+			}
+		case *opentype.MultipleSubst:
+			if seq, ok := t.Sequences[gid]; ok {
+				s.replace(i, seq)
+				return i + len(seq)
+			}
+		case *opentype.AlternateSubst:
+			if alternates := t.Alternates[gid]; len(alternates) > 0 {
+				s.setGlyph(i, alternates[0])
+				return i + 1
+			}
+		case *opentype.LigatureSubst:
+			for _, lig := range t.Ligatures[gid] {
+				if pos := s.matchInput(i, len(lig.Components), l, glyphMatch(lig.Components)); pos != nil {
+					s.ligate(pos, lig.Glyph)
+					return i + 1
+				}
+			}
+		case *opentype.ReverseChainSingleSubst:
+			if sub, ok := t.Substitutes[gid]; ok &&
+				s.matchBacktrack(i, len(t.BacktrackCoverages), l, coverageMatch(t.BacktrackCoverages)) &&
+				s.matchLookahead(i, len(t.LookaheadCoverages), l, coverageMatch(t.LookaheadCoverages)) {
+				s.setGlyph(i, sub)
+				return i + 1
+			}
+		case *opentype.SequenceContext, *opentype.ChainedSequenceContext:
+			if next := s.applyContext(st, l, i, s.nestedGSUB); next >= 0 {
+				return next
+			}
+		}
+	}
+	return -1
+}
+
+// setGlyph replaces the glyph at position i.
+func (s *shaper) setGlyph(i, gid int) {
+	g := &s.glyphs[i]
+	g.gid = gid
+	g.class = s.glyphClass(gid, g.r)
+}
+
+// replace replaces the glyph at position i by a sequence of glyphs, an empty
+// sequence deletes the glyph.
+func (s *shaper) replace(i int, seq []int) {
+	g := s.glyphs[i]
+	repl := make([]glyphInfo, len(seq))
+	for k, gid := range seq {
+		repl[k] = g
+		repl[k].gid = gid
+		repl[k].class = s.glyphClass(gid, g.r)
+	}
+	s.glyphs = append(s.glyphs[:i], append(repl, s.glyphs[i+1:]...)...)
+}
+
+// ligate replaces the glyphs at the positions by the ligature. Skipped marks
+// between the components stay behind the ligature and remember the
+// component they belong to. The clusters of the glyphs are merged.
+func (s *shaper) ligate(positions []int, gid int) {
+	first, last := positions[0], positions[len(positions)-1]
+	s.ligID++
+	cluster := s.glyphs[first].cluster
+	for k := first; k <= last; k++ {
+		if c := s.glyphs[k].cluster; c < cluster {
+			cluster = c
+		}
+	}
+	comp := 0
+	for k, p := first, 0; k <= last; k++ {
+		s.glyphs[k].cluster = cluster
+		if p < len(positions) && k == positions[p] {
+			p++
+			comp = p
+			continue
+		}
+		s.glyphs[k].ligID, s.glyphs[k].ligComp = s.ligID, comp
+	}
+	// marks after the ligature belong to the last component
+	for k := last + 1; k < len(s.glyphs) && s.glyphs[k].class == opentype.GlyphClassMark && s.glyphs[k].ligID == 0; k++ {
+		s.glyphs[k].ligID, s.glyphs[k].ligComp = s.ligID, len(positions)
+	}
+	s.setGlyph(first, gid)
+	s.glyphs[first].ligID, s.glyphs[first].ligComp = s.ligID, 0
+	for k := len(positions) - 1; k > 0; k-- {
+		p := positions[k]
+		s.glyphs = append(s.glyphs[:p], s.glyphs[p+1:]...)
+	}
+}
@@ -0,0 +1,454 @@
+// Package shape converts text to positioned glyphs with the GSUB and the GPOS
+// tables of an OpenType font. The shaper applies the lookups of the features
+// in the order of the lookup list and honors the lookup flags and the glyph
+// classes of the GDEF table. Arabic and Syriac text gets the positional forms
+// (init, medi, fina and isol) from the joining types of the characters. Text
+// in right to left scripts is returned in visual order.
+package shape
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/speedata/gootf/opentype"
+)
+
+// Glyph is a glyph of the shaped text. Cluster is the byte offset in the text
+// of the first character that belongs to the glyph. Advances and offsets are
+// in font units.
+type Glyph struct {
+	ID       int
+	Cluster  int
+	XAdvance int
+	YAdvance int
+	XOffset  int
+	YOffset  int
+}
+
+// DefaultFeatures are applied unless they are switched off.
+var DefaultFeatures = []string{"ccmp", "locl", "rlig", "calt", "liga", "clig", "curs", "kern", "mark", "mkmk"}
+
+// maxNesting is the maximum depth of nested contextual lookups.
+const maxNesting = 8
+
+// Glyph masks. maskGlobal is for the features that apply to all glyphs, the
+// other masks are for the positional forms of joining scripts.
+const (
+	maskGlobal = 1 << iota
+	maskIsol
+	maskFina
+	maskMedi
+	maskInit
+)
+
+const (
+	attachNone = iota
+	attachMark
+	attachCursive
+)
+
+// glyphInfo is a glyph in the buffer of the shaper.
+type glyphInfo struct {
+	gid     int
+	cluster int
+	r       rune // the character the glyph is created from
+	class   int  // glyph class from GDEF
+	mask    uint32
+	ligID   int  // id of the ligature for ligatures and the marks between their components
+	ligComp int  // component of the ligature for marks, starting with 1
+	ltr     bool // left to right segment in a right to left run
+	xAdv    int
+	yAdv    int
+	xOff    int
+	yOff    int
+	// attachment of marks and cursive glyphs
+	attachTo   int
+	attachType int
+}
+
+// plannedLookup is a lookup with the mask of the glyphs it applies to.
+type plannedLookup struct {
+	lookup *opentype.Lookup
+	mask   uint32
+}
+
+type shaper struct {
+	font   *opentype.Font
+	glyphs []glyphInfo
+	ligID  int
+	depth  int
+	rtl    bool
+}
+
+// Shape returns the glyphs for the text in the script and the language.
+// script and language are OpenType tags such as "latn" and "DEU", an empty
+// language selects the default language system. features switches features
+// on or off in addition to the default features, for example
+// map[string]bool{"liga": false, "onum": true}. The tables of the font must
+// be read before. The text should have a single script, for a right to left
+// script the glyphs are in visual order and the clusters decrease. Numbers
+// and left to right text inside of the run keep their order.
+func Shape(tt *opentype.Font, text, script, language string, features map[string]bool) ([]Glyph, error) {
+	if tt.ToCodepoint == nil {
+		return nil, fmt.Errorf("the cmap table of the font must be read before shaping")
+	}
+	if len(script) < 4 {
+		script += strings.Repeat(" ", 4-len(script))
+	}
+	masks := map[string]uint32{}
+	for _, f := range DefaultFeatures {
+		masks[f] = maskGlobal
+	}
+	if joiningScripts[script] {
+		for f, mask := range arabicFeatures {
+			masks[f] = mask
+		}
+	}
+	for f, on := range features {
+		if !on {
+			delete(masks, f)
+		} else if masks[f] == 0 {
+			masks[f] = maskGlobal
+		}
+	}
+	s := &shaper{font: tt, rtl: rtlScripts[script]}
+	var ltr []bool
+	if s.rtl {
+		ltr = ltrSegments([]rune(text))
+	}
+	ci := 0
+	for i, r := range text {
+		g := glyphInfo{cluster: i, r: r, mask: maskGlobal}
+		if s.rtl {
+			g.ltr = ltr[ci]
+			if m, ok := mirrored[r]; ok && !g.ltr {
+				r = m
+			}
+		}
+		g.gid = tt.ToCodepoint[r]
+		g.class = s.glyphClass(g.gid, g.r)
+		s.glyphs = append(s.glyphs, g)
+		ci++
+	}
+	if joiningScripts[script] {
+		s.setArabicForms()
+	}
+
+	if tt.GSUB != nil {
+		lookups, _ := planLookups(tt.GSUB, script, language, masks)
+		for _, pl := range lookups {
+			s.applyGSUBLookup(pl)
+		}
+	}
+	for i := range s.glyphs {
+		g := &s.glyphs[i]
+		g.xAdv, _ = tt.GlyphAdvance(g.gid)
+		g.attachTo = -1
+	}
+	kernFound := false
+	if tt.GPOS != nil {
+		lookups, found := planLookups(tt.GPOS, script, language, masks)
+		kernFound = found["kern"]
+		for _, pl := range lookups {
+			s.applyGPOSLookup(pl)
+		}
+	}
+	if masks["kern"] != 0 && !kernFound {
+		s.legacyKern()
+	}
+	s.finishPositions()
+	if s.rtl {
+		s.reorder()
+	}
+
+	ret := make([]Glyph, len(s.glyphs))
+	for i, g := range s.glyphs {
+		ret[i] = Glyph{
+			ID:       g.gid,
+			Cluster:  g.cluster,
+			XAdvance: g.xAdv,
+			YAdvance: g.yAdv,
+			XOffset:  g.xOff,
+			YOffset:  g.yOff,
+		}
+	}
+	return ret, nil
+}
+
+// planLookups returns the lookups of the features in the script and language
+// in the order of the lookup list. masks has the glyph mask for each feature
+// that is switched on. found has the features of the language that are
+// switched on.
+func planLookups(table *opentype.LayoutTable, script, language string, masks map[string]uint32) ([]plannedLookup, map[string]bool) {
+	found := map[string]bool{}
+	s := table.FindScript(script)
+	if s == nil {
+		return nil, found
+	}
+	lang := s.FindLanguage(language)
+	if lang == nil {
+		return nil, found
+	}
+	lookupMasks := map[int]uint32{}
+	addFeature := func(fi int, mask uint32) {
+		if fi < 0 || fi >= len(table.Features) || mask == 0 {
+			return
+		}
+		for _, li := range table.Features[fi].Lookups {
+			lookupMasks[li] |= mask
+		}
+	}
+	addFeature(lang.RequiredFeature, maskGlobal)
+	for _, fi := range lang.Features {
+		tag := table.Features[fi].Tag
+		if mask := masks[tag]; mask != 0 {
+			found[tag] = true
+			addFeature(fi, mask)
+		}
+	}
+	indexes := make([]int, 0, len(lookupMasks))
+	for li := range lookupMasks {
+		indexes = append(indexes, li)
+	}
+	sort.Ints(indexes)
+	lookups := make([]plannedLookup, len(indexes))
+	for i, li := range indexes {
+		lookups[i] = plannedLookup{lookup: &table.Lookups[li], mask: lookupMasks[li]}
+	}
+	return lookups, found
+}
+
+// glyphClass returns the class of the glyph from GDEF. Without glyph classes
+// in GDEF non spacing marks are marks and all other glyphs are base glyphs.
+func (s *shaper) glyphClass(gid int, r rune) int {
+	if gdef := s.font.GDEF; gdef != nil && len(gdef.GlyphClasses) > 0 {
+		return gdef.GlyphClasses[gid]
+	}
+	if unicode.Is(unicode.Mn, r) {
+		return opentype.GlyphClassMark
+	}
+	return opentype.GlyphClassBase
+}
+
+// skip reports whether the lookup ignores the glyph because of its flags.
+func (s *shaper) skip(g *glyphInfo, l *opentype.Lookup) bool {
+	switch g.class {
+	case opentype.GlyphClassBase:
+		return l.Flag&opentype.LookupIgnoreBaseGlyphs != 0
+	case opentype.GlyphClassLigature:
+		return l.Flag&opentype.LookupIgnoreLigatures != 0
+	case opentype.GlyphClassMark:
+		if l.Flag&opentype.LookupIgnoreMarks != 0 {
+			return true
+		}
+		gdef := s.font.GDEF
+		if gdef == nil {
+			return false
+		}
+		if l.Flag&opentype.LookupUseMarkFilteringSet != 0 {
+			if l.MarkFilteringSet >= len(gdef.MarkGlyphSets) {
+				return true
+			}
+			_, ok := gdef.MarkGlyphSets[l.MarkFilteringSet][g.gid]
+			return !ok
+		}
+		if markType := int(l.Flag&opentype.LookupMarkAttachmentType) >> 8; markType != 0 {
+			return gdef.MarkAttachClasses[g.gid] != markType
+		}
+	}
+	return false
+}
+
+// next returns the position of the next glyph after i that the lookup does
+// not skip or -1.
+func (s *shaper) next(i int, l *opentype.Lookup) int {
+	for i++; i < len(s.glyphs); i++ {
+		if !s.skip(&s.glyphs[i], l) {
+			return i
+		}
+	}
+	return -1
+}
+
+// prev returns the position of the previous glyph before i that the lookup
+// does not skip or -1.
+func (s *shaper) prev(i int, l *opentype.Lookup) int {
+	for i--; i >= 0; i-- {
+		if !s.skip(&s.glyphs[i], l) {
+			return i
+		}
+	}
+	return -1
+}
+
+// applies reports whether the lookup is applied to the glyph at position i.
+func (s *shaper) applies(pl plannedLookup, i int) bool {
+	g := &s.glyphs[i]
+	return g.mask&pl.mask != 0 && !s.skip(g, pl.lookup)
+}
+
+// matchFunc reports whether the glyph matches the k-th element of a sequence.
+type matchFunc func(k, gid int) bool
+
+func glyphMatch(glyphs []int) matchFunc {
+	return func(k, gid int) bool { return glyphs[k] == gid }
+}
+
+func classMatch(cd opentype.ClassDef, classes []int) matchFunc {
+	return func(k, gid int) bool { return cd[gid] == classes[k] }
+}
+
+func coverageMatch(covs []opentype.Coverage) matchFunc {
+	return func(k, gid int) bool {
+		_, ok := covs[k][gid]
+		return ok
+	}
+}
+
+// matchInput matches count glyphs after position i and returns the positions
+// of the input sequence including i or nil.
+func (s *shaper) matchInput(i, count int, l *opentype.Lookup, match matchFunc) []int {
+	positions := []int{i}
+	for k := 0; k < count; k++ {
+		if i = s.next(i, l); i < 0 || !match(k, s.glyphs[i].gid) {
+			return nil
+		}
+		positions = append(positions, i)
+	}
+	return positions
+}
+
+// matchBacktrack matches count glyphs before position i, the first one is the
+// glyph next to i.
+func (s *shaper) matchBacktrack(i, count int, l *opentype.Lookup, match matchFunc) bool {
+	for k := 0; k < count; k++ {
+		if i = s.prev(i, l); i < 0 || !match(k, s.glyphs[i].gid) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchLookahead matches count glyphs after position i.
+func (s *shaper) matchLookahead(i, count int, l *opentype.Lookup, match matchFunc) bool {
+	for k := 0; k < count; k++ {
+		if i = s.next(i, l); i < 0 || !match(k, s.glyphs[i].gid) {
+			return false
+		}
+	}
+	return true
+}
+
+// applyContext applies a *SequenceContext or a *ChainedSequenceContext at
+// position i. apply applies a nested lookup at a position. It returns the
+// position after the input sequence or -1 if the context does not match.
+func (s *shaper) applyContext(st opentype.LookupSubtable, l *opentype.Lookup, i int, apply func(lookupIndex, pos int)) int {
+	gid := s.glyphs[i].gid
+	switch c := st.(type) {
+	case *opentype.SequenceContext:
+		switch c.Format {
+		case 1, 2:
+			idx, ok := c.Coverage[gid]
+			if !ok {
+				return -1
+			}
+			match := glyphMatch
+			if c.Format == 2 {
+				idx = c.ClassDef[gid]
+				match = func(classes []int) matchFunc { return classMatch(c.ClassDef, classes) }
+			}
+			if idx >= len(c.RuleSets) {
+				return -1
+			}
+			for _, rule := range c.RuleSets[idx] {
+				if pos := s.matchInput(i, len(rule.Input), l, match(rule.Input)); pos != nil {
+					return s.applyNested(pos, rule.Lookups, apply)
+				}
+			}
+		case 3:
+			if len(c.InputCoverages) == 0 {
+				return -1
+			}
+			if _, ok := c.InputCoverages[0][gid]; !ok {
+				return -1
+			}
+			if pos := s.matchInput(i, len(c.InputCoverages)-1, l, coverageMatch(c.InputCoverages[1:])); pos != nil {
+				return s.applyNested(pos, c.Lookups, apply)
+			}
+		}
+	case *opentype.ChainedSequenceContext:
+		switch c.Format {
+		case 1, 2:
+			idx, ok := c.Coverage[gid]
+			if !ok {
+				return -1
+			}
+			backtrack, input, lookahead := glyphMatch, glyphMatch, glyphMatch
+			if c.Format == 2 {
+				idx = c.InputClassDef[gid]
+				backtrack = func(classes []int) matchFunc { return classMatch(c.BacktrackClassDef, classes) }
+				input = func(classes []int) matchFunc { return classMatch(c.InputClassDef, classes) }
+				lookahead = func(classes []int) matchFunc { return classMatch(c.LookaheadClassDef, classes) }
+			}
+			if idx >= len(c.RuleSets) {
+				return -1
+			}
+			for _, rule := range c.RuleSets[idx] {
+				pos := s.matchInput(i, len(rule.Input), l, input(rule.Input))
+				if pos == nil ||
+					!s.matchBacktrack(i, len(rule.Backtrack), l, backtrack(rule.Backtrack)) ||
+					!s.matchLookahead(pos[len(pos)-1], len(rule.Lookahead), l, lookahead(rule.Lookahead)) {
+					continue
+				}
+				return s.applyNested(pos, rule.Lookups, apply)
+			}
+		case 3:
+			if len(c.InputCoverages) == 0 {
+				return -1
+			}
+			if _, ok := c.InputCoverages[0][gid]; !ok {
+				return -1
+			}
+			pos := s.matchInput(i, len(c.InputCoverages)-1, l, coverageMatch(c.InputCoverages[1:]))
+			if pos == nil ||
+				!s.matchBacktrack(i, len(c.BacktrackCoverages), l, coverageMatch(c.BacktrackCoverages)) ||
+				!s.matchLookahead(pos[len(pos)-1], len(c.LookaheadCoverages), l, coverageMatch(c.LookaheadCoverages)) {
+				return -1
+			}
+			return s.applyNested(pos, c.Lookups, apply)
+		}
+	}
+	return -1
+}
+
+// applyNested applies the lookups of a context at the positions of the input
+// sequence and returns the position after the input sequence. Substitutions
+// that change the number of glyphs move the following positions.
+func (s *shaper) applyNested(positions []int, lookups []opentype.SequenceLookup, apply func(lookupIndex, pos int)) int {
+	start := positions[0]
+	end := positions[len(positions)-1] + 1
+	if s.depth >= maxNesting {
+		return end
+	}
+	s.depth++
+	for _, sl := range lookups {
+		if sl.SequenceIndex >= len(positions) || positions[sl.SequenceIndex] >= len(s.glyphs) {
+			continue
+		}
+		before := len(s.glyphs)
+		apply(sl.LookupIndex, positions[sl.SequenceIndex])
+		if delta := len(s.glyphs) - before; delta != 0 {
+			for k := sl.SequenceIndex + 1; k < len(positions); k++ {
+				positions[k] += delta
+			}
+			end += delta
+		}
+	}
+	s.depth--
+	if end <= start {
+		end = start + 1
+	}
+	return end
+}
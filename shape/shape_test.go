@@ -0,0 +1,219 @@
+package shape
+
+import (
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/speedata/gootf/opentype"
+)
+
+func loadFont(t *testing.T, filename string) *opentype.Font {
+	tt, err := opentype.LoadFace(filepath.Join("..", "opentype", "testdata", filename), 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = tt.ReadTables(); err != nil {
+		t.Fatal(err)
+	}
+	return tt
+}
+
+func TestShape(t *testing.T) {
+	tt := loadFont(t, "CrimsonPro-Regular.ttf")
+	testdata := []struct {
+		text     string
+		features map[string]bool
+		want     string
+	}{
+		// fi ligature, the clusters of the components are merged
+		{"afi", nil, "[{237 0 474 0 0 0} {478 1 547 0 0 0}]"},
+		{"afi", map[string]bool{"liga": false}, "[{237 0 474 0 0 0} {304 1 303 0 0 0} {317 2 268 0 0 0}]"},
+		// kerning of T o
+		{"To", nil, "[{184 0 517 0 0 0} {362 1 508 0 0 0}]"},
+		{"To", map[string]bool{"kern": false}, "[{184 0 557 0 0 0} {362 1 508 0 0 0}]"},
+		// acute attached to o
+		{"o\u0301", nil, "[{362 0 508 0 0 0} {720 1 0 0 -554 0}]"},
+		// the acute is replaced in the context of the grave (ccmp), the
+		// grave is attached to the acute (mkmk)
+		{"o\u0301\u0300", nil, "[{362 0 508 0 0 0} {773 1 0 0 -554 -230} {772 3 0 0 -554 -13}]"},
+		// oldstyle figures
+		{"1", map[string]bool{"onum": true}, "[{504 0 330 0 0 0}]"},
+	}
+	for _, td := range testdata {
+		glyphs, err := Shape(tt, td.text, "latn", "", td.features)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := fmt.Sprint(glyphs); got != td.want {
+			t.Errorf("Shape(%q, %v) = %s, want %s", td.text, td.features, got, td.want)
+		}
+	}
+	if _, err := Shape(&opentype.Font{}, "a", "latn", "", nil); err == nil {
+		t.Errorf("Shape() without a cmap should fail")
+	}
+}
+
+func TestShapePairPos(t *testing.T) {
+	// a b: the second glyph gets 10, b c: the first glyph gets 100. The b of
+	// the first pair must not be the first glyph of the second pair.
+	pairs := &opentype.PairPos{
+		Format:       1,
+		Coverage:     opentype.Coverage{1: 0, 2: 1},
+		ValueFormat1: 4,
+		ValueFormat2: 4,
+		Pairs: map[int]map[int]opentype.PairValue{
+			1: {2: {Second: opentype.ValueRecord{XAdvance: 10}}},
+			2: {3: {First: opentype.ValueRecord{XAdvance: 100}}},
+		},
+	}
+	tt := &opentype.Font{
+		ToCodepoint: map[rune]int{'a': 1, 'b': 2, 'c': 3},
+		GPOS: &opentype.LayoutTable{
+			Scripts: []opentype.Script{{
+				Tag:             "latn",
+				DefaultLanguage: &opentype.Language{RequiredFeature: -1, Features: []int{0}},
+			}},
+			Features: []opentype.Feature{{Tag: "kern", Lookups: []int{0}}},
+			Lookups: []opentype.Lookup{{
+				Type:      opentype.GPOSPair,
+				Subtables: []opentype.LookupSubtable{pairs},
+			}},
+		},
+	}
+	testdata := []struct {
+		valueFormat2 int
+		want         string
+	}{
+		{4, "[{1 0 0 0 0 0} {2 1 10 0 0 0} {3 2 0 0 0 0}]"},
+		// without values for the second glyph b is kerned with c
+		{0, "[{1 0 0 0 0 0} {2 1 100 0 0 0} {3 2 0 0 0 0}]"},
+	}
+	for _, td := range testdata {
+		pairs.ValueFormat2 = td.valueFormat2
+		glyphs, err := Shape(tt, "abc", "latn", "", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := fmt.Sprint(glyphs); got != td.want {
+			t.Errorf("Shape() with value format %d = %s, want %s", td.valueFormat2, got, td.want)
+		}
+	}
+}
+
+// arabicFont returns a font with positional forms for beh, alef and lam and a
+// lam alef ligature.
+func arabicFont() *opentype.Font {
+	single := func(subst map[int]int) opentype.Lookup {
+		return opentype.Lookup{Type: opentype.GSUBSingle, Subtables: []opentype.LookupSubtable{&opentype.SingleSubst{Substitutes: subst}}}
+	}
+	gsub := &opentype.LayoutTable{
+		Scripts: []opentype.Script{{
+			Tag:             "arab",
+			DefaultLanguage: &opentype.Language{RequiredFeature: -1, Features: []int{0, 1, 2, 3, 4}},
+		}},
+		Features: []opentype.Feature{
+			{Tag: "isol", Lookups: []int{0}},
+			{Tag: "fina", Lookups: []int{1}},
+			{Tag: "medi", Lookups: []int{2}},
+			{Tag: "init", Lookups: []int{3}},
+			{Tag: "rlig", Lookups: []int{4}},
+		},
+		Lookups: []opentype.Lookup{
+			single(map[int]int{1: 14}),
+			single(map[int]int{1: 13, 2: 22, 3: 33}),
+			single(map[int]int{1: 12, 3: 32}),
+			single(map[int]int{1: 11, 3: 31}),
+			{Type: opentype.GSUBLigature, Subtables: []opentype.LookupSubtable{&opentype.LigatureSubst{
+				Ligatures: map[int][]opentype.Ligature{31: {{Glyph: 40, Components: []int{22}}}},
+			}}},
+		},
+	}
+	return &opentype.Font{
+		ToCodepoint: map[rune]int{
+			'ب': 1, 'ا': 2, 'ل': 3, ' ': 5, '1': 6, '2': 7, '(': 8, ')': 9, '\u064e': 10,
+		},
+		GSUB: gsub,
+	}
+}
+
+func TestShapeArabic(t *testing.T) {
+	tt := arabicFont()
+	testdata := []struct {
+		text     string
+		features map[string]bool
+		want     string
+	}{
+		// beh beh: initial and final form in visual order
+		{"بب", nil, "[13/2 11/0]"},
+		{"ببب", nil, "[13/4 12/2 11/0]"},
+		{"بب", map[string]bool{"init": false}, "[13/2 1/0]"},
+		// alef does not join with the following character
+		{"اب", nil, "[14/2 2/0]"},
+		// lam alef ligature
+		{"لا", nil, "[40/0]"},
+		// the fatha does not break the joining
+		{"ب\u064eب", nil, "[13/4 10/2 11/0]"},
+		// numbers stay left to right
+		{"ب 12", nil, "[6/3 7/4 5/2 14/0]"},
+		// mirrored parentheses
+		{"(ب)", nil, "[8/3 14/1 9/0]"},
+	}
+	for _, td := range testdata {
+		glyphs, err := Shape(tt, td.text, "arab", "", td.features)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, g := range glyphs {
+			got = append(got, fmt.Sprintf("%d/%d", g.ID, g.Cluster))
+		}
+		if got, want := fmt.Sprint(got), td.want; got != want {
+			t.Errorf("Shape(%q, %v) = %s, want %s", td.text, td.features, got, want)
+		}
+	}
+}
+
+func TestJoiningType(t *testing.T) {
+	testdata := []struct {
+		r    rune
+		want int
+	}{
+		{'\u0628', joinDual},        // beh
+		{'\u0627', joinRight},       // alef
+		{'\u064e', joinTransparent}, // fatha
+		{'\u0600', joinNone},        // number sign, a format character
+		{'\u0712', joinDual},        // Syriac beth
+		{'\u0862', joinDual},        // Syriac Malayalam nya
+		{'\u0867', joinRight},       // Syriac Malayalam ra
+		{'\u0872', joinRight},       // alef with right middle stroke
+		{'\u0883', joinCausing},     // tatweel with overstruck hamza
+		{'\u0886', joinDual},        // thin yeh
+		{'\u0890', joinNone},        // pound mark above, a format character
+		{'\u08b5', joinDual},        // qaf with dot below and no dots above
+		{'\u08c3', joinDual},        // ghain with three dots above
+		{'a', joinNone},
+	}
+	for _, td := range testdata {
+		if got := joiningType(td.r); got != td.want {
+			t.Errorf("joiningType(%U) = %d, want %d", td.r, got, td.want)
+		}
+	}
+}
+
+func TestLTRSegments(t *testing.T) {
+	testdata := []struct {
+		text string
+		want string
+	}{
+		{"ب 12", "[false false true true]"},
+		{"ب 1,5 ب", "[false false true true true false false]"},
+		{"ب ab 1 ب", "[false false true true true true false false]"},
+		{"ب ab ب", "[false false true true false false]"},
+	}
+	for _, td := range testdata {
+		if got := fmt.Sprint(ltrSegments([]rune(td.text))); got != td.want {
+			t.Errorf("ltrSegments(%q) = %s, want %s", td.text, got, td.want)
+		}
+	}
+}